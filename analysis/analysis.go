@@ -0,0 +1,29 @@
+// Package analysis holds the semantic checks that run between parsing and
+// code generation.
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// Check resolves the names of prog and reports its semantic errors to diags.
+func Check(prog *parser.Program, diags *cerr.Diagnostics) {
+	Resolve(prog, diags)
+
+	structs := declareStructs(prog, diags)
+	methods := declareMethods(prog, structs, diags)
+	enums := declareEnums(prog, structs, diags)
+
+	checkStructs(prog, structs, enums, diags)
+	checkMethodCalls(prog, structs, methods, enums, diags)
+	checkVariants(prog, enums, diags)
+	checkMatches(prog, enums, diags)
+	checkLoops(prog, diags)
+	checkMaps(prog, diags)
+	checkRanges(prog, diags)
+	checkDestructuring(prog, structs, diags)
+	checkAssignments(prog, diags)
+	checkArities(prog, structs, methods, diags)
+	checkTypes(prog, structs, methods, enums, diags)
+}
@@ -0,0 +1,564 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+func check(t *testing.T, src string) *cerr.Diagnostics {
+	t.Helper()
+
+	diags := cerr.NewDiagnostics()
+	lexer := lexer.NewLexer(&src)
+	lexer.Diags = diags
+
+	parser := parser.NewParser(lexer.ParseAll())
+	parser.Diags = diags
+	prog := parser.Parse()
+	if diags.HasErrors() {
+		t.Fatalf("%s: %v", src, diags.All()[0])
+	}
+
+	Check(prog, diags)
+	return diags
+}
+
+// expectCodes checks that src compiles with exactly the given error codes.
+func expectCodes(t *testing.T, src string, codes ...cerr.Code) {
+	t.Helper()
+
+	diags := check(t, src).All()
+	if len(diags) != len(codes) {
+		t.Errorf("%s: expected %v, got %v", src, codes, diags)
+		return
+	}
+	for i, code := range codes {
+		if diags[i].Code != code {
+			t.Errorf("%s: expected %v, got %v", src, codes, diags)
+			return
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"struct P { x, y } func main() { var p = P { x: 1, y: 2 }; p.x += p.y; }": nil,
+		"struct P { x } let p = P { x: 1 }; func main() { println(p.x); }":        nil,
+		"struct P { x } func main() { P { x: 1, y: 2 }; }":                        {cerr.CODE_UNKNOWN_FIELD},
+		"struct P { x, y } func main() { P { x: 1 }; }":                           {cerr.CODE_MISSING_FIELD},
+		"struct P { x } func main() { P { x: 1, x: 2 }; }":                        {cerr.CODE_DUPLICATE_FIELD},
+		"struct P { x } func main() { Q {}; }":                                    {cerr.CODE_UNKNOWN_STRUCT},
+		"struct P { x } func main() { var p = 1; p.y = 2; }":                      {cerr.CODE_UNKNOWN_FIELD},
+		"struct P { x, x }":             {cerr.CODE_DUPLICATE_FIELD},
+		"struct P { x } struct P { y }": {cerr.CODE_DUPLICATE_STRUCT},
+		"func P() {} struct P { x }":    {cerr.CODE_DUPLICATE_STRUCT},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestUnknownFieldPosition(t *testing.T) {
+	src := "struct Point { x, y }\nfunc main() {\n  Point { x: 1, y: 2, z: 3 };\n}"
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected 1 error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if start := diag.Span.Start; start.Line != 2 || start.Column != 22 {
+		t.Errorf("Expected the error at the field 2:22, got %d:%d", start.Line, start.Column)
+	}
+	if len(diag.Labels) != 1 || diag.Labels[0].Span.Start.Column != 7 {
+		t.Errorf("Expected a label at the struct name, got %v", diag.Labels)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"struct P { x } impl P { func new() { P { x: 0 }; } func get(self) { self.x; } } func main() { P.new().get(); }": nil,
+		"struct P { f } func main() { let p = P { f: main }; p.f(); }":                                                   nil,
+		"struct P { x } impl P { func get(self) { 1; } } func main() { P { x: 1 }.put(); }":                              {cerr.CODE_UNKNOWN_METHOD},
+		"struct P { x } impl P { func get(self) { 1; } } func main() { P.get(); }":                                       {cerr.CODE_UNKNOWN_METHOD},
+		"struct P { x } impl P { func new() { 1; } } func main() { P.make(); }":                                          {cerr.CODE_UNKNOWN_METHOD},
+		"struct P { x } impl P { func new() { 1; } } func main() { let p = 1; p.new(); }":                                {cerr.CODE_UNKNOWN_METHOD},
+		"struct P { x } impl P { func a() {} } impl P { func a(self) {} }":                                               {cerr.CODE_DUPLICATE_METHOD},
+		"struct P { x } impl P { func x(self) {} }":                                                                      {cerr.CODE_DUPLICATE_METHOD},
+		"impl P { func a() {} }": {cerr.CODE_UNKNOWN_STRUCT},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"enum S { A(x), B } func main() { S.A(1); S.B; let f = S.A; }": nil,
+		"enum S { A(x), B } func main() { S.C; }":                      {cerr.CODE_UNKNOWN_VARIANT},
+		"enum S { A(x), B } func main() { S.A(1, 2); }":                {cerr.CODE_VARIANT_ARITY},
+		"enum S { A(x), B } func main() { S.B(); }":                    {cerr.CODE_VARIANT_ARITY},
+		"enum S { A, A }":             {cerr.CODE_DUPLICATE_VARIANT},
+		"enum S { A } enum S { B }":   {cerr.CODE_DUPLICATE_ENUM},
+		"struct S { x } enum S { B }": {cerr.CODE_DUPLICATE_ENUM},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"enum S { A(x), B } func main() { match S.B { S.A(_) => 1, S.B => 2 } }":                     nil,
+		"enum S { A(x), B } func main() { match S.B { S.A(1) => 1, S.A(x) if x > 1 => 2, _ => 3 } }": nil,
+		"enum S { A(x), B } func main() { match S.B { S.A(true) => 1, S.A(false) => 2, S.B => 3 } }": nil,
+		"func main() { let x = match 1 { 1 => \"one\", n => \"many\" }; }":                           nil,
+		"enum S { A(x), B } func main() { match S.B { S.A(_) => 1 } }":                               {cerr.CODE_NON_EXHAUSTIVE_MATCH},
+		"enum S { A(x), B } func main() { match S.B { S.A(x) if x > 1 => 1, S.B => 2 } }":            {cerr.CODE_NON_EXHAUSTIVE_MATCH},
+		"enum S { A(x), B } func main() { match S.B { S.A(1) => 1, S.B => 2 } }":                     {cerr.CODE_NON_EXHAUSTIVE_MATCH},
+		"func main() { match true { true => 1 } }":                                                   {cerr.CODE_NON_EXHAUSTIVE_MATCH},
+		"enum S { A(x), B } func main() { match S.B { S.C => 1, _ => 2 } }":                          {cerr.CODE_UNKNOWN_VARIANT},
+		"enum S { A(x), B } func main() { match S.B { T.A => 1, _ => 2 } }":                          {cerr.CODE_UNKNOWN_ENUM},
+		"enum S { A(x), B } func main() { match S.B { S.A => 1, _ => 2 } }":                          {cerr.CODE_VARIANT_ARITY},
+		"enum S { A(x), B } func main() { match S.B { S.B => 1, 2 => 2, _ => 3 } }":                  {cerr.CODE_MISMATCHED_PATTERN},
+		"enum S { A(x, y) } func main() { match S.A(1, 2) { S.A(x, x) => 1 } }":                      {cerr.CODE_DUPLICATE_BINDING},
+		"func main() { let x = match 1 { _ => { return; } }; }":                                      {cerr.CODE_RETURN_IN_MATCH_VALUE},
+		"func main() { match 1 { _ => { return; } } }":                                               nil,
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestNonExhaustiveMatchMessage(t *testing.T) {
+	src := `enum Shape { Circle(r), Rect(w, h), Empty }
+enum Opt { Some(v), None }
+func main() {
+    match Opt.None { Opt.Some(Shape.Circle(_)) => 1, Opt.Some(Shape.Empty) => 2 }
+}`
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected 1 error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if diag.Message != "Non-exhaustive match, not covered: Opt.Some(Shape.Rect(_, _)), Opt.None" {
+		t.Errorf("Unexpected message %q", diag.Message)
+	}
+	if len(diag.Labels) != 2 || diag.Labels[0].Span.Start.Line != 1 || diag.Labels[1].Span.Start.Column != 20 {
+		t.Errorf("Expected labels at Some and None, got %v", diag.Labels)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func main() { a: for { while true { break a; } continue; } }":    nil,
+		"func main() { for x in [1] { match x { _ => { continue; } } } }": nil,
+		"func main() { break; }":                                                 {cerr.CODE_BREAK_OUTSIDE_LOOP},
+		"func main() { while true { let f = func() { break; }; } }":              {cerr.CODE_BREAK_OUTSIDE_LOOP},
+		"func main() { while true { let v = match 1 { _ => { continue; } }; } }": {cerr.CODE_BREAK_OUTSIDE_LOOP},
+		"func main() { a: while true { break b; } }":                             {cerr.CODE_UNKNOWN_LABEL},
+		"func main() { a: while true { a: while true {} } }":                     {cerr.CODE_DUPLICATE_LABEL},
+		"func main() { a: while true {} a: while true { break a; } }":            nil,
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestMaps(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		`func main() { let a = "c"; let m = #{ "a": 1, "b": 2, a: 3, a: 4 }; }`: nil,
+		`func main() { let m = #{ "a": 1, "a": 2 }; }`:                          {cerr.CODE_DUPLICATE_KEY},
+		`func main() { let m = #{ 1: #{ true: 1, true: 2 } }; }`:                {cerr.CODE_DUPLICATE_KEY},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func main() { for i in 0..3 {} let s = [1][..1]; let r = 1..=2; }": nil,
+		"func main() { for i in ..3 {} }":                                   {cerr.CODE_OPEN_RANGE},
+		"func main() { let r = [1][0..]; let x = [0..]; }":                  {cerr.CODE_OPEN_RANGE},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func f(g) { let [a, [b, c], ..d] = [1, [2, 3]]; let [e, f] = g; }":                nil,
+		"func main() { for [i, v] in enumerate([1]) {} for [x, ..] in [[1], [2, 3]] {} }":  nil,
+		"struct P { x, y } func main() { let P { x, y: [a] } = P { x: 1, y: [2] }; }":      nil,
+		"func main() { let [a, b] = [1]; }":                                                {cerr.CODE_PATTERN_SHAPE},
+		"func main() { let [a, b, ..c] = [1]; }":                                           {cerr.CODE_PATTERN_SHAPE},
+		"func main() { let [a] = #{}; }":                                                   {cerr.CODE_PATTERN_SHAPE},
+		"func main() { for [a] in 0..2 {} }":                                               {cerr.CODE_PATTERN_SHAPE},
+		"func main() { for [a, b, c] in enumerate([1]) {} }":                               {cerr.CODE_PATTERN_SHAPE},
+		"struct P { x } struct Q { x } func main() { let P { x } = Q { x: 1 }; }":          {cerr.CODE_PATTERN_SHAPE},
+		"struct P { x } func main() { let P { x: [a] } = P { x: 1 }; let P { x } = [1]; }": {cerr.CODE_PATTERN_SHAPE, cerr.CODE_PATTERN_SHAPE},
+		"struct P { x } func f(p) { let P { y } = p; let Q { x } = p; }":                   {cerr.CODE_UNKNOWN_FIELD, cerr.CODE_UNKNOWN_STRUCT},
+		"struct P { x } func f(p, q) { let P { x, x: y } = p; let [a, ..a] = q; }":         {cerr.CODE_DUPLICATE_FIELD, cerr.CODE_DUPLICATE_BINDING},
+		"func main() { for k, [k] in [[1]] {} }":                                           {cerr.CODE_DUPLICATE_BINDING},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func main() { let x = f(1); let g = func() { return later; }; let later = x; } func f(a) { return a; }":                                       nil,
+		"func main() { let x = 1; if true { let x = 2; } for y in [x] { let x = y; } }":                                                                nil,
+		"let a = [1]; let b = a; func main() { println(c, len(b)); } let c = 2;":                                                                       nil,
+		"struct P { x } impl P { func new() { return P { x: 1 }; } } enum E { A } func main() { let p = P.new(); let e = E.A; match e { E.A => {} } }": nil,
+		"func main() { match [1] { n if n > 0 => { let m = n; } _ => {} } }":                                                                           nil,
+		"func main() { println(x); }":                                   {cerr.CODE_UNDEFINED_NAME},
+		"func main() { if true { let x = 1; } println(x); }":            {cerr.CODE_UNDEFINED_NAME},
+		"func main() { match 1 { n => {} } println(n); }":               {cerr.CODE_UNDEFINED_NAME},
+		"func main() { let x = 1; var x = 2; }":                         {cerr.CODE_DUPLICATE_DECLARATION},
+		"func f(a, a) {} func g(a) { let [a] = [1]; }":                  {cerr.CODE_DUPLICATE_DECLARATION, cerr.CODE_DUPLICATE_DECLARATION},
+		"func main() { println(x); let x = 1; }":                        {cerr.CODE_USE_BEFORE_DECLARATION},
+		"func main() { let x = 1; if true { println(x); let x = 2; } }": {cerr.CODE_USE_BEFORE_DECLARATION},
+		"func main() { var x = x; for v in v {} }":                      {cerr.CODE_USE_BEFORE_DECLARATION, cerr.CODE_USE_BEFORE_DECLARATION},
+		"let a = b; let b = 1;":                                         {cerr.CODE_USE_BEFORE_DECLARATION},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	src := "func main() { let x = 1; let f = func(x) { return x; }; println(fact(x)); } func fact(n) { return n; }"
+	diags := cerr.NewDiagnostics()
+	p := parser.NewParser(lexer.NewLexer(&src).ParseAll())
+	p.Diags = diags
+	prog := p.Parse()
+
+	Resolve(prog, diags)
+	if diags.HasErrors() {
+		t.Fatal(diags.All()[0])
+	}
+
+	body := prog.Functions[0].Body.(*parser.BraceExpr).Exprs
+	decl := body[0].(*parser.DeclarationExpr)
+	lambda := body[1].(*parser.DeclarationExpr).Expr.(*parser.LambdaExpr)
+	inner := lambda.Body.(*parser.BraceExpr).Exprs[0].(*parser.ReturnExpr).Value.(*parser.VariableExpr)
+	if inner.Symbol.Kind != parser.SYMBOL_PARAM || inner.Symbol.Span != lambda.Proto.Args[0].Span {
+		t.Errorf("Expected the lambda parameter, got %v", inner.Symbol)
+	}
+
+	print := body[2].(*parser.CallExpr)
+	if print.Symbol().Kind != parser.SYMBOL_BUILTIN {
+		t.Errorf("Expected a builtin, got %v", print.Symbol())
+	}
+	fact := print.Args[0].(*parser.CallExpr)
+	if sym := fact.Symbol(); sym.Kind != parser.SYMBOL_FUNCTION || sym.Proto != prog.Functions[1].Proto {
+		t.Errorf("Expected fact, got %v", sym)
+	}
+	if x := fact.Args[0].(*parser.VariableExpr); x.Symbol.Span != decl.NameSpan {
+		t.Errorf("Expected the local x, got %v", x.Symbol)
+	}
+}
+
+func TestResolveMessages(t *testing.T) {
+	tests := map[string]string{
+		"func main() { let count = 1; println(cout); }":      "a similar name is declared here: 'count'",
+		"func main() { if true { let x = 1; } println(x); }": "'x' is declared here, but not in scope",
+		"func main() { println(x); let x = 1; }":             "'x' declared here",
+		"func main() { let x = 1; let x = 2; }":              "first declared here",
+	}
+
+	for src, label := range tests {
+		diags := check(t, src).All()
+		if len(diags) != 1 || len(diags[0].Labels) != 1 || diags[0].Labels[0].Message != label {
+			t.Errorf("%s: expected a label %q, got %v", src, label, diags)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func main() { var x = 1; x += 1; var [a, b] = [1, 2]; a = b; for var i = 0; i < 3; i += 1 {} }": nil,
+		"struct P { n } impl P { func add(self, k) { self.n += k; } } func f(xs) { xs[0] = 1; }":         nil,
+		"func main() { for row in [[1]] { row[0] = 2; } var xs = [[1]]; xs[0][0] = 1; }":                 nil,
+		"func main() { let x = 1; x = 2; }":                                         {cerr.CODE_ASSIGN_IMMUTABLE},
+		"func main() { let x = 1; x += 2; }":                                        {cerr.CODE_ASSIGN_IMMUTABLE},
+		"func main() { let xs = [[1]]; xs[0] = [2]; xs[0][0] = 2; }":                {cerr.CODE_ASSIGN_IMMUTABLE, cerr.CODE_ASSIGN_IMMUTABLE},
+		"struct P { x } func main() { let p = P { x: 1 }; p.x -= 1; }":              {cerr.CODE_ASSIGN_IMMUTABLE},
+		"func main() { let [a, ..b] = [1]; b[0] = a; }":                             {cerr.CODE_ASSIGN_IMMUTABLE},
+		"const C = 1; func main() { C = 2; }":                                       {cerr.CODE_ASSIGN_IMMUTABLE},
+		"func f(a) { a = 1; } struct P { x } impl P { func m(self) { self = 1; } }": {cerr.CODE_ASSIGN_IMMUTABLE, cerr.CODE_ASSIGN_IMMUTABLE},
+		"func main() { for i in 0..3 { i += 1; } match 1 { n => { n = 2; } } }":     {cerr.CODE_ASSIGN_IMMUTABLE, cerr.CODE_ASSIGN_IMMUTABLE},
+		"func main() { main = 1; len = 2; }":                                        {cerr.CODE_ASSIGN_IMMUTABLE, cerr.CODE_ASSIGN_IMMUTABLE},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestAssignmentMessage(t *testing.T) {
+	src := "func main() {\n    let xs = [1];\n    xs[0] = 2;\n}"
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected one error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if diag.Message != "Cannot assign to an element of immutable variable 'xs'" {
+		t.Errorf("Unexpected message %q", diag.Message)
+	}
+	if diag.Span.Start.Line != 2 || diag.Span.Start.Column != 4 {
+		t.Errorf("Expected the error at the assignment, got %v", diag.Span)
+	}
+	if len(diag.Labels) != 1 || diag.Labels[0].Span.Start.Line != 1 || diag.Labels[0].Span.Start.Column != 8 {
+		t.Errorf("Expected a label at the declaration, got %v", diag.Labels)
+	}
+}
+
+func TestArity(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func main() { f(1, 2); println(); println(1, 2, 3); } func f(a, b) { return len([a, b]); }":                                             nil,
+		"func main() { let add = func(a, b) { return a + b; }; add(1, 2); var g = add; g(1); }":                                                  nil,
+		"struct P { x } impl P { func new(x) { return P { x: x }; } func get(self, k) { return self.x + k; } } func main() { P.new(1).get(2); }": nil,
+		"func main() { f(1); } func f(a, b) { return a; }":                                                                                       {cerr.CODE_CALL_ARITY},
+		"func main() { main(1); }":                                                                                    {cerr.CODE_CALL_ARITY},
+		"func main() { len([1], 2); has([1]); keys(); }":                                                              {cerr.CODE_CALL_ARITY, cerr.CODE_CALL_ARITY, cerr.CODE_CALL_ARITY},
+		"func main() { let f = func(x) { return x; }; f(); let g = f; g(); }":                                         {cerr.CODE_CALL_ARITY},
+		"func main() { func(x) { return x; }(1, 2); }":                                                                {cerr.CODE_CALL_ARITY},
+		"struct P { x } impl P { func new(x) { return P { x: x }; } } func main() { P.new(); }":                       {cerr.CODE_CALL_ARITY},
+		"struct P { x } impl P { func get(self) { return self.x; } } func f(p) { p.get(1); }":                         {cerr.CODE_CALL_ARITY},
+		"struct P { x } impl P { func m(self) {} } struct Q { y } impl Q { func m(self, a) {} } func f(p) { p.m(); }": nil,
+		"struct P { m } struct Q { y } impl Q { func m(self) {} } func f(p) { p.m(1); }":                              nil,
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestArityMessage(t *testing.T) {
+	src := "func main() {\n    fact(1, 2);\n}\nfunc fact(n) { return n; }"
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected one error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if diag.Message != "Function 'fact' takes 1 argument, but 2 arguments given" {
+		t.Errorf("Unexpected message %q", diag.Message)
+	}
+	if len(diag.Labels) != 1 || diag.Labels[0].Span.Start.Line != 3 {
+		t.Errorf("Expected a label at the declaration, got %v", diag.Labels)
+	}
+}
+
+func TestTypes(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func add(a: int, b: float) -> number { return a + b; } func main() { let s: string = \"n\" + add(1, 2); }":                        nil,
+		"struct P { x: number } impl P { func get(self) -> number { return self.x; } } func main() { let p = P { x: 1 }; p.get() + p.x; }": nil,
+		"func f(g: func(number) -> number) { return g(1); } func main() { f(func(x) { return x; }); let xs: [any] = [1, \"a\"]; }":         nil,
+		"func main() { var m = #{ \"a\": 1 }; m[\"b\"] = 2; for k, v in m { k + \"!\"; v * 2; } let [a, ..b] = [1, 2]; a + b[0]; }":        nil,
+		"func main() { var x = 0; x = \"s\"; }":                                                                  {cerr.CODE_TYPE_MISMATCH},
+		"func main() { \"a\" + true; 1 - \"b\"; !1; -true; }":                                                    {cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH},
+		"func main() { let n = 1; n[0]; true[0..1]; }":                                                           {cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH},
+		"func main() { let xs: [string] = [1]; let m: #{string: number} = #{}; m[1]; }":                          {cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH},
+		"func main() { let xs: [string] = [\"a\", 1]; let m: #{string: number} = #{\"a\": 1, \"b\": \"x\"}; }":   {cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH},
+		"func main() { let m = #{\"a\": 1}; len(m); len(keys(m)) + len(\"ab\"); }":                               {cerr.CODE_TYPE_MISMATCH},
+		"func main() { let [n, [s, ..t]] = [1, [\"a\", \"b\"]]; n * 2; s - 1; t[0] + \"!\"; }":                   {cerr.CODE_TYPE_MISMATCH},
+		"func main() { let xss: [[number]] = [[1], [2, \"3\"]]; let m = #{1: true, \"b\": false}; [1, \"a\"]; }": {cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH},
+		"func f(a: number) -> string { return a; } func main() { f(\"1\"); }":                                    {cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH},
+		"struct P { x: string } func main() { P { x: 1 }; }":                                                     {cerr.CODE_TYPE_MISMATCH},
+		"func main() { let f = 1; f(); for c in true {} len(2); }":                                               {cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH, cerr.CODE_TYPE_MISMATCH},
+		"func f(p: Pt) {} func main() { let x: [Q] = []; }":                                                      {cerr.CODE_UNKNOWN_TYPE, cerr.CODE_UNKNOWN_TYPE},
+		"struct P { x } struct Q { y } func main() { let p = P { x: 1 }; p.y; }":                                 {cerr.CODE_UNKNOWN_FIELD},
+		"func f(n: number) { let [a] = n; }":                                                                     {cerr.CODE_PATTERN_SHAPE},
+		"func f(a: number) { a = \"x\"; }":                                                                       {cerr.CODE_ASSIGN_IMMUTABLE},
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestTypesStored(t *testing.T) {
+	src := "struct P { x: number } func main() { let xs = [P { x: 1 }]; for p in xs { println(p.x); } } func id(v) -> string { return v; }"
+	diags := cerr.NewDiagnostics()
+	p := parser.NewParser(lexer.NewLexer(&src).ParseAll())
+	p.Diags = diags
+	prog := p.Parse()
+
+	Check(prog, diags)
+	if diags.HasErrors() {
+		t.Fatal(diags.All()[0])
+	}
+
+	body := prog.Functions[0].Body.(*parser.BraceExpr).Exprs
+	decl := body[0].(*parser.DeclarationExpr)
+	if got := decl.Expr.GetValueType().String(); got != "[P]" {
+		t.Errorf("Expected '[P]', got %q", got)
+	}
+	if got := decl.Symbol.Type.String(); got != "[P]" {
+		t.Errorf("Expected xs to be '[P]', got %q", got)
+	}
+	loop := body[1].(*parser.ForeachExpr)
+	if got := loop.VarSymbol.Type.String(); got != "P" {
+		t.Errorf("Expected p to be 'P', got %q", got)
+	}
+	field := loop.Body.(*parser.BraceExpr).Exprs[0].(*parser.CallExpr).Args[0]
+	if got := field.GetValueType().String(); got != "number" {
+		t.Errorf("Expected p.x to be 'number', got %q", got)
+	}
+
+	ret := prog.Functions[1].Body.(*parser.BraceExpr).Exprs[0].(*parser.ReturnExpr)
+	if got := ret.Value.GetValueType().String(); got != "string" {
+		t.Errorf("Expected an unannotated parameter to be inferred as 'string', got %q", got)
+	}
+}
+
+func TestTypeMessage(t *testing.T) {
+	src := "func main() {\n    let n: int = \"one\";\n}"
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected one error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if diag.Message != "Mismatched types: expected 'number', found 'string'" {
+		t.Errorf("Unexpected message %q", diag.Message)
+	}
+	if len(diag.Labels) != 1 || diag.Labels[0].Span.Start.Line != 1 || diag.Labels[0].Span.Start.Column != 11 {
+		t.Errorf("Expected a label at the annotation, got %v", diag.Labels)
+	}
+}
+
+func TestInfer(t *testing.T) {
+	tests := map[string]string{
+		"func fact(n) { if n <= 1 { return 1; } return n * fact(n - 1); }":                    "fact: func(number) -> number\n",
+		"func id(x) { return x; } func main() { id(1) + 1; id(\"s\") + \"t\"; }":              "id: func('a) -> 'a\nmain: func() -> void\n",
+		"func apply(f, x) { return f(x); }":                                                   "apply: func(func('a) -> 'b, 'a) -> 'b\n",
+		"func first(xs) { let ys = [xs]; return ys; }":                                        "first: func('a) -> ['a]\n",
+		"func first(xs) { return xs[0]; }":                                                    "first: func('a{[number]: 'b}) -> 'b\n",
+		"struct P { x: number } func getx(p) { return p.x; }":                                 "getx: func('a{x: 'b}) -> 'b\n",
+		"func sum(xs) { var t = 0; for x in xs { t += x; } return t; }":                       "sum: func('a{['b]: number}) -> number\n",
+		"func f(m: #{string: number}, k) { return m[k] + 1; }":                                "f: func(#{string: number}, string) -> number\n",
+		"struct P { x: number } impl P { func add(self, d) { return P { x: self.x + d }; } }": "P.add: func(P, number) -> P\n",
+	}
+
+	for src, want := range tests {
+		diags := cerr.NewDiagnostics()
+		p := parser.NewParser(lexer.NewLexer(&src).ParseAll())
+		p.Diags = diags
+		prog := p.Parse()
+		Check(prog, diags)
+		if diags.HasErrors() {
+			t.Errorf("%s: %v", src, diags.All()[0])
+			continue
+		}
+		if got := Signatures(prog); got != want {
+			t.Errorf("%s: expected %q, got %q", src, want, got)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	tests := map[string][]cerr.Code{
+		"func main() { let id = func(x) { return x; }; id(1) + 1; id(\"s\") + \"t\"; }":             nil,
+		"func main() { var g = func(x) { return x; }; g(1); g(\"s\"); }":                            {cerr.CODE_TYPE_MISMATCH},
+		"func half(n) { return n / 2; } func main() { half(\"two\"); }":                             {cerr.CODE_TYPE_MISMATCH},
+		"func pick(c) { if c { return 1; } return \"one\"; }":                                       {cerr.CODE_TYPE_MISMATCH},
+		"func f(g) { return g(g); }":                                                                {cerr.CODE_TYPE_MISMATCH},
+		"func f(n) { let h = n * 2; return n + true; }":                                             {cerr.CODE_TYPE_MISMATCH},
+		"func main() { var xs = []; xs[0] = 1; let s: string = xs[1]; }":                            {cerr.CODE_TYPE_MISMATCH},
+		"func len2(xs) { return len(xs); } func main() { len2([1]) + len2(\"ab\"); }":               nil,
+		"func first(xs) { return xs[0]; } func main() { let n: number = first([\"x\"]); }":          {cerr.CODE_TYPE_MISMATCH},
+		"func first(xs) { return xs[0]; } func main() { first(#{\"a\": 1}); }":                      {cerr.CODE_TYPE_MISMATCH},
+		"struct P { x: number } func getx(p) { return p.x; } func main() { getx(1); }":              {cerr.CODE_TYPE_MISMATCH},
+		"struct P { x: number } func getx(p) { return p.x; } func main() { getx(P { x: 1 }) + 1; }": nil,
+	}
+
+	for src, codes := range tests {
+		expectCodes(t, src, codes...)
+	}
+}
+
+func TestInferMessage(t *testing.T) {
+	src := "func half(n) {\n    let h = n / 2;\n    return h;\n}\nfunc main() {\n    half(\"two\");\n}"
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected one error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if diag.Message != "Mismatched types: expected 'number', found 'string'" {
+		t.Errorf("Unexpected message %q", diag.Message)
+	}
+	if diag.Span.Start.Line != 5 || diag.Span.Start.Column != 9 {
+		t.Errorf("Expected the error at the argument, got %v", diag.Span)
+	}
+	if len(diag.Labels) != 1 || diag.Labels[0].Span.Start.Line != 1 || diag.Labels[0].Span.Start.Column != 12 {
+		t.Errorf("Expected a label where 'n' became a number, got %v", diag.Labels)
+	}
+}
+
+func TestInferConflictLabels(t *testing.T) {
+	src := "func f(a, b) {\n    a - 1;\n    b < \"z\";\n    var v = a;\n    v = b;\n}"
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected one error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if diag.Message != "Mismatched types: expected 'number', found 'string'" {
+		t.Errorf("Unexpected message %q", diag.Message)
+	}
+	if len(diag.Labels) != 2 || diag.Labels[0].Span.Start.Line != 1 || diag.Labels[1].Span.Start.Line != 2 {
+		t.Errorf("Expected labels where 'a' and 'b' were inferred, got %v", diag.Labels)
+	}
+}
+
+func TestLiteralElementMessage(t *testing.T) {
+	src := "func main() {\n    let xs: [string] = [\"a\", 1];\n}"
+	diags := check(t, src).All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected one error, got %v", diags)
+	}
+
+	diag := diags[0]
+	if diag.Message != "Mismatched types: expected 'string', found 'number'" {
+		t.Errorf("Unexpected message %q", diag.Message)
+	}
+	if diag.Span.Start.Line != 1 || diag.Span.Start.Column != 29 {
+		t.Errorf("Expected the error at the element, got %v", diag.Span)
+	}
+	if len(diag.Labels) != 1 || diag.Labels[0].Span.Start.Column != 13 {
+		t.Errorf("Expected a label at the annotation, got %v", diag.Labels)
+	}
+}
+
+func TestMapLengthMessage(t *testing.T) {
+	diags := check(t, "func main() { let m = #{\"a\": 1}; len(m); }").All()
+	if len(diags) != 1 {
+		t.Fatalf("Expected one error, got %v", diags)
+	}
+	diag := diags[0]
+	if diag.Message != "Cannot take the length of '#{string: number}'" || len(diag.Notes) != 1 || !strings.Contains(diag.Notes[0], "len(keys(m))") {
+		t.Errorf("Expected a note pointing to len(keys(m)), got %v", diag)
+	}
+}
@@ -0,0 +1,105 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checkArities reports calls with a number of arguments the called function
+// doesn't take. The function is known for calls of functions, builtins,
+// lambdas, immutable variables declared with a lambda and methods called on
+// a struct. A method called on a value is checked if every method of that
+// name takes the same number of arguments and no field could hold a
+// function instead.
+func checkArities(prog *parser.Program, structs map[string]*parser.StructAST, methods map[string]map[string]*parser.FunctionAST, diags *cerr.Diagnostics) {
+	fields := make(map[string]bool)
+	for _, st := range structs {
+		for _, field := range st.Fields {
+			fields[field.Name] = true
+		}
+	}
+	byName := make(map[string][]*parser.FunctionAST)
+	for _, impl := range prog.Impls {
+		for _, method := range methods[impl.Name] {
+			if method.HasSelf() {
+				byName[method.Proto.Name] = append(byName[method.Proto.Name], method)
+			}
+		}
+	}
+
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		call, ok := expr.(*parser.CallExpr)
+		if !ok {
+			return true
+		}
+
+		switch callee := call.Callee.(type) {
+		case *parser.VariableExpr:
+			checkFunctionCall(call, callee.Symbol, diags)
+		case *parser.LambdaExpr:
+			checkArity(call, "Function", len(callee.Proto.Args), callee.Proto.Span, diags)
+		case *parser.MemberExpr:
+			receiver, ok := callee.Object.(*parser.VariableExpr)
+			if ok && receiver.Symbol != nil && receiver.Symbol.Kind == parser.SYMBOL_STRUCT {
+				// Methods called on a struct take no self, see checkMethodCalls.
+				if method := methods[receiver.Name][callee.Field]; method != nil && !method.HasSelf() {
+					checkArity(call, "Method", len(method.Proto.Args), method.Proto.Span, diags)
+				}
+				return true
+			}
+			checkMethodArity(call, callee, byName[callee.Field], fields, diags)
+		}
+		return true
+	})
+}
+
+func checkFunctionCall(call *parser.CallExpr, sym *parser.Symbol, diags *cerr.Diagnostics) {
+	switch {
+	case sym == nil:
+	case sym.Kind == parser.SYMBOL_BUILTIN:
+		if arity := builtins[sym.Name]; arity >= 0 && len(call.Args) != arity {
+			diags.Error(cerr.CODE_CALL_ARITY, call.Span, "Builtin '%s' takes %s, but %s given", sym.Name, countNoun(arity, "argument"), countNoun(len(call.Args), "argument"))
+		}
+	case sym.Proto != nil:
+		checkArity(call, "Function", len(sym.Proto.Args), sym.Proto.Span, diags)
+	}
+}
+
+// checkMethodArity checks a method called on a value against the methods
+// it may call.
+func checkMethodArity(call *parser.CallExpr, member *parser.MemberExpr, candidates []*parser.FunctionAST, fields map[string]bool, diags *cerr.Diagnostics) {
+	if len(candidates) == 0 || fields[member.Field] {
+		return
+	}
+	arity := len(candidates[0].Proto.Args) - 1
+	for _, method := range candidates[1:] {
+		if len(method.Proto.Args)-1 != arity {
+			return
+		}
+	}
+	if len(call.Args) == arity {
+		return
+	}
+
+	diag := diags.Error(cerr.CODE_CALL_ARITY, call.Span, "Method '%s' takes %s, but %s given", member.Field, countNoun(arity, "argument"), countNoun(len(call.Args), "argument"))
+	for _, method := range candidates {
+		diag.WithLabel(method.Proto.Span, "defined here")
+	}
+	diag.WithNote("self is passed by calling the method on a value and not counted")
+}
+
+func checkArity(call *parser.CallExpr, what string, arity int, defined cerr.Span, diags *cerr.Diagnostics) {
+	if len(call.Args) == arity {
+		return
+	}
+	name := call.CalleeName()
+	if member, ok := call.Callee.(*parser.MemberExpr); ok {
+		name = member.Field
+	}
+	subject := what
+	if name != "" {
+		subject += " '" + name + "'"
+	}
+	diags.Error(cerr.CODE_CALL_ARITY, call.Span, "%s takes %s, but %s given", subject, countNoun(arity, "argument"), countNoun(len(call.Args), "argument")).
+		WithLabel(defined, "defined here")
+}
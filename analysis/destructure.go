@@ -0,0 +1,215 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checkDestructuring checks the patterns of declarations and loops: that the
+// structs and fields they name exist, that no name is bound twice, and that
+// they fit the shape of the value as far as it is known without types.
+func checkDestructuring(prog *parser.Program, structs map[string]*parser.StructAST, diags *cerr.Diagnostics) {
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		switch e := expr.(type) {
+		case *parser.DeclarationExpr:
+			if e.Pattern == nil {
+				return true
+			}
+			before := diags.Len()
+			checkBindingPattern(e.Pattern, structs, make(map[string]*parser.Pattern), diags)
+			if diags.Len() == before {
+				checkShape(e.Pattern, shapeOf(e.Expr), diags)
+			}
+		case *parser.ForeachExpr:
+			if e.Pattern == nil {
+				return true
+			}
+			bindings := make(map[string]*parser.Pattern)
+			if e.KeyName != "" {
+				bindings[e.KeyName] = &parser.Pattern{Kind: parser.PATTERN_BINDING, Name: e.KeyName, Span: e.Span}
+			}
+			before := diags.Len()
+			checkBindingPattern(e.Pattern, structs, bindings, diags)
+			if diags.Len() > before {
+				return true
+			}
+			for _, elem := range elementShapes(e.Array) {
+				checkShape(e.Pattern, elem, diags)
+			}
+		}
+		return true
+	})
+}
+
+// checkBindingPattern checks the structs and fields named in pat, bindings
+// holds the names bound so far, like for checkPattern.
+func checkBindingPattern(pat *parser.Pattern, structs map[string]*parser.StructAST, bindings map[string]*parser.Pattern, diags *cerr.Diagnostics) {
+	switch pat.Kind {
+	case parser.PATTERN_BINDING, parser.PATTERN_REST:
+		if pat.Name == "" {
+			return
+		}
+		if first, ok := bindings[pat.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_BINDING, pat.Span, "'%s' is bound more than once in the same pattern", pat.Name).
+				WithLabel(first.Span, "first bound here")
+			return
+		}
+		bindings[pat.Name] = pat
+	case parser.PATTERN_ARRAY:
+		for _, elem := range pat.Args {
+			checkBindingPattern(elem, structs, bindings, diags)
+		}
+	case parser.PATTERN_STRUCT:
+		st, ok := structs[pat.Struct]
+		if !ok {
+			diags.Error(cerr.CODE_UNKNOWN_STRUCT, pat.Span, "Unknown struct '%s'", pat.Struct)
+		}
+		seen := make(map[string]*parser.FieldPattern)
+		for _, field := range pat.Fields {
+			if first, ok := seen[field.Name]; ok {
+				diags.Error(cerr.CODE_DUPLICATE_FIELD, field.Span, "Field '%s' is matched more than once", field.Name).
+					WithLabel(first.Span, "first matched here")
+				continue
+			}
+			seen[field.Name] = field
+
+			if st != nil && st.Field(field.Name) == nil {
+				diags.Error(cerr.CODE_UNKNOWN_FIELD, field.Span, "Struct '%s' has no field named '%s'", st.Name, field.Name).
+					WithLabel(st.NameSpan, "'%s' declared here", st.Name).
+					WithNote("available fields: %s", fieldNames(st))
+			}
+			checkBindingPattern(field.Pattern, structs, bindings, diags)
+		}
+	}
+}
+
+// shape is what is known of a value without types, from the literal it is
+// or the builtin that made it.
+type shape struct {
+	// what describes the value in messages, "an array" or "a 'Point'".
+	what string
+	span cerr.Span
+	// array is set for arrays, elems holds their elements if their number is
+	// known, elem the shape all of them share if it is.
+	array bool
+	elems []*shape
+	elem  *shape
+	// st is the struct a struct value was made from, fields the shapes of
+	// its fields.
+	st     string
+	fields map[string]*shape
+}
+
+// shapeOf returns the shape of expr, or nil if nothing is known about it.
+func shapeOf(expr parser.Expr) *shape {
+	span := expr.GetSpan()
+	switch e := expr.(type) {
+	case *parser.ArrayExpr:
+		elems := make([]*shape, len(e.Values))
+		for i, value := range e.Values {
+			elems[i] = shapeOf(value)
+		}
+		return &shape{what: "an array", span: span, array: true, elems: elems}
+	case *parser.RangeExpr:
+		return &shape{what: "an array", span: span, array: true, elem: &shape{what: "a number", span: span}}
+	case *parser.StructLiteralExpr:
+		fields := make(map[string]*shape)
+		for _, field := range e.Fields {
+			fields[field.Name] = shapeOf(field.Value)
+		}
+		return &shape{what: "a '" + e.Name + "'", span: span, st: e.Name, fields: fields}
+	case *parser.NumberExpr:
+		return &shape{what: "a number", span: span}
+	case *parser.StringExpr, *parser.InterpolatedStringExpr:
+		return &shape{what: "a string", span: span}
+	case *parser.BooleanExpr:
+		return &shape{what: "a boolean", span: span}
+	case *parser.MapExpr:
+		return &shape{what: "a map", span: span}
+	case *parser.LambdaExpr:
+		return &shape{what: "a function", span: span}
+	case *parser.CallExpr:
+		if e.CalleeName() == "enumerate" {
+			pair := &shape{what: "an array", span: span, array: true, elems: []*shape{{what: "a number", span: span}, nil}}
+			return &shape{what: "an array", span: span, array: true, elem: pair}
+		}
+	}
+	return nil
+}
+
+// elementShapes returns the shapes of the elements a loop over expr visits
+// that are known.
+func elementShapes(expr parser.Expr) []*shape {
+	sh := shapeOf(expr)
+	switch {
+	case sh == nil || !sh.array:
+		return nil
+	case sh.elem != nil:
+		return []*shape{sh.elem}
+	default:
+		return sh.elems
+	}
+}
+
+// checkShape reports where pat can't match a value of shape sh.
+func checkShape(pat *parser.Pattern, sh *shape, diags *cerr.Diagnostics) {
+	if sh == nil {
+		return
+	}
+
+	switch pat.Kind {
+	case parser.PATTERN_ARRAY:
+		if !sh.array {
+			diags.Error(cerr.CODE_PATTERN_SHAPE, pat.Span, "Array pattern can't destructure %s", sh.what).
+				WithLabel(sh.span, "this is %s", sh.what)
+			return
+		}
+
+		n, rest := 0, false
+		for _, elem := range pat.Args {
+			if elem.Kind == parser.PATTERN_REST {
+				rest = true
+			} else {
+				n++
+			}
+		}
+		if sh.elems != nil {
+			if rest && len(sh.elems) < n {
+				diags.Error(cerr.CODE_PATTERN_SHAPE, pat.Span, "Pattern expects at least %s, but the array has %d", countNoun(n, "element"), len(sh.elems)).
+					WithLabel(sh.span, "this array")
+				return
+			}
+			if !rest && len(sh.elems) != n {
+				diags.Error(cerr.CODE_PATTERN_SHAPE, pat.Span, "Pattern expects %s, but the array has %d", countNoun(n, "element"), len(sh.elems)).
+					WithLabel(sh.span, "this array").
+					WithNote("use '..' to ignore the remaining elements")
+				return
+			}
+		}
+
+		for i, elem := range pat.Args {
+			if elem.Kind == parser.PATTERN_REST {
+				break
+			}
+			if sh.elems != nil {
+				checkShape(elem, sh.elems[i], diags)
+			} else {
+				checkShape(elem, sh.elem, diags)
+			}
+		}
+	case parser.PATTERN_STRUCT:
+		if sh.st == "" {
+			diags.Error(cerr.CODE_PATTERN_SHAPE, pat.Span, "Struct pattern can't destructure %s", sh.what).
+				WithLabel(sh.span, "this is %s", sh.what)
+			return
+		}
+		if sh.st != pat.Struct {
+			diags.Error(cerr.CODE_PATTERN_SHAPE, pat.Span, "Pattern destructures a '%s', but the value is %s", pat.Struct, sh.what).
+				WithLabel(sh.span, "this is %s", sh.what)
+			return
+		}
+		for _, field := range pat.Fields {
+			checkShape(field.Pattern, sh.fields[field.Name], diags)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+func declareEnums(prog *parser.Program, structs map[string]*parser.StructAST, diags *cerr.Diagnostics) map[string]*parser.EnumAST {
+	taken := make(map[string]cerr.Span)
+	for _, fn := range prog.Functions {
+		taken[fn.Proto.Name] = fn.Proto.Span
+	}
+	for _, global := range prog.Globals {
+		for _, binding := range global.Bindings() {
+			taken[binding.Name] = binding.Span
+		}
+	}
+	for name, st := range structs {
+		taken[name] = st.NameSpan
+	}
+
+	enums := make(map[string]*parser.EnumAST)
+	for _, enum := range prog.Enums {
+		if first, ok := enums[enum.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_ENUM, enum.NameSpan, "Enum '%s' is defined more than once", enum.Name).
+				WithLabel(first.NameSpan, "first defined here")
+			continue
+		}
+		if first, ok := taken[enum.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_ENUM, enum.NameSpan, "'%s' is defined more than once", enum.Name).
+				WithLabel(first, "first defined here")
+			continue
+		}
+		enums[enum.Name] = enum
+
+		seen := make(map[string]*parser.Variant)
+		for _, variant := range enum.Variants {
+			if first, ok := seen[variant.Name]; ok {
+				diags.Error(cerr.CODE_DUPLICATE_VARIANT, variant.Span, "Variant '%s' is declared more than once in enum '%s'", variant.Name, enum.Name).
+					WithLabel(first.Span, "first declared here")
+				continue
+			}
+			seen[variant.Name] = variant
+		}
+	}
+	return enums
+}
+
+// enumOf returns the enum named by expr, if expr is a plain name.
+func enumOf(expr parser.Expr, enums map[string]*parser.EnumAST) *parser.EnumAST {
+	if name, ok := expr.(*parser.VariableExpr); ok {
+		return enums[name.Name]
+	}
+	return nil
+}
+
+// checkVariants checks the construction of enum values. A variant with
+// fields is called with one argument per field, a variant without is a
+// value and can't be called.
+func checkVariants(prog *parser.Program, enums map[string]*parser.EnumAST, diags *cerr.Diagnostics) {
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		switch e := expr.(type) {
+		case *parser.CallExpr:
+			member := methodOf(e)
+			if member == nil {
+				return true
+			}
+			enum := enumOf(member.Object, enums)
+			if enum == nil {
+				return true
+			}
+			// An unknown variant is reported with the callee.
+			variant := enum.Variant(member.Field)
+			if variant == nil {
+				return true
+			}
+			if len(variant.Fields) == 0 {
+				diags.Error(cerr.CODE_VARIANT_ARITY, e.Span, "Variant '%s.%s' has no fields and can't be called", enum.Name, variant.Name).
+					WithLabel(variant.Span, "declared here").
+					WithNote("use '%s.%s' without parentheses", enum.Name, variant.Name)
+			} else if len(e.Args) != len(variant.Fields) {
+				diags.Error(cerr.CODE_VARIANT_ARITY, e.Span, "Variant '%s.%s' takes %s, but %s given", enum.Name, variant.Name, countNoun(len(variant.Fields), "argument"), countNoun(len(e.Args), "argument")).
+					WithLabel(variant.Span, "declared here")
+			}
+		case *parser.MemberExpr:
+			if enum := enumOf(e.Object, enums); enum != nil {
+				lookupVariant(enum, e.Field, e.FieldSpan, diags)
+			}
+		}
+		return true
+	})
+}
+
+// lookupVariant returns the variant of enum called name, or reports that
+// there is none at span.
+func lookupVariant(enum *parser.EnumAST, name string, span cerr.Span, diags *cerr.Diagnostics) *parser.Variant {
+	variant := enum.Variant(name)
+	if variant == nil {
+		diags.Error(cerr.CODE_UNKNOWN_VARIANT, span, "Enum '%s' has no variant named '%s'", enum.Name, name).
+			WithLabel(enum.NameSpan, "'%s' declared here", enum.Name).
+			WithNote("available variants: %s", variantNames(enum))
+	}
+	return variant
+}
+
+func variantNames(enum *parser.EnumAST) string {
+	if len(enum.Variants) == 0 {
+		return "none"
+	}
+	names := make([]string, len(enum.Variants))
+	for i, variant := range enum.Variants {
+		names[i] = variant.Name
+	}
+	return strings.Join(names, ", ")
+}
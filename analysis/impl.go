@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// declareMethods collects the methods of all impl blocks by struct and
+// method name.
+func declareMethods(prog *parser.Program, structs map[string]*parser.StructAST, diags *cerr.Diagnostics) map[string]map[string]*parser.FunctionAST {
+	methods := make(map[string]map[string]*parser.FunctionAST)
+	for _, impl := range prog.Impls {
+		st, ok := structs[impl.Name]
+		if !ok {
+			diags.Error(cerr.CODE_UNKNOWN_STRUCT, impl.NameSpan, "Unknown struct '%s'", impl.Name)
+			continue
+		}
+
+		if methods[impl.Name] == nil {
+			methods[impl.Name] = make(map[string]*parser.FunctionAST)
+		}
+		for _, method := range impl.Methods {
+			name := method.Proto.Name
+			if first, ok := methods[impl.Name][name]; ok {
+				diags.Error(cerr.CODE_DUPLICATE_METHOD, method.Proto.Span, "Method '%s' of '%s' is defined more than once", name, impl.Name).
+					WithLabel(first.Proto.Span, "first defined here")
+				continue
+			}
+			if field := st.Field(name); field != nil {
+				diags.Error(cerr.CODE_DUPLICATE_METHOD, method.Proto.Span, "Method '%s' has the same name as a field of '%s'", name, impl.Name).
+					WithLabel(field.Span, "field declared here")
+				continue
+			}
+			methods[impl.Name][name] = method
+		}
+	}
+	return methods
+}
+
+// checkMethodCalls reports calls of methods that don't exist. A receiver
+// naming a struct calls a method without self, any other receiver is an
+// untyped value whose call is only known to be wrong when no struct has such
+// a method, or a field that could hold a function.
+func checkMethodCalls(prog *parser.Program, structs map[string]*parser.StructAST, methods map[string]map[string]*parser.FunctionAST, enums map[string]*parser.EnumAST, diags *cerr.Diagnostics) {
+	callable := make(map[string]bool)
+	for name, st := range structs {
+		for _, field := range st.Fields {
+			callable[field.Name] = true
+		}
+		for _, method := range methods[name] {
+			if method.HasSelf() {
+				callable[method.Proto.Name] = true
+			}
+		}
+	}
+
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		call, ok := expr.(*parser.CallExpr)
+		if !ok {
+			return true
+		}
+		member := methodOf(call)
+		if member == nil || enumOf(member.Object, enums) != nil {
+			return true
+		}
+
+		if receiver, ok := member.Object.(*parser.VariableExpr); ok && structs[receiver.Name] != nil {
+			method := methods[receiver.Name][member.Field]
+			if method == nil {
+				diags.Error(cerr.CODE_UNKNOWN_METHOD, call.Span, "Struct '%s' has no method named '%s'", receiver.Name, member.Field)
+			} else if method.HasSelf() {
+				diags.Error(cerr.CODE_UNKNOWN_METHOD, call.Span, "Method '%s' of '%s' takes self and must be called on a value", member.Field, receiver.Name).
+					WithLabel(method.Proto.Span, "defined here")
+			}
+			return true
+		}
+
+		if !callable[member.Field] {
+			diags.Error(cerr.CODE_UNKNOWN_METHOD, call.Span, "No struct has a method named '%s'", member.Field)
+		}
+		return true
+	})
+}
+
+// methodOf returns the member a method call calls, or nil if call is no
+// method call.
+func methodOf(call *parser.CallExpr) *parser.MemberExpr {
+	member, _ := call.Callee.(*parser.MemberExpr)
+	return member
+}
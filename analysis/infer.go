@@ -0,0 +1,339 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// The types that are not annotated are inferred by unification: an
+// unannotated parameter or result starts as a type variable, and each use of
+// a value constrains its type, `n * 2` makes n a number. The variables still
+// unknown once a function is checked make it generic, each use of it gets
+// its own copy of them. A lambda bound by 'let' is generalized the same way.
+//
+// The uses of a value of unknown type that don't tell its type constrain
+// it instead: indexing it gives a new variable for its elements, accessing a
+// field one for the field. The variable is checked against them once found,
+// so a function taking `xs` and returning `xs[0]` returns the elements of the
+// array it is given.
+//
+// Levels keep the variables of a function apart from the ones of the
+// function it is used in: a variable is created at the current level, and
+// only the ones created while inferring a function, and not unified with an
+// outer one since, are generalized.
+
+// fresh returns a new type variable.
+func (c *checker) fresh() *parser.Type {
+	c.vars++
+	return parser.NewTypeVar(c.vars, c.level)
+}
+
+// unify makes a and b the same type, binding the type variables they
+// contain, and reports whether they fit. A value of type any fits every
+// type, a variable unified with any becomes any. A variable remembers span,
+// the expression that bound it, to explain later conflicts.
+func (c *checker) unify(a, b *parser.Type, span cerr.Span) bool {
+	c.recursive = false
+	return c.unifyTypes(a, b, span)
+}
+
+func (c *checker) unifyTypes(a, b *parser.Type, span cerr.Span) bool {
+	a, b = a.Resolve(), b.Resolve()
+	switch {
+	case a == b:
+		return true
+	case a.Kind == parser.TYPE_VAR:
+		return c.bindVar(a, b, span)
+	case b.Kind == parser.TYPE_VAR:
+		return c.bindVar(b, a, span)
+	case c.isAny(a) || c.isAny(b):
+		return true
+	case a.Kind != b.Kind:
+		return false
+	}
+
+	switch a.Kind {
+	case parser.TYPE_ARRAY:
+		return c.unifyTypes(a.Elem, b.Elem, span)
+	case parser.TYPE_MAP:
+		return c.unifyTypes(a.Key, b.Key, span) && c.unifyTypes(a.Elem, b.Elem, span)
+	case parser.TYPE_FUNC:
+		if len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !c.unifyTypes(a.Params[i], b.Params[i], span) {
+				return false
+			}
+		}
+		// The result of a function called for its effect is dropped.
+		ra, rb := a.Result.Resolve(), b.Result.Resolve()
+		if ra.Kind == parser.TYPE_VOID && rb.Kind != parser.TYPE_VAR || rb.Kind == parser.TYPE_VOID && ra.Kind != parser.TYPE_VAR {
+			return true
+		}
+		return c.unifyTypes(ra, rb, span)
+	case parser.TYPE_NAMED:
+		return a.Name == b.Name
+	}
+	return true
+}
+
+// bindVar binds the unbound variable v to typ if typ meets its constraints,
+// another variable takes them over. A variable can't be bound to a type
+// containing it, the type would be infinite.
+func (c *checker) bindVar(v, typ *parser.Type, span cerr.Span) bool {
+	if occurs(v, typ) || typ.Kind == parser.TYPE_VAR && occurs(typ, v) {
+		c.recursive = true
+		return false
+	}
+	if typ.Kind != parser.TYPE_VAR && !c.isAny(typ) && !c.satisfy(v, typ, span) {
+		return false
+	}
+	lower(typ, v.Level)
+	v.Instance = typ
+	v.Span = span
+	if typ.Kind != parser.TYPE_VAR {
+		return true
+	}
+
+	if v.Elem != nil {
+		if _, ok := c.indexed(typ, v.Key, span); !ok || !c.unifyTypes(typ.Elem, v.Elem, span) {
+			return false
+		}
+	}
+	for name, member := range v.Members {
+		if !c.unifyTypes(c.memberOf(typ, name), member, span) {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfy reports whether typ meets the constraints of the variable v.
+func (c *checker) satisfy(v, typ *parser.Type, span cerr.Span) bool {
+	if v.Elem != nil {
+		key, elem, ok := c.elementTypes(typ)
+		if !ok || !c.unifyTypes(v.Key, key, span) || !c.unifyTypes(v.Elem, elem, span) {
+			return false
+		}
+	}
+	for name, member := range v.Members {
+		found := c.memberType(typ, name)
+		if found == nil || !c.unifyTypes(member, found, span) {
+			return false
+		}
+	}
+	return true
+}
+
+// indexed constrains the values of the unknown type v to be indexed by key
+// and returns the type of their elements. It reports whether key fits the
+// keys v is already indexed by.
+func (c *checker) indexed(v, key *parser.Type, span cerr.Span) (*parser.Type, bool) {
+	if v.Elem != nil {
+		return v.Elem, c.unifyTypes(v.Key, key, span)
+	}
+	v.Key, v.Elem = key, c.fresh()
+	lower(v.Key, v.Level)
+	lower(v.Elem, v.Level)
+	return v.Elem, true
+}
+
+// memberOf constrains the values of the unknown type v to have the field or
+// method name and returns its type.
+func (c *checker) memberOf(v *parser.Type, name string) *parser.Type {
+	if member := v.Members[name]; member != nil {
+		return member
+	}
+	if v.Members == nil {
+		v.Members = make(map[string]*parser.Type)
+	}
+	member := c.fresh()
+	lower(member, v.Level)
+	v.Members[name] = member
+	return member
+}
+
+// memberType returns the type of the field or the method name of a value of
+// type typ called on the value, nil if it has none.
+func (c *checker) memberType(typ *parser.Type, name string) *parser.Type {
+	if typ.Kind != parser.TYPE_NAMED || c.structs[typ.Name] == nil {
+		return nil
+	}
+	if field := c.structs[typ.Name].Field(name); field != nil {
+		return declared(field.Type)
+	}
+	if method := c.methods[typ.Name][name]; method != nil && method.HasSelf() {
+		return withoutSelf(c.instantiate(c.signature(method.Proto)))
+	}
+	return nil
+}
+
+func occurs(v, typ *parser.Type) bool {
+	found := false
+	walkVars(typ, func(w *parser.Type) {
+		found = found || w == v
+	})
+	return found
+}
+
+// lower moves the variables of typ to level if they are deeper, they are
+// now shared with a variable of that level.
+func lower(typ *parser.Type, level int) {
+	walkVars(typ, func(v *parser.Type) {
+		if v.Level > level {
+			v.Level = level
+		}
+	})
+}
+
+// generalize marks the variables of typ created deeper than the current
+// level as generic.
+func (c *checker) generalize(typ *parser.Type) {
+	walkVars(typ, func(v *parser.Type) {
+		if v.Level > c.level {
+			v.Generic = true
+		}
+	})
+}
+
+// instantiate returns typ with new variables for its generic ones, typ
+// itself if it has none.
+func (c *checker) instantiate(typ *parser.Type) *parser.Type {
+	return c.copyGeneric(typ, make(map[*parser.Type]*parser.Type))
+}
+
+func (c *checker) copyGeneric(typ *parser.Type, vars map[*parser.Type]*parser.Type) *parser.Type {
+	generic := false
+	walkVars(typ, func(v *parser.Type) {
+		generic = generic || v.Generic
+	})
+	if !generic {
+		return typ
+	}
+	typ = typ.Resolve()
+
+	if typ.Kind == parser.TYPE_VAR {
+		if !typ.Generic {
+			return typ
+		}
+		if vars[typ] == nil {
+			v := c.fresh()
+			v.Span = typ.Span
+			vars[typ] = v
+			if typ.Elem != nil {
+				v.Key, v.Elem = c.copyGeneric(typ.Key, vars), c.copyGeneric(typ.Elem, vars)
+			}
+			for name, member := range typ.Members {
+				if v.Members == nil {
+					v.Members = make(map[string]*parser.Type)
+				}
+				v.Members[name] = c.copyGeneric(member, vars)
+			}
+		}
+		return vars[typ]
+	}
+	cp := *typ
+	switch typ.Kind {
+	case parser.TYPE_ARRAY:
+		cp.Elem = c.copyGeneric(typ.Elem, vars)
+	case parser.TYPE_MAP:
+		cp.Key = c.copyGeneric(typ.Key, vars)
+		cp.Elem = c.copyGeneric(typ.Elem, vars)
+	case parser.TYPE_FUNC:
+		cp.Params = make([]*parser.Type, len(typ.Params))
+		for i, param := range typ.Params {
+			cp.Params[i] = c.copyGeneric(param, vars)
+		}
+		cp.Result = c.copyGeneric(typ.Result, vars)
+	}
+	return &cp
+}
+
+// walkVars calls visit with each unbound variable of typ, and of their
+// constraints.
+func walkVars(typ *parser.Type, visit func(*parser.Type)) {
+	if typ == nil {
+		return
+	}
+	typ = typ.Resolve()
+	switch typ.Kind {
+	case parser.TYPE_VAR:
+		visit(typ)
+		walkVars(typ.Key, visit)
+		walkVars(typ.Elem, visit)
+		for _, member := range typ.Members {
+			walkVars(member, visit)
+		}
+	case parser.TYPE_ARRAY:
+		walkVars(typ.Elem, visit)
+	case parser.TYPE_MAP:
+		walkVars(typ.Key, visit)
+		walkVars(typ.Elem, visit)
+	case parser.TYPE_FUNC:
+		for _, param := range typ.Params {
+			walkVars(param, visit)
+		}
+		walkVars(typ.Result, visit)
+	}
+}
+
+// inferredAt returns where the variable typ was bound, nothing if typ is no
+// bound variable.
+func inferredAt(typ *parser.Type) cerr.Span {
+	if typ.Kind == parser.TYPE_VAR && typ.Instance != nil {
+		return typ.Span
+	}
+	return cerr.Span{}
+}
+
+// conflict reports a value of type got found at span where a value of type
+// want is expected, both labelled with where they come from. The span of a
+// type is where it was written or found, the one of a bound variable where
+// it was bound.
+func (c *checker) conflict(span cerr.Span, want, got *parser.Type) {
+	names := parser.FormatTypes(want, got)
+	diag := c.diags.Error(cerr.CODE_TYPE_MISMATCH, span, "Mismatched types: expected '%s', found '%s'", names[0], names[1])
+	wantAt := want.Span
+	if wantAt != (cerr.Span{}) && wantAt != span {
+		diag.WithLabel(wantAt, "expected '%s' because of this", names[0])
+	}
+	if gotAt := inferredAt(got); gotAt != (cerr.Span{}) && gotAt != span && gotAt != wantAt {
+		diag.WithLabel(gotAt, "'%s' is inferred from this", names[1])
+	}
+	if c.recursive {
+		diag.WithNote("a value can't contain itself, its type would be infinite")
+	}
+}
+
+// labelType labels the value at span with its type, named name, and with
+// where the type was inferred from.
+func (c *checker) labelType(diag *cerr.Diagnostic, span cerr.Span, typ *parser.Type, name string) {
+	diag.WithLabel(span, "this is '%s'", name)
+	if at := inferredAt(typ); at != (cerr.Span{}) && at != span {
+		diag.WithLabel(at, "'%s' is inferred from this", name)
+	}
+}
+
+// Signatures lists the types of the functions and methods of a checked
+// program, one per line, `fact: func(number) -> number`.
+func Signatures(prog *parser.Program) string {
+	var sb strings.Builder
+	line := func(name string, proto *parser.PrototypeAST) {
+		if proto.Signature != nil {
+			fmt.Fprintf(&sb, "%s: %s\n", name, proto.Signature)
+		}
+	}
+	for _, fn := range prog.Functions {
+		line(fn.Proto.Name, fn.Proto)
+	}
+	for _, impl := range prog.Impls {
+		for _, method := range impl.Methods {
+			line(impl.Name+"."+method.Proto.Name, method.Proto)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,113 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// enclosing is a loop around a break or continue. A nil loop stands for the
+// arms of a match used as a value, which are emitted as a function that
+// break and continue can't leave.
+type enclosing struct {
+	loop parser.Loop
+}
+
+// checkLoops reports break and continue outside of a loop or naming a label
+// of no enclosing loop, and labels reused by nested loops.
+func checkLoops(prog *parser.Program, diags *cerr.Diagnostics) {
+	for _, global := range prog.Globals {
+		walkLoops(global, nil, diags)
+	}
+	for _, fn := range prog.Functions {
+		walkLoops(fn.Body, nil, diags)
+	}
+	for _, impl := range prog.Impls {
+		for _, method := range impl.Methods {
+			walkLoops(method.Body, nil, diags)
+		}
+	}
+}
+
+// walkLoops checks expr, loops lists the enclosing loops innermost last.
+func walkLoops(expr parser.Expr, loops []enclosing, diags *cerr.Diagnostics) {
+	parser.Inspect(expr, func(expr parser.Expr) bool {
+		switch e := expr.(type) {
+		case *parser.LambdaExpr:
+			walkLoops(e.Body, nil, diags)
+			return false
+		case *parser.MatchExpr:
+			if e.Statement {
+				return true
+			}
+			walkLoops(e.Subject, loops, diags)
+			inner := append(loops[:len(loops):len(loops)], enclosing{})
+			for _, arm := range e.Arms {
+				walkLoops(arm.Guard, inner, diags)
+				walkLoops(arm.Body, inner, diags)
+			}
+			return false
+		case parser.Loop:
+			checkLabel(e, loops, diags)
+			walkLoop(e, append(loops[:len(loops):len(loops)], enclosing{e}), diags)
+			return false
+		case *parser.BreakExpr:
+			checkBranch("break", e.Label, e.Span, loops, diags)
+		case *parser.ContinueExpr:
+			checkBranch("continue", e.Label, e.Span, loops, diags)
+		}
+		return true
+	})
+}
+
+// walkLoop checks the parts of loop, inner includes loop itself.
+func walkLoop(loop parser.Loop, inner []enclosing, diags *cerr.Diagnostics) {
+	outer := inner[:len(inner)-1]
+	switch e := loop.(type) {
+	case *parser.ForExpr:
+		walkLoops(e.Start, outer, diags)
+		walkLoops(e.End, outer, diags)
+		walkLoops(e.Step, outer, diags)
+		walkLoops(e.Body, inner, diags)
+	case *parser.ForeachExpr:
+		walkLoops(e.Array, outer, diags)
+		walkLoops(e.Body, inner, diags)
+	case *parser.WhileExpr:
+		walkLoops(e.Cond, outer, diags)
+		walkLoops(e.Body, inner, diags)
+	}
+}
+
+func checkLabel(loop parser.Loop, loops []enclosing, diags *cerr.Diagnostics) {
+	label := loop.GetLabel()
+	if label.Label == "" {
+		return
+	}
+	for _, outer := range loops {
+		if outer.loop != nil && outer.loop.GetLabel().Label == label.Label {
+			diags.Error(cerr.CODE_DUPLICATE_LABEL, label.LabelSpan, "Label '%s' is already used by an enclosing loop", label.Label).
+				WithLabel(outer.loop.GetLabel().LabelSpan, "first used here")
+			return
+		}
+	}
+}
+
+// checkBranch checks a break or continue, keyword names which one.
+func checkBranch(keyword, label string, span cerr.Span, loops []enclosing, diags *cerr.Diagnostics) {
+	for i := len(loops) - 1; i >= 0; i-- {
+		loop := loops[i].loop
+		if loop == nil {
+			diags.Error(cerr.CODE_BREAK_OUTSIDE_LOOP, span, "'%s' can't leave a match that produces a value", keyword).
+				WithNote("write the match as a statement to use '%s' in its arms", keyword)
+			return
+		}
+		if label == "" || loop.GetLabel().Label == label {
+			return
+		}
+	}
+
+	if label != "" {
+		diags.Error(cerr.CODE_UNKNOWN_LABEL, span, "No enclosing loop is labeled '%s'", label)
+		return
+	}
+	diags.Error(cerr.CODE_BREAK_OUTSIDE_LOOP, span, "'%s' outside of a loop", keyword)
+}
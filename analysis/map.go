@@ -0,0 +1,34 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checkMaps reports map literals that give the same literal key twice, the
+// later entry would silently replace the earlier one. Computed keys are only
+// known at run time and are not checked.
+func checkMaps(prog *parser.Program, diags *cerr.Diagnostics) {
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		m, ok := expr.(*parser.MapExpr)
+		if !ok {
+			return true
+		}
+		seen := make(map[string]*parser.MapEntry)
+		for _, entry := range m.Entries {
+			switch entry.Key.(type) {
+			case *parser.NumberExpr, *parser.StringExpr, *parser.BooleanExpr:
+			default:
+				continue
+			}
+			key := entry.Key.Codegen()
+			if first, ok := seen[key]; ok {
+				diags.Error(cerr.CODE_DUPLICATE_KEY, entry.Key.GetSpan(), "Key %s is given more than once in map literal", key).
+					WithLabel(first.Key.GetSpan(), "first given here")
+				continue
+			}
+			seen[key] = entry
+		}
+		return true
+	})
+}
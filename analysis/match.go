@@ -0,0 +1,357 @@
+package analysis
+
+import (
+	"strings"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checkMatches checks the patterns of every match and that its arms cover
+// every value of the subject.
+func checkMatches(prog *parser.Program, enums map[string]*parser.EnumAST, diags *cerr.Diagnostics) {
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		if match, ok := expr.(*parser.MatchExpr); ok {
+			checkMatch(match, enums, diags)
+		}
+		return true
+	})
+}
+
+func checkMatch(match *parser.MatchExpr, enums map[string]*parser.EnumAST, diags *cerr.Diagnostics) {
+	if !match.Statement {
+		checkReturns(match, diags)
+	}
+
+	before := diags.Len()
+	patterns := make([]*parser.Pattern, len(match.Arms))
+	for i, arm := range match.Arms {
+		checkPattern(arm.Pattern, enums, make(map[string]*parser.Pattern), diags)
+		patterns[i] = arm.Pattern
+	}
+	checkColumn(patterns, diags)
+	// Exhaustiveness makes no sense of patterns that are wrong already.
+	if diags.Len() > before {
+		return
+	}
+
+	// A guard may not hold, so guarded arms don't cover anything.
+	rows := make([][]*parser.Pattern, 0, len(match.Arms))
+	guarded := false
+	for _, arm := range match.Arms {
+		if arm.Guard != nil {
+			guarded = true
+			continue
+		}
+		rows = append(rows, []*parser.Pattern{arm.Pattern})
+	}
+
+	cases := missingCases(rows, enums)
+	if len(cases) == 0 {
+		return
+	}
+
+	names := make([]string, len(cases))
+	for i, c := range cases {
+		names[i] = c.text
+	}
+	diag := diags.Error(cerr.CODE_NON_EXHAUSTIVE_MATCH, match.Span.To(match.Subject.GetSpan()), "Non-exhaustive match, not covered: %s", strings.Join(names, ", "))
+	for _, c := range cases {
+		if c.variant != nil {
+			diag.WithLabel(c.variant.Span, "'%s' declared here", c.variant.Name)
+		}
+	}
+	if guarded {
+		diag.WithNote("arms with a guard are not counted, add an arm without one or a '_' arm")
+	} else {
+		diag.WithNote("add an arm for each case not covered, or a '_' arm")
+	}
+}
+
+// checkReturns reports return in the arms of a match used as a value, it
+// would only leave the function the match is emitted as.
+func checkReturns(match *parser.MatchExpr, diags *cerr.Diagnostics) {
+	for _, arm := range match.Arms {
+		parser.Inspect(arm.Body, func(expr parser.Expr) bool {
+			switch e := expr.(type) {
+			case *parser.LambdaExpr:
+				return false
+			case *parser.MatchExpr:
+				// A nested match used as a value checks its own arms.
+				return e.Statement
+			case *parser.ReturnExpr:
+				diags.Error(cerr.CODE_RETURN_IN_MATCH_VALUE, e.Span, "'return' can't be used in a match that produces a value").
+					WithNote("write the match as a statement, or return after the match")
+			}
+			return true
+		})
+	}
+}
+
+// checkPattern checks the variants named in pat and that no name is bound
+// twice, bindings holds the names bound so far in the whole pattern.
+func checkPattern(pat *parser.Pattern, enums map[string]*parser.EnumAST, bindings map[string]*parser.Pattern, diags *cerr.Diagnostics) {
+	switch pat.Kind {
+	case parser.PATTERN_BINDING:
+		if first, ok := bindings[pat.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_BINDING, pat.Span, "'%s' is bound more than once in the same pattern", pat.Name).
+				WithLabel(first.Span, "first bound here")
+			return
+		}
+		bindings[pat.Name] = pat
+	case parser.PATTERN_VARIANT:
+		if enum := enums[pat.Enum]; enum == nil {
+			diags.Error(cerr.CODE_UNKNOWN_ENUM, pat.Span, "Unknown enum '%s'", pat.Enum)
+		} else if variant := lookupVariant(enum, pat.Variant, pat.Span, diags); variant != nil && len(pat.Args) != len(variant.Fields) {
+			diags.Error(cerr.CODE_VARIANT_ARITY, pat.Span, "Variant '%s.%s' has %s, but the pattern has %s", enum.Name, variant.Name, countNoun(len(variant.Fields), "field"), countNoun(len(pat.Args), "field")).
+				WithLabel(variant.Span, "declared here")
+		}
+		for _, arg := range pat.Args {
+			checkPattern(arg, enums, bindings, diags)
+		}
+	}
+}
+
+// checkColumn reports patterns at the same position of different arms that
+// match different kinds of values, then checks the fields of the variant
+// patterns the same way.
+func checkColumn(patterns []*parser.Pattern, diags *cerr.Diagnostics) {
+	var first *parser.Pattern
+	for _, pat := range patterns {
+		kind := matchedKind(pat)
+		if kind == "" {
+			continue
+		}
+		if first == nil {
+			first = pat
+			continue
+		}
+		if want := matchedKind(first); kind != want {
+			diags.Error(cerr.CODE_MISMATCHED_PATTERN, pat.Span, "Pattern matches %s, but an earlier pattern matches %s", kind, want).
+				WithLabel(first.Span, "matches %s", want)
+		}
+	}
+
+	keys := make([]string, 0)
+	fields := make(map[string][][]*parser.Pattern)
+	for _, pat := range patterns {
+		if pat.Kind != parser.PATTERN_VARIANT {
+			continue
+		}
+		key := patternKey(pat)
+		if _, ok := fields[key]; !ok {
+			keys = append(keys, key)
+		}
+		columns := fields[key]
+		for i, arg := range pat.Args {
+			if i == len(columns) {
+				columns = append(columns, nil)
+			}
+			columns[i] = append(columns[i], arg)
+		}
+		fields[key] = columns
+	}
+	for _, key := range keys {
+		for _, column := range fields[key] {
+			checkColumn(column, diags)
+		}
+	}
+}
+
+// matchedKind describes the values pat can match, or is empty if pat
+// matches anything.
+func matchedKind(pat *parser.Pattern) string {
+	switch pat.Kind {
+	case parser.PATTERN_VARIANT:
+		return "'" + pat.Enum + "' values"
+	case parser.PATTERN_LITERAL:
+		switch pat.Value.(type) {
+		case *parser.NumberExpr:
+			return "numbers"
+		case *parser.StringExpr:
+			return "strings"
+		case *parser.BooleanExpr:
+			return "booleans"
+		}
+	}
+	return ""
+}
+
+// The exhaustiveness check follows Maranget, "Warnings for pattern
+// matching": a match is exhaustive if no value vector is left that none of
+// its rows matches, and the search for such a vector yields an example of
+// it. Enum variants and booleans have a complete set of constructors, other
+// literals never do and need a wildcard.
+
+// constructor is the head of a value that patterns can tell apart, a
+// variant or a literal.
+type constructor struct {
+	key     string
+	arity   int
+	enum    *parser.EnumAST
+	variant *parser.Variant
+}
+
+func (c constructor) render(args []string) string {
+	if c.variant == nil {
+		return c.key
+	}
+	if len(args) == 0 {
+		return c.key
+	}
+	return c.key + "(" + strings.Join(args, ", ") + ")"
+}
+
+// witness is a value not covered by a match, variant is set if its head is
+// a variant.
+type witness struct {
+	text    string
+	variant *parser.Variant
+}
+
+// missingCases returns the values rows don't cover, one for each missing
+// variant of a match on an enum.
+func missingCases(rows [][]*parser.Pattern, enums map[string]*parser.EnumAST) []witness {
+	ctors := signature(rows, enums)
+	if ctors == nil {
+		if w := missing(rows, 1, enums); w != nil {
+			return []witness{{text: w[0]}}
+		}
+		return nil
+	}
+
+	var cases []witness
+	for _, ctor := range ctors {
+		if w := missing(specialize(rows, ctor), ctor.arity, enums); w != nil {
+			cases = append(cases, witness{text: ctor.render(w), variant: ctor.variant})
+		}
+	}
+	return cases
+}
+
+// missing returns a vector of n values that none of rows matches, or nil if
+// rows cover every vector.
+func missing(rows [][]*parser.Pattern, n int, enums map[string]*parser.EnumAST) []string {
+	if n == 0 {
+		if len(rows) == 0 {
+			return []string{}
+		}
+		return nil
+	}
+
+	heads := make(map[string]bool)
+	for _, row := range rows {
+		if !isWildcard(row[0]) {
+			heads[patternKey(row[0])] = true
+		}
+	}
+
+	ctors := signature(rows, enums)
+	complete := ctors != nil
+	for _, ctor := range ctors {
+		complete = complete && heads[ctor.key]
+	}
+
+	if complete {
+		for _, ctor := range ctors {
+			if w := missing(specialize(rows, ctor), ctor.arity+n-1, enums); w != nil {
+				return append([]string{ctor.render(w[:ctor.arity])}, w[ctor.arity:]...)
+			}
+		}
+		return nil
+	}
+
+	w := missing(defaultRows(rows), n-1, enums)
+	if w == nil {
+		return nil
+	}
+	head := "_"
+	for _, ctor := range ctors {
+		if !heads[ctor.key] {
+			head = ctor.render(wildcardNames(ctor.arity))
+			break
+		}
+	}
+	return append([]string{head}, w...)
+}
+
+// signature returns every constructor of the values in the first column of
+// rows, or nil if they can't all be listed.
+func signature(rows [][]*parser.Pattern, enums map[string]*parser.EnumAST) []constructor {
+	for _, row := range rows {
+		pat := row[0]
+		if pat.Kind == parser.PATTERN_VARIANT {
+			enum := enums[pat.Enum]
+			if enum == nil {
+				return nil
+			}
+			ctors := make([]constructor, len(enum.Variants))
+			for i, variant := range enum.Variants {
+				ctors[i] = constructor{key: enum.Name + "." + variant.Name, arity: len(variant.Fields), enum: enum, variant: variant}
+			}
+			return ctors
+		}
+		if _, ok := pat.Value.(*parser.BooleanExpr); ok {
+			return []constructor{{key: "true"}, {key: "false"}}
+		}
+	}
+	return nil
+}
+
+// specialize keeps the rows that match a value built by ctor, with the head
+// replaced by the patterns of its fields.
+func specialize(rows [][]*parser.Pattern, ctor constructor) [][]*parser.Pattern {
+	res := make([][]*parser.Pattern, 0, len(rows))
+	for _, row := range rows {
+		head := row[0]
+		args := wildcards(ctor.arity)
+		if !isWildcard(head) {
+			if patternKey(head) != ctor.key {
+				continue
+			}
+			copy(args, head.Args)
+		}
+		res = append(res, append(args, row[1:]...))
+	}
+	return res
+}
+
+// defaultRows keeps the rows matching any head, without their head.
+func defaultRows(rows [][]*parser.Pattern) [][]*parser.Pattern {
+	res := make([][]*parser.Pattern, 0, len(rows))
+	for _, row := range rows {
+		if isWildcard(row[0]) {
+			res = append(res, row[1:])
+		}
+	}
+	return res
+}
+
+func patternKey(pat *parser.Pattern) string {
+	if pat.Kind == parser.PATTERN_VARIANT {
+		return pat.Enum + "." + pat.Variant
+	}
+	return pat.Value.Codegen()
+}
+
+func isWildcard(pat *parser.Pattern) bool {
+	return pat.Kind == parser.PATTERN_WILDCARD || pat.Kind == parser.PATTERN_BINDING
+}
+
+var wildcard = &parser.Pattern{Kind: parser.PATTERN_WILDCARD}
+
+func wildcards(n int) []*parser.Pattern {
+	res := make([]*parser.Pattern, n)
+	for i := range res {
+		res[i] = wildcard
+	}
+	return res
+}
+
+func wildcardNames(n int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = "_"
+	}
+	return res
+}
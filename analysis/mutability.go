@@ -0,0 +1,108 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checkAssignments reports assignments to names that can't be assigned. Only
+// 'var' declares a variable that can be. A 'let' or 'const' name is
+// immutable deeply: nothing reached through it can be assigned either, like
+// an element of its array or a field of its struct. Parameters and the names
+// bound by loops and match arms can't be assigned, but the value they refer
+// to can be changed, `self.n += 1`.
+//
+// The check follows names, not values: a value reachable from a 'var' can
+// still be changed through it.
+func checkAssignments(prog *parser.Program, diags *cerr.Diagnostics) {
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		if assign, ok := expr.(*parser.AssignExpr); ok {
+			checkAssignment(assign, diags)
+		}
+		return true
+	})
+}
+
+func checkAssignment(assign *parser.AssignExpr, diags *cerr.Diagnostics) {
+	root, direct := placeRoot(assign.Target)
+	if root == nil || root.Symbol == nil {
+		return
+	}
+	sym := root.Symbol
+	if mutablePlace(sym, direct) {
+		return
+	}
+
+	switch sym.Kind {
+	case parser.SYMBOL_VARIABLE:
+		what := "immutable variable"
+		switch assign.Target.(type) {
+		case *parser.IndexExpr:
+			what = "an element of immutable variable"
+		case *parser.MemberExpr:
+			what = "a field of immutable variable"
+		}
+		diags.Error(cerr.CODE_ASSIGN_IMMUTABLE, assign.Target.GetSpan(), "Cannot assign to %s '%s'", what, sym.Name).
+			WithLabel(sym.Span, "'%s' declared here", sym.Name).
+			WithNote("declare '%s' with 'var' to allow changing it", sym.Name)
+	case parser.SYMBOL_PARAM:
+		diags.Error(cerr.CODE_ASSIGN_IMMUTABLE, assign.Target.GetSpan(), "Cannot assign to parameter '%s'", sym.Name).
+			WithLabel(sym.Span, "parameter declared here").
+			WithNote("copy it into a variable first: var %s2 = %s;", sym.Name, sym.Name)
+	case parser.SYMBOL_BINDING:
+		diags.Error(cerr.CODE_ASSIGN_IMMUTABLE, assign.Target.GetSpan(), "Cannot assign to '%s', it is bound by a pattern", sym.Name).
+			WithLabel(sym.Span, "'%s' bound here", sym.Name).
+			WithNote("copy it into a variable first: var %s2 = %s;", sym.Name, sym.Name)
+	case parser.SYMBOL_BUILTIN:
+		diags.Error(cerr.CODE_ASSIGN_IMMUTABLE, assign.Target.GetSpan(), "Cannot assign to builtin '%s'", sym.Name)
+	default:
+		diags.Error(cerr.CODE_ASSIGN_IMMUTABLE, assign.Target.GetSpan(), "Cannot assign to %s '%s'", symbolNoun(sym), sym.Name).
+			WithLabel(sym.Span, "'%s' declared here", sym.Name)
+	}
+}
+
+// mutablePlace reports whether a place reached from the name sym can be
+// assigned, direct is set if the place is the name itself.
+func mutablePlace(sym *parser.Symbol, direct bool) bool {
+	switch sym.Kind {
+	case parser.SYMBOL_VARIABLE:
+		return sym.Mutable
+	case parser.SYMBOL_PARAM, parser.SYMBOL_BINDING:
+		return !direct
+	default:
+		return false
+	}
+}
+
+// placeRoot returns the variable a place is reached from, direct is set if
+// the place is the variable itself. A place reached from another value, like
+// the result of a call, has no root.
+func placeRoot(place parser.Expr) (root *parser.VariableExpr, direct bool) {
+	direct = true
+	for {
+		switch e := place.(type) {
+		case *parser.VariableExpr:
+			return e, direct
+		case *parser.IndexExpr:
+			place = e.Array
+		case *parser.MemberExpr:
+			place = e.Object
+		default:
+			return nil, false
+		}
+		direct = false
+	}
+}
+
+func symbolNoun(sym *parser.Symbol) string {
+	switch sym.Kind {
+	case parser.SYMBOL_FUNCTION:
+		return "function"
+	case parser.SYMBOL_STRUCT:
+		return "struct"
+	case parser.SYMBOL_ENUM:
+		return "enum"
+	default:
+		return "name"
+	}
+}
@@ -0,0 +1,27 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checkRanges reports ranges without a start or an end anywhere but in a
+// slice, elsewhere there is no length to take the missing bound from.
+func checkRanges(prog *parser.Program, diags *cerr.Diagnostics) {
+	slices := make(map[*parser.RangeExpr]bool)
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		switch e := expr.(type) {
+		case *parser.IndexExpr:
+			if rng, ok := e.Index.(*parser.RangeExpr); ok {
+				slices[rng] = true
+			}
+		case *parser.RangeExpr:
+			if slices[e] || (e.Start != nil && e.End != nil) {
+				return true
+			}
+			diags.Error(cerr.CODE_OPEN_RANGE, e.Span, "A range without a start or an end can only be used to slice").
+				WithNote("write both bounds, like '0..n'")
+		}
+		return true
+	})
+}
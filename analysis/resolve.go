@@ -0,0 +1,373 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// builtins are the functions every program can call with the number of
+// arguments they take, -1 if they take any. See CallExpr.Codegen.
+var builtins = map[string]int{
+	"println":   -1,
+	"len":       1,
+	"keys":      1,
+	"values":    1,
+	"has":       2,
+	"enumerate": 1,
+}
+
+// scope is a lexical scope. Like in JavaScript, the names declared in a
+// block belong to it from its start: pending holds those not declared yet,
+// they shadow the names of outer scopes and using one early is an error.
+type scope struct {
+	parent   *scope
+	names    map[string]*parser.Symbol
+	pending  map[string]*parser.Symbol
+	prepared map[*parser.DeclarationExpr][]*parser.Symbol
+	// function is set on the outermost scope of a function. Its body runs
+	// when the function is called, by then the names pending outside of it
+	// may be declared.
+	function bool
+	// top is set on the scope of the program, whose duplicates are reported
+	// with the declarations, see checkGlobals and declareStructs.
+	top bool
+	// declared holds every symbol declared so far by name, shared by all
+	// scopes, to point at a declaration that is out of scope.
+	declared map[string][]*parser.Symbol
+}
+
+func newScope(parent *scope) *scope {
+	sc := &scope{
+		parent:   parent,
+		names:    make(map[string]*parser.Symbol),
+		pending:  make(map[string]*parser.Symbol),
+		prepared: make(map[*parser.DeclarationExpr][]*parser.Symbol),
+	}
+	if parent != nil {
+		sc.declared = parent.declared
+	} else {
+		sc.declared = make(map[string][]*parser.Symbol)
+	}
+	return sc
+}
+
+// Resolve links every VariableExpr of prog to the declaration of its name,
+// and reports names that are undefined, declared twice in the same scope or
+// used before their declaration.
+func Resolve(prog *parser.Program, diags *cerr.Diagnostics) {
+	universe := newScope(nil)
+	for name := range builtins {
+		universe.names[name] = parser.NewSymbol(name, parser.SYMBOL_BUILTIN, cerr.Span{})
+	}
+
+	// Functions, structs and enums can be used anywhere, globals only after
+	// their declaration.
+	top := newScope(universe)
+	top.top = true
+	for _, fn := range prog.Functions {
+		sym := parser.NewSymbol(fn.Proto.Name, parser.SYMBOL_FUNCTION, fn.Proto.Span)
+		sym.Proto = fn.Proto
+		declare(top, sym, diags)
+	}
+	for _, st := range prog.Structs {
+		declare(top, parser.NewSymbol(st.Name, parser.SYMBOL_STRUCT, st.NameSpan), diags)
+	}
+	for _, enum := range prog.Enums {
+		declare(top, parser.NewSymbol(enum.Name, parser.SYMBOL_ENUM, enum.NameSpan), diags)
+	}
+
+	for _, global := range prog.Globals {
+		prepare(global, top)
+	}
+	for _, global := range prog.Globals {
+		resolveDeclaration(global, top, diags)
+	}
+	for _, fn := range prog.Functions {
+		resolveFunction(fn.Proto, fn.Body, top, diags)
+	}
+	for _, impl := range prog.Impls {
+		for _, method := range impl.Methods {
+			resolveFunction(method.Proto, method.Body, top, diags)
+		}
+	}
+}
+
+func resolve(expr parser.Expr, sc *scope, diags *cerr.Diagnostics) {
+	parser.Inspect(expr, func(expr parser.Expr) bool {
+		switch e := expr.(type) {
+		case *parser.VariableExpr:
+			lookup(e, sc, diags)
+		case *parser.BraceExpr:
+			resolveBlock(e.Exprs, newScope(sc), diags)
+			return false
+		case *parser.DeclarationExpr:
+			resolveDeclaration(e, sc, diags)
+			return false
+		case *parser.LambdaExpr:
+			resolveFunction(e.Proto, e.Body, sc, diags)
+			return false
+		case *parser.ForExpr:
+			resolveFor(e, sc, diags)
+			return false
+		case *parser.ForeachExpr:
+			resolveForeach(e, sc, diags)
+			return false
+		case *parser.MatchExpr:
+			resolve(e.Subject, sc, diags)
+			for _, arm := range e.Arms {
+				resolveArm(arm, sc, diags)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// resolveBlock resolves the statements of a block in sc, the declarations
+// are pending from the start of the block.
+func resolveBlock(exprs []parser.Expr, sc *scope, diags *cerr.Diagnostics) {
+	for _, expr := range exprs {
+		if decl, ok := expr.(*parser.DeclarationExpr); ok {
+			prepare(decl, sc)
+		}
+	}
+	for _, expr := range exprs {
+		resolve(expr, sc, diags)
+	}
+}
+
+// resolveBody resolves a body that shares sc with the names bound before it,
+// like the parameters of a function.
+func resolveBody(body parser.Expr, sc *scope, diags *cerr.Diagnostics) {
+	if block, ok := body.(*parser.BraceExpr); ok {
+		resolveBlock(block.Exprs, sc, diags)
+	} else {
+		resolve(body, sc, diags)
+	}
+}
+
+func resolveFunction(proto *parser.PrototypeAST, body parser.Expr, parent *scope, diags *cerr.Diagnostics) {
+	sc := newScope(parent)
+	sc.function = true
+	for _, arg := range proto.Args {
+		arg.Symbol = parser.NewSymbol(arg.Name, parser.SYMBOL_PARAM, arg.Span)
+		declare(sc, arg.Symbol, diags)
+	}
+	resolveBody(body, sc, diags)
+}
+
+// resolveFor resolves `for var i = start; end; step {}`, i is declared after
+// start like any variable.
+func resolveFor(loop *parser.ForExpr, parent *scope, diags *cerr.Diagnostics) {
+	sc := newScope(parent)
+	if loop.VarName != "" {
+		sym := parser.NewSymbol(loop.VarName, parser.SYMBOL_VARIABLE, loop.VarSpan)
+		sym.Mutable = true
+		loop.VarSymbol = sym
+		sc.pending[sym.Name] = sym
+		resolve(loop.Start, sc, diags)
+		declare(sc, sym, diags)
+	}
+	resolve(loop.End, sc, diags)
+	resolve(loop.Step, sc, diags)
+	resolve(loop.Body, sc, diags)
+}
+
+// resolveForeach resolves a loop over the elements of a value. The loop
+// variables are pending while the value is evaluated, `for x in x` is an
+// error in JavaScript too.
+func resolveForeach(loop *parser.ForeachExpr, parent *scope, diags *cerr.Diagnostics) {
+	var syms []*parser.Symbol
+	if loop.Pattern != nil {
+		syms = patternSymbols(loop.Pattern, parser.SYMBOL_BINDING, false)
+	} else {
+		loop.VarSymbol = parser.NewSymbol(loop.VarName, parser.SYMBOL_BINDING, loop.VarSpan)
+		syms = []*parser.Symbol{loop.VarSymbol}
+	}
+	if loop.KeyName != "" {
+		key := parser.NewSymbol(loop.KeyName, parser.SYMBOL_BINDING, loop.KeySpan)
+		loop.KeySymbol = key
+		syms = append([]*parser.Symbol{key}, syms...)
+	}
+
+	sc := newScope(parent)
+	for _, sym := range syms {
+		if _, ok := sc.pending[sym.Name]; !ok {
+			sc.pending[sym.Name] = sym
+		}
+	}
+	resolve(loop.Array, sc, diags)
+	for _, sym := range syms {
+		// The key bound again by the pattern is reported with the pattern,
+		// see checkDestructuring.
+		if loop.Pattern != nil && sc.names[sym.Name] != nil {
+			continue
+		}
+		declare(sc, sym, diags)
+	}
+	resolve(loop.Body, sc, diags)
+}
+
+// resolveArm resolves a match arm, its bindings share a scope with its body.
+func resolveArm(arm *parser.MatchArm, parent *scope, diags *cerr.Diagnostics) {
+	sc := newScope(parent)
+	for _, sym := range patternSymbols(arm.Pattern, parser.SYMBOL_BINDING, false) {
+		declare(sc, sym, diags)
+	}
+	resolve(arm.Guard, sc, diags)
+	resolveBody(arm.Body, sc, diags)
+}
+
+// prepare makes the names declared by decl pending in sc.
+func prepare(decl *parser.DeclarationExpr, sc *scope) {
+	syms := declarationSymbols(decl)
+	sc.prepared[decl] = syms
+	for _, sym := range syms {
+		if _, ok := sc.pending[sym.Name]; !ok {
+			sc.pending[sym.Name] = sym
+		}
+	}
+}
+
+func resolveDeclaration(decl *parser.DeclarationExpr, sc *scope, diags *cerr.Diagnostics) {
+	resolve(decl.Expr, sc, diags)
+
+	syms, ok := sc.prepared[decl]
+	if !ok {
+		syms = declarationSymbols(decl)
+	}
+	for _, sym := range syms {
+		declare(sc, sym, diags)
+	}
+}
+
+func declarationSymbols(decl *parser.DeclarationExpr) []*parser.Symbol {
+	if decl.Pattern != nil {
+		return patternSymbols(decl.Pattern, parser.SYMBOL_VARIABLE, decl.Mutable)
+	}
+	sym := parser.NewSymbol(decl.VarName, parser.SYMBOL_VARIABLE, decl.NameSpan)
+	sym.Mutable = decl.Mutable
+	decl.Symbol = sym
+	// An immutable name keeps the function it is declared with.
+	if lambda, ok := decl.Expr.(*parser.LambdaExpr); ok && !decl.Mutable {
+		sym.Proto = lambda.Proto
+	}
+	return []*parser.Symbol{sym}
+}
+
+// patternSymbols returns a symbol for each name bound by pat. A name bound
+// twice is reported with the pattern, see checkPattern, and declared once.
+func patternSymbols(pat *parser.Pattern, kind parser.SymbolKind, mutable bool) []*parser.Symbol {
+	var syms []*parser.Symbol
+	seen := make(map[string]bool)
+	for _, binding := range pat.Bindings() {
+		if seen[binding.Name] {
+			continue
+		}
+		seen[binding.Name] = true
+		sym := parser.NewSymbol(binding.Name, kind, binding.Span)
+		sym.Mutable = mutable
+		binding.Symbol = sym
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+func declare(sc *scope, sym *parser.Symbol, diags *cerr.Diagnostics) {
+	sc.declared[sym.Name] = append(sc.declared[sym.Name], sym)
+	if first, ok := sc.names[sym.Name]; ok {
+		if !sc.top {
+			diags.Error(cerr.CODE_DUPLICATE_DECLARATION, sym.Span, "'%s' is already declared in this scope", sym.Name).
+				WithLabel(first.Span, "first declared here").
+				WithNote("use another name, or assign to '%s' if it is declared with 'var'", sym.Name)
+		}
+		return
+	}
+	sc.names[sym.Name] = sym
+	if sc.pending[sym.Name] == sym {
+		delete(sc.pending, sym.Name)
+	}
+}
+
+// lookup links v to the declaration of its name visible in sc.
+func lookup(v *parser.VariableExpr, sc *scope, diags *cerr.Diagnostics) {
+	crossed := false
+	for s := sc; s != nil; s = s.parent {
+		if sym, ok := s.names[v.Name]; ok {
+			v.Symbol = sym
+			return
+		}
+		if sym, ok := s.pending[v.Name]; ok {
+			v.Symbol = sym
+			// A function called later sees the name declared.
+			if !crossed {
+				diags.Error(cerr.CODE_USE_BEFORE_DECLARATION, v.Span, "'%s' is used before its declaration", v.Name).
+					WithLabel(sym.Span, "'%s' declared here", v.Name)
+			}
+			return
+		}
+		crossed = crossed || s.function
+	}
+
+	diag := diags.Error(cerr.CODE_UNDEFINED_NAME, v.Span, "Undefined name '%s'", v.Name)
+	if others := sc.declared[v.Name]; len(others) > 0 {
+		diag.WithLabel(others[0].Span, "'%s' is declared here, but not in scope", v.Name)
+	} else if similar := similarName(v.Name, sc); similar != nil {
+		if similar.Kind == parser.SYMBOL_BUILTIN {
+			diag.WithNote("a builtin with a similar name exists: '%s'", similar.Name)
+		} else {
+			diag.WithLabel(similar.Span, "a similar name is declared here: '%s'", similar.Name)
+		}
+	}
+}
+
+// similarName returns the name visible in sc closest to name, if it is
+// close enough to be a typo.
+func similarName(name string, sc *scope) *parser.Symbol {
+	var candidates []*parser.Symbol
+	for s := sc; s != nil; s = s.parent {
+		for _, sym := range s.names {
+			candidates = append(candidates, sym)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Name < candidates[j].Name })
+
+	for _, sym := range candidates {
+		if strings.EqualFold(name, sym.Name) {
+			return sym
+		}
+	}
+
+	var best *parser.Symbol
+	bestDist := len(name)/3 + 1
+	for _, sym := range candidates {
+		if d := editDistance(name, sym.Name); d < bestDist {
+			best, bestDist = sym, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
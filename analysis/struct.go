@@ -0,0 +1,141 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checkStructs checks struct declarations, struct literals and field
+// accesses. The type of a value may be unknown, so a field access is only
+// known to be wrong here when no struct declares that field, see
+// checker.member for values known to be structs.
+func checkStructs(prog *parser.Program, structs map[string]*parser.StructAST, enums map[string]*parser.EnumAST, diags *cerr.Diagnostics) {
+	fields := make(map[string]bool)
+	for _, st := range structs {
+		for _, field := range st.Fields {
+			fields[field.Name] = true
+		}
+	}
+
+	// Called members are methods, see checkMethodCalls. A call is visited
+	// before its callee.
+	methods := make(map[*parser.MemberExpr]bool)
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		switch e := expr.(type) {
+		case *parser.StructLiteralExpr:
+			checkStructLiteral(e, structs, diags)
+		case *parser.CallExpr:
+			if member := methodOf(e); member != nil {
+				methods[member] = true
+			}
+		case *parser.MemberExpr:
+			if !fields[e.Field] && !methods[e] && enumOf(e.Object, enums) == nil {
+				diags.Error(cerr.CODE_UNKNOWN_FIELD, e.FieldSpan, "No struct has a field named '%s'", e.Field)
+			}
+		}
+		return true
+	})
+}
+
+func declareStructs(prog *parser.Program, diags *cerr.Diagnostics) map[string]*parser.StructAST {
+	taken := make(map[string]cerr.Span)
+	for _, fn := range prog.Functions {
+		taken[fn.Proto.Name] = fn.Proto.Span
+	}
+	for _, global := range prog.Globals {
+		for _, binding := range global.Bindings() {
+			taken[binding.Name] = binding.Span
+		}
+	}
+
+	structs := make(map[string]*parser.StructAST)
+	for _, st := range prog.Structs {
+		if first, ok := structs[st.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_STRUCT, st.NameSpan, "Struct '%s' is defined more than once", st.Name).
+				WithLabel(first.NameSpan, "first defined here")
+			continue
+		}
+		if first, ok := taken[st.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_STRUCT, st.NameSpan, "'%s' is defined more than once", st.Name).
+				WithLabel(first, "first defined here")
+			continue
+		}
+		structs[st.Name] = st
+
+		seen := make(map[string]*parser.StructField)
+		for _, field := range st.Fields {
+			if first, ok := seen[field.Name]; ok {
+				diags.Error(cerr.CODE_DUPLICATE_FIELD, field.Span, "Field '%s' is declared more than once in struct '%s'", field.Name, st.Name).
+					WithLabel(first.Span, "first declared here")
+				continue
+			}
+			seen[field.Name] = field
+		}
+	}
+	return structs
+}
+
+func checkStructLiteral(lit *parser.StructLiteralExpr, structs map[string]*parser.StructAST, diags *cerr.Diagnostics) {
+	st, ok := structs[lit.Name]
+	if !ok {
+		diags.Error(cerr.CODE_UNKNOWN_STRUCT, lit.Span, "Unknown struct '%s'", lit.Name)
+		return
+	}
+
+	seen := make(map[string]*parser.FieldInit)
+	for _, field := range lit.Fields {
+		if first, ok := seen[field.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_FIELD, field.Span, "Field '%s' is set more than once", field.Name).
+				WithLabel(first.Span, "first set here")
+			continue
+		}
+		seen[field.Name] = field
+
+		if st.Field(field.Name) == nil {
+			diags.Error(cerr.CODE_UNKNOWN_FIELD, field.Span, "Struct '%s' has no field named '%s'", st.Name, field.Name).
+				WithLabel(st.NameSpan, "'%s' declared here", st.Name).
+				WithNote("available fields: %s", fieldNames(st))
+		}
+	}
+
+	var missing []string
+	for _, field := range st.Fields {
+		if _, ok := seen[field.Name]; !ok {
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		diags.Error(cerr.CODE_MISSING_FIELD, lit.Span, "Missing %s in struct literal of '%s'", quoteList("field", missing), st.Name).
+			WithLabel(st.NameSpan, "'%s' declared here", st.Name)
+	}
+}
+
+func fieldNames(st *parser.StructAST) string {
+	if len(st.Fields) == 0 {
+		return "none"
+	}
+	names := make([]string, len(st.Fields))
+	for i, field := range st.Fields {
+		names[i] = field.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// quoteList renders names as "field 'a'" or "fields 'a', 'b'".
+func quoteList(noun string, names []string) string {
+	if len(names) > 1 {
+		noun += "s"
+	}
+	return noun + " '" + strings.Join(names, "', '") + "'"
+}
+
+// countNoun renders n and noun as "1 field" or "2 fields".
+func countNoun(n int, noun string) string {
+	if n != 1 {
+		noun += "s"
+	}
+	return fmt.Sprintf("%d %s", n, noun)
+}
@@ -0,0 +1,887 @@
+package analysis
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// checker finds the type of every expression of a program and reports the
+// operations whose operands have the wrong type. Annotations are optional,
+// the types of unannotated parameters and results are inferred from their
+// uses, see infer.go. Unannotated variables take the type of their
+// initializer. A value of type any fits everywhere.
+type checker struct {
+	structs map[string]*parser.StructAST
+	enums   map[string]*parser.EnumAST
+	methods map[string]map[string]*parser.FunctionAST
+	diags   *cerr.Diagnostics
+	// fields and callable hold the member names some struct declares, the
+	// others are reported by checkStructs and checkMethodCalls.
+	fields   map[string]bool
+	callable map[string]bool
+	// functions holds the top-level functions and methods, inferred when
+	// first used, see signature.
+	functions map[*parser.PrototypeAST]*function
+	// result is the return type of the function being checked, returns is
+	// set once it returns a value.
+	result  *parser.Type
+	returns bool
+	// level is the number of functions and generic lets being inferred, vars
+	// the number of type variables created. recursive is set if the last
+	// unification failed on a type containing itself.
+	level     int
+	vars      int
+	recursive bool
+}
+
+// function is a function whose type is inferred, self is the type of a
+// method's receiver.
+type function struct {
+	body parser.Expr
+	self *parser.Type
+}
+
+// checkTypes stores the type of each expression of prog on it, and the type
+// of each declared name on its symbol.
+func checkTypes(prog *parser.Program, structs map[string]*parser.StructAST, methods map[string]map[string]*parser.FunctionAST, enums map[string]*parser.EnumAST, diags *cerr.Diagnostics) {
+	c := &checker{structs: structs, enums: enums, methods: methods, diags: diags}
+	c.functions = make(map[*parser.PrototypeAST]*function)
+	c.fields = make(map[string]bool)
+	c.callable = make(map[string]bool)
+	for name, st := range structs {
+		for _, field := range st.Fields {
+			c.fields[field.Name] = true
+			c.callable[field.Name] = true
+		}
+		for _, method := range methods[name] {
+			if method.HasSelf() {
+				c.callable[method.Proto.Name] = true
+			}
+		}
+	}
+
+	for _, st := range prog.Structs {
+		for _, field := range st.Fields {
+			c.validate(field.Type)
+		}
+	}
+	for _, fn := range prog.Functions {
+		c.validateProto(fn.Proto)
+		c.functions[fn.Proto] = &function{body: fn.Body}
+	}
+	for _, impl := range prog.Impls {
+		for _, method := range impl.Methods {
+			c.validateProto(method.Proto)
+			c.functions[method.Proto] = &function{body: method.Body, self: parser.NewNamedType(impl.Name)}
+		}
+	}
+
+	for _, global := range prog.Globals {
+		c.check(global)
+	}
+	for _, fn := range prog.Functions {
+		c.signature(fn.Proto)
+	}
+	for _, impl := range prog.Impls {
+		for _, method := range impl.Methods {
+			c.signature(method.Proto)
+		}
+	}
+}
+
+// validate reports the names in an annotation that are no struct or enum.
+func (c *checker) validate(typ *parser.Type) {
+	if typ == nil {
+		return
+	}
+	switch typ.Kind {
+	case parser.TYPE_NAMED:
+		if c.structs[typ.Name] == nil && c.enums[typ.Name] == nil {
+			c.diags.Error(cerr.CODE_UNKNOWN_TYPE, typ.Span, "Unknown type '%s'", typ.Name).
+				WithNote("types are any, number, int, float, string, bool, void, structs and enums")
+		}
+	case parser.TYPE_ARRAY:
+		c.validate(typ.Elem)
+	case parser.TYPE_MAP:
+		c.validate(typ.Key)
+		c.validate(typ.Elem)
+	case parser.TYPE_FUNC:
+		for _, param := range typ.Params {
+			c.validate(param)
+		}
+		c.validate(typ.Result)
+	}
+}
+
+func (c *checker) validateProto(proto *parser.PrototypeAST) {
+	for _, arg := range proto.Args {
+		c.validate(arg.Type)
+	}
+	c.validate(proto.Result)
+}
+
+// signature returns the type of the top-level function or method declared
+// by proto, inferring it from its body the first time. Uses made while it is
+// inferred, recursive calls, share its type variables.
+func (c *checker) signature(proto *parser.PrototypeAST) *parser.Type {
+	if proto.Signature != nil {
+		return proto.Signature
+	}
+	fn := c.functions[proto]
+	if fn == nil {
+		return parser.NewType(parser.TYPE_ANY)
+	}
+
+	c.level++
+	typ := c.protoType(proto, fn.self)
+	proto.Signature = typ
+	c.checkBody(proto, typ, fn.body)
+	c.level--
+	c.generalize(typ)
+	return typ
+}
+
+// protoType returns the type of the function declared by proto and sets the
+// types of its parameters. Unannotated parameters and results are type
+// variables, self is the type of a method's receiver.
+func (c *checker) protoType(proto *parser.PrototypeAST, self *parser.Type) *parser.Type {
+	params := make([]*parser.Type, len(proto.Args))
+	for i, arg := range proto.Args {
+		typ := arg.Type
+		switch {
+		case i == 0 && self != nil && arg.Name == "self":
+			typ = self
+		case typ == nil:
+			typ = c.fresh()
+		}
+		params[i] = typ
+		if arg.Symbol != nil {
+			arg.Symbol.Type = typ
+		}
+	}
+
+	result := proto.Result
+	if result == nil {
+		result = c.fresh()
+	}
+	return parser.NewFuncType(params, result)
+}
+
+// checkBody checks the body of a function of type typ. A function that
+// returns no value returns void.
+func (c *checker) checkBody(proto *parser.PrototypeAST, typ *parser.Type, body parser.Expr) {
+	saved, savedReturns := c.result, c.returns
+	c.result, c.returns = typ.Result, false
+	c.check(body)
+	if !c.returns && typ.Result.Resolve().Kind == parser.TYPE_VAR {
+		void := parser.NewType(parser.TYPE_VOID)
+		c.unify(typ.Result, void, proto.Span)
+	}
+	c.result, c.returns = saved, savedReturns
+}
+
+// declared returns the annotated type, any if there is no annotation.
+func declared(typ *parser.Type) *parser.Type {
+	if typ == nil {
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	return typ
+}
+
+// withoutSelf returns the type of a method called on a value.
+func withoutSelf(typ *parser.Type) *parser.Type {
+	if typ.Kind != parser.TYPE_FUNC || len(typ.Params) == 0 {
+		return typ
+	}
+	return parser.NewFuncType(typ.Params[1:], typ.Result)
+}
+
+// isAny reports whether any value fits typ. A name that is no struct or
+// enum was reported by validate and is any from then on.
+func (c *checker) isAny(typ *parser.Type) bool {
+	typ = typ.Resolve()
+	if typ.Kind == parser.TYPE_NAMED {
+		return c.structs[typ.Name] == nil && c.enums[typ.Name] == nil
+	}
+	return typ.Kind == parser.TYPE_ANY
+}
+
+// is reports whether typ is of kind or any.
+func (c *checker) is(typ *parser.Type, kind parser.TypeKind) bool {
+	return typ.Resolve().Kind == kind || c.isAny(typ)
+}
+
+// expect checks that expr fits want. The elements of an array or map
+// literal are checked one by one, so the one that doesn't fit is reported.
+func (c *checker) expect(expr parser.Expr, want *parser.Type) *parser.Type {
+	if want != nil {
+		if typ := c.literal(expr, want.Resolve()); typ != nil {
+			return typ
+		}
+	}
+	got := c.check(expr)
+	if want != nil && !c.unify(want, got, expr.GetSpan()) {
+		c.conflict(expr.GetSpan(), want, got)
+	}
+	return got
+}
+
+// literal checks the elements of an array or map literal against the
+// element types of want, nil if expr is no such literal or want no such
+// type.
+func (c *checker) literal(expr parser.Expr, want *parser.Type) *parser.Type {
+	var typ *parser.Type
+	switch e := expr.(type) {
+	case *parser.ArrayExpr:
+		if want.Kind != parser.TYPE_ARRAY {
+			return nil
+		}
+		for _, value := range e.Values {
+			c.expect(value, want.Elem)
+		}
+		typ = parser.NewArrayType(want.Elem)
+	case *parser.MapExpr:
+		if want.Kind != parser.TYPE_MAP {
+			return nil
+		}
+		for _, entry := range e.Entries {
+			c.expect(entry.Key, want.Key)
+			c.expect(entry.Value, want.Elem)
+		}
+		typ = parser.NewMapType(want.Key, want.Elem)
+	default:
+		return nil
+	}
+	typ.Span = expr.GetSpan()
+	expr.SetValueType(typ)
+	return typ
+}
+
+// check returns the type of expr and stores it on expr. A type found for
+// expr remembers where, to explain later conflicts.
+func (c *checker) check(expr parser.Expr) *parser.Type {
+	if expr == nil {
+		return parser.NewType(parser.TYPE_VOID)
+	}
+	typ := c.typeOf(expr)
+	if typ.Kind != parser.TYPE_VAR && typ.Span == (cerr.Span{}) {
+		typ.Span = expr.GetSpan()
+	}
+	expr.SetValueType(typ)
+	return typ
+}
+
+func (c *checker) typeOf(expr parser.Expr) *parser.Type {
+	switch e := expr.(type) {
+	case *parser.NumberExpr:
+		return parser.NewType(parser.TYPE_NUMBER)
+	case *parser.BooleanExpr:
+		return parser.NewType(parser.TYPE_BOOL)
+	case *parser.StringExpr:
+		return parser.NewType(parser.TYPE_STRING)
+	case *parser.InterpolatedStringExpr:
+		for _, part := range e.Exprs {
+			c.check(part)
+		}
+		return parser.NewType(parser.TYPE_STRING)
+	case *parser.VariableExpr:
+		return c.symbolType(e.Symbol)
+	case *parser.ArrayExpr:
+		// The elements of an empty array are found by its uses.
+		if len(e.Values) == 0 {
+			return parser.NewArrayType(c.fresh())
+		}
+		// The other elements must fit the first one.
+		elem := c.check(e.Values[0])
+		for _, value := range e.Values[1:] {
+			c.expect(value, elem)
+		}
+		return parser.NewArrayType(elem)
+	case *parser.MapExpr:
+		if len(e.Entries) == 0 {
+			return parser.NewMapType(c.fresh(), c.fresh())
+		}
+		key, value := c.check(e.Entries[0].Key), c.check(e.Entries[0].Value)
+		for _, entry := range e.Entries[1:] {
+			c.expect(entry.Key, key)
+			c.expect(entry.Value, value)
+		}
+		return parser.NewMapType(key, value)
+	case *parser.BinaryExpr:
+		return c.binary(e.Op, e.Span, e.LHS, c.check(e.LHS), e.RHS, c.check(e.RHS))
+	case *parser.UnaryExpr:
+		return c.unary(e)
+	case *parser.BraceExpr:
+		for _, stmt := range e.Exprs {
+			c.check(stmt)
+		}
+		return parser.NewType(parser.TYPE_VOID)
+	case *parser.CallExpr:
+		return c.call(e)
+	case *parser.IndexExpr:
+		return c.index(e)
+	case *parser.RangeExpr:
+		for _, bound := range []parser.Expr{e.Start, e.End} {
+			if bound != nil {
+				c.expect(bound, parser.NewType(parser.TYPE_NUMBER))
+			}
+		}
+		return parser.NewArrayType(parser.NewType(parser.TYPE_NUMBER))
+	case *parser.IfExpr:
+		c.check(e.Cond)
+		c.check(e.Then)
+		c.check(e.Else)
+		return parser.NewType(parser.TYPE_ANY)
+	case *parser.ForExpr:
+		start := c.check(e.Start)
+		if e.VarSymbol != nil {
+			e.VarSymbol.Type = start
+		}
+		c.check(e.End)
+		c.check(e.Step)
+		c.check(e.Body)
+		return parser.NewType(parser.TYPE_VOID)
+	case *parser.WhileExpr:
+		c.check(e.Cond)
+		c.check(e.Body)
+		return parser.NewType(parser.TYPE_VOID)
+	case *parser.ForeachExpr:
+		c.foreach(e)
+		return parser.NewType(parser.TYPE_VOID)
+	case *parser.DeclarationExpr:
+		c.declaration(e)
+		return parser.NewType(parser.TYPE_VOID)
+	case *parser.AssignExpr:
+		c.assign(e)
+		return parser.NewType(parser.TYPE_VOID)
+	case *parser.ReturnExpr:
+		got := c.check(e.Value)
+		if c.result == nil {
+			return parser.NewType(parser.TYPE_VOID)
+		}
+		// A bare return leaves an unknown result to the other returns.
+		span := e.Span
+		if e.Value != nil {
+			span = e.Value.GetSpan()
+			c.returns = true
+		} else if c.result.Resolve().Kind == parser.TYPE_VAR {
+			return parser.NewType(parser.TYPE_VOID)
+		}
+		if !c.unify(c.result, got, span) {
+			c.conflict(span, c.result, got)
+		}
+		return parser.NewType(parser.TYPE_VOID)
+	case *parser.LambdaExpr:
+		c.validateProto(e.Proto)
+		typ := c.protoType(e.Proto, nil)
+		e.Proto.Signature = typ
+		c.checkBody(e.Proto, typ, e.Body)
+		return typ
+	case *parser.StructLiteralExpr:
+		return c.structLiteral(e)
+	case *parser.MemberExpr:
+		return c.member(e, false)
+	case *parser.MatchExpr:
+		c.check(e.Subject)
+		for _, arm := range e.Arms {
+			c.check(arm.Guard)
+			c.check(arm.Body)
+		}
+		return parser.NewType(parser.TYPE_ANY)
+	case *parser.BreakExpr, *parser.ContinueExpr:
+		return parser.NewType(parser.TYPE_VOID)
+	}
+	return parser.NewType(parser.TYPE_ANY)
+}
+
+// symbolType returns the type of a use of the name declared by sym, a new
+// instance if it is generic. Names used before the checker reached their
+// declaration are any.
+func (c *checker) symbolType(sym *parser.Symbol) *parser.Type {
+	if sym == nil {
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	if sym.Kind == parser.SYMBOL_FUNCTION && sym.Proto != nil {
+		sym.Type = c.signature(sym.Proto)
+	}
+	if sym.Type == nil {
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	return c.instantiate(sym.Type)
+}
+
+// arithmetic are the operators that take and give numbers, '+' also joins
+// strings.
+var arithmetic = map[parser.OpKind]bool{
+	parser.OP_SUB: true, parser.OP_MUL: true, parser.OP_DIV: true, parser.OP_MOD: true, parser.OP_POW: true,
+	parser.OP_AND: true, parser.OP_OR: true, parser.OP_XOR: true, parser.OP_SHIFT_LEFT: true, parser.OP_SHIFT_RIGHT: true,
+}
+
+// binary returns the type of `lhs op rhs`, span is the whole operation. An
+// operand of unknown type becomes a number if the operator needs one, '+'
+// and the comparisons only constrain it if the other operand tells whether
+// numbers or strings are meant.
+func (c *checker) binary(op parser.OpKind, span cerr.Span, lhs parser.Expr, l *parser.Type, rhs parser.Expr, r *parser.Type) *parser.Type {
+	lk, rk := l.Resolve().Kind, r.Resolve().Kind
+	number := parser.NewType(parser.TYPE_NUMBER)
+	unknown := func(kind parser.TypeKind, typ *parser.Type) bool {
+		return kind == parser.TYPE_VAR || c.isAny(typ)
+	}
+	switch {
+	case op == parser.OP_ADD:
+		switch {
+		case lk == parser.TYPE_STRING && (c.is(r, parser.TYPE_STRING) || rk == parser.TYPE_NUMBER || rk == parser.TYPE_VAR),
+			rk == parser.TYPE_STRING && (c.is(l, parser.TYPE_STRING) || lk == parser.TYPE_NUMBER || lk == parser.TYPE_VAR):
+			return parser.NewType(parser.TYPE_STRING)
+		case lk == parser.TYPE_NUMBER && rk == parser.TYPE_NUMBER:
+			return number
+		case unknown(lk, l) && rk == parser.TYPE_NUMBER, unknown(rk, r) && lk == parser.TYPE_NUMBER:
+			if c.unify(l, number, span) && c.unify(r, number, span) && !c.isAny(l) && !c.isAny(r) {
+				return number
+			}
+			return parser.NewType(parser.TYPE_ANY)
+		case unknown(lk, l) && unknown(rk, r):
+			return parser.NewType(parser.TYPE_ANY)
+		}
+	case arithmetic[op]:
+		if c.unify(l, number, span) && c.unify(r, number, span) {
+			return number
+		}
+	case op == parser.OP_LESS || op == parser.OP_GREATER || op == parser.OP_LESS_EQ || op == parser.OP_GREATER_EQ:
+		want := number
+		if lk == parser.TYPE_STRING || rk == parser.TYPE_STRING {
+			want = parser.NewType(parser.TYPE_STRING)
+		}
+		if lk == parser.TYPE_VAR && rk == parser.TYPE_VAR || c.unify(l, want, span) && c.unify(r, want, span) {
+			return parser.NewType(parser.TYPE_BOOL)
+		}
+	case op == parser.OP_LOGICAL_AND || op == parser.OP_LOGICAL_OR:
+		if lk == parser.TYPE_BOOL && rk == parser.TYPE_BOOL {
+			return parser.NewType(parser.TYPE_BOOL)
+		}
+		return parser.NewType(parser.TYPE_ANY)
+	default:
+		return parser.NewType(parser.TYPE_BOOL)
+	}
+
+	names := parser.FormatTypes(l, r)
+	diag := c.diags.Error(cerr.CODE_TYPE_MISMATCH, span, "Cannot apply '%s' to '%s' and '%s'", op, names[0], names[1])
+	c.labelType(diag, lhs.GetSpan(), l, names[0])
+	c.labelType(diag, rhs.GetSpan(), r, names[1])
+	return parser.NewType(parser.TYPE_ANY)
+}
+
+func (c *checker) unary(e *parser.UnaryExpr) *parser.Type {
+	operand := c.check(e.RHS)
+	if e.Op == parser.OP_NOT {
+		return parser.NewType(parser.TYPE_BOOL)
+	}
+	if !c.unify(operand, parser.NewType(parser.TYPE_NUMBER), e.Span) {
+		diag := c.diags.Error(cerr.CODE_TYPE_MISMATCH, e.Span, "Cannot apply '%s' to '%s'", e.Op, operand)
+		c.labelType(diag, e.RHS.GetSpan(), operand, operand.String())
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	return parser.NewType(parser.TYPE_NUMBER)
+}
+
+func (c *checker) call(call *parser.CallExpr) *parser.Type {
+	if callee, ok := call.Callee.(*parser.VariableExpr); ok && callee.Symbol != nil && callee.Symbol.Kind == parser.SYMBOL_BUILTIN {
+		c.check(callee)
+		return c.builtin(callee.Name, call)
+	}
+
+	var callee *parser.Type
+	if member, ok := call.Callee.(*parser.MemberExpr); ok {
+		callee = c.member(member, true)
+		member.SetValueType(callee)
+	} else {
+		callee = c.check(call.Callee)
+	}
+	// A callee of unknown type is a function taking the arguments given.
+	if callee.Resolve().Kind == parser.TYPE_VAR {
+		args := make([]*parser.Type, len(call.Args))
+		for i, arg := range call.Args {
+			args[i] = c.check(arg)
+		}
+		result := c.fresh()
+		want := parser.NewFuncType(args, result)
+		if !c.unify(callee, want, call.Span) {
+			c.conflict(call.Span, callee, want)
+		}
+		return result
+	}
+	if c.isAny(callee) {
+		for _, arg := range call.Args {
+			c.check(arg)
+		}
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	if callee.Resolve().Kind != parser.TYPE_FUNC {
+		diag := c.diags.Error(cerr.CODE_TYPE_MISMATCH, call.Span, "Cannot call '%s', it is not a function", callee)
+		c.labelType(diag, call.Callee.GetSpan(), callee, callee.String())
+		for _, arg := range call.Args {
+			c.check(arg)
+		}
+		return parser.NewType(parser.TYPE_ANY)
+	}
+
+	// A wrong number of arguments is reported by checkArities.
+	callee = callee.Resolve()
+	for i, arg := range call.Args {
+		if i < len(callee.Params) {
+			c.expect(arg, callee.Params[i])
+		} else {
+			c.check(arg)
+		}
+	}
+	return callee.Result
+}
+
+// builtin returns the type of a call to the builtin name.
+func (c *checker) builtin(name string, call *parser.CallExpr) *parser.Type {
+	args := make([]*parser.Type, len(call.Args))
+	for i, arg := range call.Args {
+		args[i] = c.check(arg)
+	}
+	if len(args) == 0 {
+		args = append(args, parser.NewType(parser.TYPE_ANY))
+	}
+	arg := args[0].Resolve()
+	unknown := parser.NewType(parser.TYPE_ANY)
+
+	switch name {
+	case "len":
+		// The length of a value of unknown type leaves it unknown, it may be
+		// an array or a string. Maps have no length in JavaScript.
+		if !c.isAny(arg) && arg.Kind != parser.TYPE_VAR && arg.Kind != parser.TYPE_ARRAY && arg.Kind != parser.TYPE_STRING {
+			diag := c.diags.Error(cerr.CODE_TYPE_MISMATCH, call.Span, "Cannot take the length of '%s'", arg)
+			c.labelType(diag, call.Args[0].GetSpan(), args[0], arg.String())
+			if arg.Kind == parser.TYPE_MAP {
+				diag.WithNote("use len(keys(m)) for the number of entries of a map")
+			}
+		}
+		return parser.NewType(parser.TYPE_NUMBER)
+	case "keys":
+		switch arg.Kind {
+		case parser.TYPE_VAR:
+			c.elementTypes(arg)
+			return parser.NewArrayType(arg.Key)
+		case parser.TYPE_MAP:
+			return parser.NewArrayType(arg.Key)
+		case parser.TYPE_ARRAY:
+			return parser.NewArrayType(parser.NewType(parser.TYPE_NUMBER))
+		}
+		return parser.NewArrayType(unknown)
+	case "values":
+		if arg.Kind == parser.TYPE_VAR {
+			_, elem, _ := c.elementTypes(arg)
+			return parser.NewArrayType(elem)
+		}
+		if arg.Kind == parser.TYPE_MAP || arg.Kind == parser.TYPE_ARRAY {
+			return parser.NewArrayType(arg.Elem)
+		}
+		return parser.NewArrayType(unknown)
+	case "has":
+		return parser.NewType(parser.TYPE_BOOL)
+	case "enumerate":
+		return parser.NewArrayType(parser.NewArrayType(unknown))
+	}
+	return parser.NewType(parser.TYPE_VOID)
+}
+
+func (c *checker) index(e *parser.IndexExpr) *parser.Type {
+	checked := c.check(e.Array)
+	array := checked.Resolve()
+	if rng, ok := e.Index.(*parser.RangeExpr); ok {
+		c.check(rng)
+		if c.isAny(array) || array.Kind == parser.TYPE_VAR || array.Kind == parser.TYPE_ARRAY || array.Kind == parser.TYPE_STRING {
+			return checked
+		}
+		diag := c.diags.Error(cerr.CODE_TYPE_MISMATCH, e.Span, "Cannot slice '%s'", array)
+		c.labelType(diag, e.Array.GetSpan(), checked, array.String())
+		return parser.NewType(parser.TYPE_ANY)
+	}
+
+	switch {
+	case c.isAny(array):
+		c.check(e.Index)
+		return array
+	case array.Kind == parser.TYPE_VAR:
+		// The value may be an array, a string or a map, its elements are
+		// known once it is.
+		index := c.check(e.Index)
+		elem, ok := c.indexed(array, index, e.Index.GetSpan())
+		if !ok {
+			c.conflict(e.Index.GetSpan(), array.Key, index)
+		}
+		return elem
+	case array.Kind == parser.TYPE_ARRAY:
+		c.expect(e.Index, parser.NewType(parser.TYPE_NUMBER))
+		return array.Elem
+	case array.Kind == parser.TYPE_STRING:
+		c.expect(e.Index, parser.NewType(parser.TYPE_NUMBER))
+		return array
+	case array.Kind == parser.TYPE_MAP:
+		c.expect(e.Index, array.Key)
+		return array.Elem
+	}
+	c.check(e.Index)
+	diag := c.diags.Error(cerr.CODE_TYPE_MISMATCH, e.Span, "Cannot index '%s'", array)
+	c.labelType(diag, e.Array.GetSpan(), checked, array.String())
+	diag.WithNote("only arrays, strings and maps can be indexed")
+	return parser.NewType(parser.TYPE_ANY)
+}
+
+// elementTypes returns the types of the keys and elements of iterable, as
+// bound by a loop over it.
+func (c *checker) elementTypes(iterable *parser.Type) (key, elem *parser.Type, ok bool) {
+	iterable = iterable.Resolve()
+	number := parser.NewType(parser.TYPE_NUMBER)
+	switch {
+	case c.isAny(iterable):
+		return iterable, iterable, true
+	case iterable.Kind == parser.TYPE_VAR:
+		elem, _ := c.indexed(iterable, c.fresh(), cerr.Span{})
+		return iterable.Key, elem, true
+	case iterable.Kind == parser.TYPE_ARRAY:
+		return number, iterable.Elem, true
+	case iterable.Kind == parser.TYPE_STRING:
+		return number, iterable, true
+	case iterable.Kind == parser.TYPE_MAP:
+		return iterable.Key, iterable.Elem, true
+	}
+	return nil, nil, false
+}
+
+func (c *checker) foreach(loop *parser.ForeachExpr) {
+	iterable := c.check(loop.Array)
+	key, elem, ok := c.elementTypes(iterable)
+	if !ok {
+		c.diags.Error(cerr.CODE_TYPE_MISMATCH, loop.Array.GetSpan(), "Cannot loop over '%s'", iterable).
+			WithNote("only arrays, strings, maps and ranges can be looped over")
+		key, elem = parser.NewType(parser.TYPE_ANY), parser.NewType(parser.TYPE_ANY)
+	}
+
+	if loop.KeySymbol != nil {
+		loop.KeySymbol.Type = key
+	}
+	if loop.VarSymbol != nil {
+		loop.VarSymbol.Type = elem
+	}
+	if loop.Pattern != nil {
+		c.bind(loop.Pattern, elem, shapeOf(loop.Array) == nil)
+	}
+	c.check(loop.Body)
+}
+
+// declaration sets the type of the declared names. A lambda bound by 'let'
+// is generalized like a function, each use of it gets its own instance.
+func (c *checker) declaration(decl *parser.DeclarationExpr) {
+	c.validate(decl.Annotation)
+	if decl.Pattern != nil && decl.Annotation == nil {
+		c.destructure(decl.Pattern, decl.Expr)
+		return
+	}
+
+	_, lambda := decl.Expr.(*parser.LambdaExpr)
+	generic := lambda && !decl.Mutable && decl.Pattern == nil
+	if generic {
+		c.level++
+	}
+	typ := c.expect(decl.Expr, decl.Annotation)
+	if generic {
+		c.level--
+		c.generalize(typ)
+	}
+	if decl.Annotation != nil {
+		typ = decl.Annotation
+	}
+
+	if decl.Pattern != nil {
+		c.bind(decl.Pattern, typ, shapeOf(decl.Expr) == nil)
+	} else if decl.Symbol != nil {
+		decl.Symbol.Type = typ
+	}
+}
+
+// destructure checks value, destructured by pat, and sets the types of the
+// names pat binds. The elements of an array literal are matched by position,
+// so they may differ like the fields of a struct, `let [n, p] = [1, P {}]`.
+func (c *checker) destructure(pat *parser.Pattern, value parser.Expr) *parser.Type {
+	array, ok := value.(*parser.ArrayExpr)
+	if !ok || pat.Kind != parser.PATTERN_ARRAY || len(array.Values) == 0 {
+		typ := c.check(value)
+		c.bind(pat, typ, shapeOf(value) == nil)
+		return typ
+	}
+
+	// A wrong number of elements is reported by checkDestructuring.
+	elems := make([]*parser.Type, len(array.Values))
+	var rest *parser.Pattern
+	restAt := len(array.Values)
+	for i, elem := range array.Values {
+		switch {
+		case rest != nil:
+			elems[i] = c.check(elem)
+		case i < len(pat.Args) && pat.Args[i].Kind == parser.PATTERN_REST:
+			rest, restAt = pat.Args[i], i
+			elems[i] = c.check(elem)
+		case i < len(pat.Args):
+			elems[i] = c.destructure(pat.Args[i], elem)
+		default:
+			elems[i] = c.check(elem)
+		}
+	}
+	if rest != nil && rest.Symbol != nil {
+		rest.Symbol.Type = parser.NewArrayType(join(elems[restAt:]))
+	}
+
+	typ := parser.NewArrayType(join(elems))
+	typ.Span = array.Span
+	array.SetValueType(typ)
+	return typ
+}
+
+// join returns the type shared by the elements of a destructured literal,
+// any if they differ.
+func join(types []*parser.Type) *parser.Type {
+	if len(types) == 0 {
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	for _, typ := range types[1:] {
+		if names := parser.FormatTypes(typ, types[0]); names[0] != names[1] {
+			return parser.NewType(parser.TYPE_ANY)
+		}
+	}
+	return types[0]
+}
+
+// bind sets the types of the names bound by destructuring a value of type
+// typ with pat. Patterns that can't fit are reported if report is set, the
+// shape of a literal value is checked by checkDestructuring.
+func (c *checker) bind(pat *parser.Pattern, typ *parser.Type, report bool) {
+	switch pat.Kind {
+	case parser.PATTERN_BINDING:
+		if pat.Symbol != nil {
+			pat.Symbol.Type = typ
+		}
+	case parser.PATTERN_ARRAY:
+		_, elem, ok := c.elementTypes(typ)
+		if !ok || typ.Resolve().Kind == parser.TYPE_MAP {
+			if report {
+				c.diags.Error(cerr.CODE_PATTERN_SHAPE, pat.Span, "Array pattern can't destructure '%s'", typ)
+			}
+			elem = parser.NewType(parser.TYPE_ANY)
+		}
+		for _, arg := range pat.Args {
+			if arg.Kind == parser.PATTERN_REST {
+				if arg.Symbol != nil {
+					arg.Symbol.Type = parser.NewArrayType(elem)
+				}
+				continue
+			}
+			c.bind(arg, elem, report)
+		}
+	case parser.PATTERN_STRUCT:
+		// A pattern naming no struct is reported by checkDestructuring.
+		st := c.structs[pat.Struct]
+		if st != nil && !c.unify(parser.NewNamedType(st.Name), typ, pat.Span) && report {
+			c.diags.Error(cerr.CODE_PATTERN_SHAPE, pat.Span, "Struct pattern of '%s' can't destructure '%s'", st.Name, typ)
+		}
+		for _, field := range pat.Fields {
+			fieldType := parser.NewType(parser.TYPE_ANY)
+			if st != nil && st.Field(field.Name) != nil {
+				fieldType = declared(st.Field(field.Name).Type)
+			}
+			c.bind(field.Pattern, fieldType, report)
+		}
+	}
+}
+
+func (c *checker) assign(assign *parser.AssignExpr) {
+	target := c.check(assign.Target)
+	value := c.check(assign.Value)
+	// Assignments to immutable places are reported by checkAssignments.
+	if root, direct := placeRoot(assign.Target); root != nil && root.Symbol != nil && !mutablePlace(root.Symbol, direct) {
+		return
+	}
+	if assign.Op != "" {
+		value = c.binary(assign.Op, assign.Span, assign.Target, target, assign.Value, value)
+	}
+	if !c.unify(target, value, assign.Value.GetSpan()) {
+		c.conflict(assign.Value.GetSpan(), target, value)
+	}
+}
+
+func (c *checker) structLiteral(lit *parser.StructLiteralExpr) *parser.Type {
+	st := c.structs[lit.Name]
+	for _, init := range lit.Fields {
+		var want *parser.Type
+		if st != nil && st.Field(init.Name) != nil {
+			want = st.Field(init.Name).Type
+		}
+		c.expect(init.Value, want)
+	}
+	if st == nil {
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	return parser.NewNamedType(st.Name)
+}
+
+// member returns the type of a field, a method, a variant or a static
+// method. called is set for the callee of a call.
+func (c *checker) member(member *parser.MemberExpr, called bool) *parser.Type {
+	object := c.check(member.Object)
+	if name, ok := member.Object.(*parser.VariableExpr); ok && name.Symbol != nil {
+		switch name.Symbol.Kind {
+		case parser.SYMBOL_ENUM:
+			enum := c.enums[name.Name]
+			if enum == nil {
+				return parser.NewType(parser.TYPE_ANY)
+			}
+			// Unknown variants and wrong calls are reported by checkVariants.
+			variant := enum.Variant(member.Field)
+			if variant == nil || len(variant.Fields) == 0 && called {
+				return parser.NewType(parser.TYPE_ANY)
+			}
+			if len(variant.Fields) == 0 {
+				return parser.NewNamedType(name.Name)
+			}
+			params := make([]*parser.Type, len(variant.Fields))
+			for i := range params {
+				params[i] = parser.NewType(parser.TYPE_ANY)
+			}
+			return parser.NewFuncType(params, parser.NewNamedType(name.Name))
+		case parser.SYMBOL_STRUCT:
+			if method := c.methods[name.Name][member.Field]; method != nil {
+				return c.instantiate(c.signature(method.Proto))
+			}
+			return parser.NewType(parser.TYPE_ANY)
+		}
+	}
+
+	object = object.Resolve()
+	if object.Kind == parser.TYPE_VAR {
+		return c.memberOf(object, member.Field)
+	}
+	if object.Kind != parser.TYPE_NAMED || c.structs[object.Name] == nil {
+		return parser.NewType(parser.TYPE_ANY)
+	}
+	st := c.structs[object.Name]
+	if field := st.Field(member.Field); field != nil {
+		return declared(field.Type)
+	}
+	if method := c.methods[st.Name][member.Field]; method != nil && method.HasSelf() {
+		return withoutSelf(c.instantiate(c.signature(method.Proto)))
+	}
+
+	if called && c.callable[member.Field] {
+		c.diags.Error(cerr.CODE_UNKNOWN_METHOD, member.FieldSpan, "Struct '%s' has no method named '%s'", st.Name, member.Field).
+			WithLabel(st.NameSpan, "'%s' declared here", st.Name)
+	} else if !called && c.fields[member.Field] {
+		c.diags.Error(cerr.CODE_UNKNOWN_FIELD, member.FieldSpan, "Struct '%s' has no field named '%s'", st.Name, member.Field).
+			WithLabel(st.NameSpan, "'%s' declared here", st.Name).
+			WithNote("the fields of '%s' are: %s", st.Name, fieldNames(st))
+	}
+	return parser.NewType(parser.TYPE_ANY)
+}
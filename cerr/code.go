@@ -0,0 +1,52 @@
+package cerr
+
+// Code identifies a kind of diagnostic. Codes are stable, tools and docs may
+// refer to them, so never renumber one.
+type Code string
+
+const (
+	// Lexer
+	CODE_ILLEGAL_CHARACTER    Code = "E0001"
+	CODE_UNTERMINATED_COMMENT Code = "E0002"
+	CODE_UNTERMINATED_STRING  Code = "E0003"
+	CODE_INVALID_ESCAPE       Code = "E0004"
+	CODE_INVALID_NUMBER       Code = "E0005"
+	// Parser
+	CODE_SYNTAX              Code = "E0100"
+	CODE_NUMBER_OUT_OF_RANGE Code = "E0101"
+	// Code generation
+	CODE_DUPLICATE_FUNCTION Code = "E0200"
+	CODE_MISSING_MAIN       Code = "E0201"
+	CODE_DUPLICATE_GLOBAL   Code = "E0202"
+	CODE_NOT_CONSTANT       Code = "E0203"
+	// Analysis
+	CODE_UNKNOWN_STRUCT         Code = "E0300"
+	CODE_UNKNOWN_FIELD          Code = "E0301"
+	CODE_MISSING_FIELD          Code = "E0302"
+	CODE_DUPLICATE_FIELD        Code = "E0303"
+	CODE_DUPLICATE_STRUCT       Code = "E0304"
+	CODE_UNKNOWN_METHOD         Code = "E0305"
+	CODE_DUPLICATE_METHOD       Code = "E0306"
+	CODE_DUPLICATE_ENUM         Code = "E0307"
+	CODE_DUPLICATE_VARIANT      Code = "E0308"
+	CODE_UNKNOWN_ENUM           Code = "E0309"
+	CODE_UNKNOWN_VARIANT        Code = "E0310"
+	CODE_VARIANT_ARITY          Code = "E0311"
+	CODE_NON_EXHAUSTIVE_MATCH   Code = "E0312"
+	CODE_MISMATCHED_PATTERN     Code = "E0313"
+	CODE_DUPLICATE_BINDING      Code = "E0314"
+	CODE_RETURN_IN_MATCH_VALUE  Code = "E0315"
+	CODE_BREAK_OUTSIDE_LOOP     Code = "E0316"
+	CODE_UNKNOWN_LABEL          Code = "E0317"
+	CODE_DUPLICATE_LABEL        Code = "E0318"
+	CODE_DUPLICATE_KEY          Code = "E0319"
+	CODE_OPEN_RANGE             Code = "E0320"
+	CODE_PATTERN_SHAPE          Code = "E0321"
+	CODE_UNDEFINED_NAME         Code = "E0322"
+	CODE_DUPLICATE_DECLARATION  Code = "E0323"
+	CODE_USE_BEFORE_DECLARATION Code = "E0324"
+	CODE_ASSIGN_IMMUTABLE       Code = "E0325"
+	CODE_CALL_ARITY             Code = "E0326"
+	CODE_TYPE_MISMATCH          Code = "E0327"
+	CODE_UNKNOWN_TYPE           Code = "E0328"
+)
@@ -0,0 +1,142 @@
+package cerr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SEVERITY_ERROR Severity = iota
+	SEVERITY_WARNING
+	SEVERITY_NOTE
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SEVERITY_ERROR:
+		return "error"
+	case SEVERITY_WARNING:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// Label attaches a message to a secondary span of a diagnostic.
+type Label struct {
+	Span    Span
+	Message string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	// Span is the primary location of the diagnostic, it may be zero when
+	// the problem has no single place in the source.
+	Span   Span
+	Labels []Label
+	Notes  []string
+}
+
+// WithLabel adds a secondary span, e.g. pointing at a previous declaration.
+func (d *Diagnostic) WithLabel(span Span, format string, args ...any) *Diagnostic {
+	d.Labels = append(d.Labels, Label{Span: span, Message: fmt.Sprintf(format, args...)})
+	return d
+}
+
+func (d *Diagnostic) WithNote(format string, args ...any) *Diagnostic {
+	d.Notes = append(d.Notes, fmt.Sprintf(format, args...))
+	return d
+}
+
+// Error renders the diagnostic on a few plain lines without source snippets,
+// use an Emitter for the full report.
+func (d *Diagnostic) Error() string {
+	var b strings.Builder
+	if !d.Span.IsZero() {
+		b.WriteString(formatPos(d.Span) + ": ")
+	}
+	fmt.Fprintf(&b, "%s[%s]: %s", d.Severity, d.Code, d.Message)
+	for _, label := range d.Labels {
+		fmt.Fprintf(&b, "\n  %s: %s", formatPos(label.Span), label.Message)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(&b, "\n  = note: %s", note)
+	}
+	return b.String()
+}
+
+func formatPos(span Span) string {
+	return fmt.Sprintf("%s:%d:%d", span.File, span.Start.Line+1, span.Start.Column+1)
+}
+
+// Diagnostics collects the diagnostics reported by every compiler stage, so a
+// single run can report as many problems as possible.
+type Diagnostics struct {
+	list []*Diagnostic
+}
+
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{}
+}
+
+func (d *Diagnostics) Add(diag *Diagnostic) *Diagnostic {
+	d.list = append(d.list, diag)
+	return diag
+}
+
+func (d *Diagnostics) Error(code Code, span Span, format string, args ...any) *Diagnostic {
+	return d.report(SEVERITY_ERROR, code, span, format, args...)
+}
+
+func (d *Diagnostics) Warning(code Code, span Span, format string, args ...any) *Diagnostic {
+	return d.report(SEVERITY_WARNING, code, span, format, args...)
+}
+
+func (d *Diagnostics) report(severity Severity, code Code, span Span, format string, args ...any) *Diagnostic {
+	return d.Add(&Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Span:     span,
+	})
+}
+
+func (d *Diagnostics) HasErrors() bool {
+	for _, diag := range d.list {
+		if diag.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Diagnostics) Len() int {
+	return len(d.list)
+}
+
+// All returns the diagnostics in the order they were reported.
+func (d *Diagnostics) All() []*Diagnostic {
+	return d.list
+}
+
+// Sorted returns the diagnostics ordered by file and position. Diagnostics
+// without a span come first, ties keep the order they were reported in.
+func (d *Diagnostics) Sorted() []*Diagnostic {
+	sorted := append([]*Diagnostic(nil), d.list...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Span, sorted[j].Span
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Start.Line != b.Start.Line {
+			return a.Start.Line < b.Start.Line
+		}
+		return a.Start.Column < b.Start.Column
+	})
+	return sorted
+}
@@ -0,0 +1,49 @@
+package cerr
+
+import "testing"
+
+func at(file string, line, column int) Span {
+	pos := Pos{Line: line, Column: column}
+	return Span{File: file, Start: pos, End: pos}
+}
+
+func TestDiagnosticsSorted(t *testing.T) {
+	diags := NewDiagnostics()
+	diags.Error(CODE_SYNTAX, at("b.kori", 0, 0), "third")
+	diags.Warning(CODE_SYNTAX, at("a.kori", 3, 1), "second")
+	diags.Error(CODE_SYNTAX, at("a.kori", 1, 7), "first")
+	diags.Error(CODE_MISSING_MAIN, Span{}, "no span")
+
+	expected := []string{"no span", "first", "second", "third"}
+	for i, diag := range diags.Sorted() {
+		if diag.Message != expected[i] {
+			t.Errorf("Expected %s at %d, got %s", expected[i], i, diag.Message)
+		}
+	}
+
+	if diags.All()[0].Message != "third" {
+		t.Errorf("All should keep the report order")
+	}
+}
+
+func TestDiagnosticsHasErrors(t *testing.T) {
+	diags := NewDiagnostics()
+	if diags.HasErrors() {
+		t.Error("Expected no errors in an empty collector")
+	}
+
+	diags.Warning(CODE_SYNTAX, at("a.kori", 0, 0), "warning")
+	if diags.HasErrors() {
+		t.Error("Warnings alone are not errors")
+	}
+
+	diags.Error(CODE_SYNTAX, at("a.kori", 0, 0), "error").
+		WithLabel(at("a.kori", 1, 0), "related").
+		WithNote("a note")
+	if !diags.HasErrors() {
+		t.Error("Expected errors")
+	}
+	if diags.Len() != 2 || len(diags.All()[1].Labels) != 1 || len(diags.All()[1].Notes) != 1 {
+		t.Errorf("Unexpected diagnostics %v", diags.All())
+	}
+}
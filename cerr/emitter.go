@@ -0,0 +1,211 @@
+package cerr
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const tabWidth = 4
+
+// Emitter renders diagnostics in the style of rustc: a header, the source
+// lines the spans point at with the spans underlined, then the notes.
+type Emitter struct {
+	w     io.Writer
+	color bool
+	files map[string][]string
+}
+
+func NewEmitter(w io.Writer, color bool) *Emitter {
+	return &Emitter{
+		w:     w,
+		color: color,
+		files: make(map[string][]string),
+	}
+}
+
+// ShouldColor reports whether output to f should use ANSI colours: only for
+// terminals, and never when NO_COLOR is set (https://no-color.org).
+func ShouldColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// AddFile registers the source of a file so that its lines can be shown.
+func (e *Emitter) AddFile(name, source string) {
+	e.files[name] = strings.Split(source, "\n")
+}
+
+func (e *Emitter) Emit(d *Diagnostic) {
+	severity := e.paint(severityColor(d.Severity), fmt.Sprintf("%s[%s]", d.Severity, d.Code))
+	fmt.Fprintf(e.w, "%s%s\n", severity, e.paint(bold, ": "+d.Message))
+
+	gutter := 1
+	for _, span := range d.spans() {
+		gutter = max(gutter, len(strconv.Itoa(span.Start.Line+1)))
+	}
+	pad := strings.Repeat(" ", gutter)
+
+	var marks []mark
+	if !d.Span.IsZero() {
+		fmt.Fprintf(e.w, "%s%s %s\n", pad, e.paint(blue, "-->"), formatPos(d.Span))
+		marks = append(marks, mark{span: d.Span, char: "^", color: severityColor(d.Severity)})
+	}
+	for _, label := range d.Labels {
+		marks = append(marks, mark{span: label.Span, char: "-", color: blue, message: label.Message})
+	}
+
+	for _, line := range groupLines(marks) {
+		if span := line[0].span; span.File != d.Span.File {
+			fmt.Fprintf(e.w, "%s%s %s\n", pad, e.paint(blue, ":::"), formatPos(span))
+		}
+		e.snippet(pad, line)
+	}
+
+	if len(d.Notes) > 0 && !d.Span.IsZero() {
+		fmt.Fprintf(e.w, "%s %s\n", pad, e.paint(blue, "|"))
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(e.w, "%s %s %s\n", pad, e.paint(blue, "="), e.paint(bold, "note")+": "+note)
+	}
+	fmt.Fprintln(e.w)
+}
+
+// EmitAll emits every diagnostic sorted by position, followed by a summary
+// when there are errors.
+func (e *Emitter) EmitAll(diags *Diagnostics) {
+	errors := 0
+	for _, diag := range diags.Sorted() {
+		e.Emit(diag)
+		if diag.Severity == SEVERITY_ERROR {
+			errors++
+		}
+	}
+
+	switch {
+	case errors == 1:
+		fmt.Fprintf(e.w, "%s\n", e.paint(red, "error")+e.paint(bold, ": aborting due to previous error"))
+	case errors > 1:
+		fmt.Fprintf(e.w, "%s\n", e.paint(red, "error")+e.paint(bold, fmt.Sprintf(": aborting due to %d previous errors", errors)))
+	}
+}
+
+// mark is a span to underline with char, followed by message.
+type mark struct {
+	span    Span
+	char    string
+	color   string
+	message string
+}
+
+// groupLines groups the marks starting on the same line of the same file,
+// in the order the lines are first marked.
+func groupLines(marks []mark) [][]mark {
+	var groups [][]mark
+	index := make(map[Span]int)
+	for _, m := range marks {
+		key := Span{File: m.span.File, Start: Pos{Line: m.span.Start.Line}}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], m)
+	}
+	return groups
+}
+
+// snippet prints the line the marks start on once, and underlines the part
+// of it each mark spans on a row of its own.
+func (e *Emitter) snippet(pad string, marks []mark) {
+	start := marks[0].span.Start
+	lines, ok := e.files[marks[0].span.File]
+	if !ok || start.Line >= len(lines) {
+		return
+	}
+	line := strings.TrimRight(lines[start.Line], "\r")
+
+	number := strconv.Itoa(start.Line + 1)
+	fmt.Fprintf(e.w, "%s %s\n", pad, e.paint(blue, "|"))
+	fmt.Fprintf(e.w, "%s%s %s %s\n", number, pad[len(number):], e.paint(blue, "|"), expandTabs(line))
+
+	for _, m := range marks {
+		end := m.span.End.Column
+		if m.span.End.Line != m.span.Start.Line {
+			end = utf8.RuneCountInString(line)
+		}
+		width := max(1, visualWidth(line, end)-visualWidth(line, m.span.Start.Column))
+
+		underline := strings.Repeat(" ", visualWidth(line, m.span.Start.Column)) + strings.Repeat(m.char, width)
+		if m.message != "" {
+			underline += " " + m.message
+		}
+		fmt.Fprintf(e.w, "%s %s %s\n", pad, e.paint(blue, "|"), e.paint(m.color, underline))
+	}
+}
+
+// visualWidth is the width of the first column runes of line once tabs are
+// expanded.
+func visualWidth(line string, column int) int {
+	width := 0
+	for i, r := range []rune(line) {
+		if i >= column {
+			break
+		}
+		if r == '\t' {
+			width += tabWidth
+		} else {
+			width++
+		}
+	}
+	return width + max(0, column-utf8.RuneCountInString(line))
+}
+
+func expandTabs(line string) string {
+	return strings.ReplaceAll(line, "\t", strings.Repeat(" ", tabWidth))
+}
+
+func (d *Diagnostic) spans() []Span {
+	spans := []Span{d.Span}
+	for _, label := range d.Labels {
+		spans = append(spans, label.Span)
+	}
+	return spans
+}
+
+const (
+	reset  = "\033[0m"
+	bold   = "\033[1m"
+	red    = "\033[1;31m"
+	yellow = "\033[1;33m"
+	blue   = "\033[1;34m"
+	green  = "\033[1;32m"
+)
+
+func severityColor(s Severity) string {
+	switch s {
+	case SEVERITY_ERROR:
+		return red
+	case SEVERITY_WARNING:
+		return yellow
+	default:
+		return green
+	}
+}
+
+func (e *Emitter) paint(color, text string) string {
+	if !e.color || text == "" {
+		return text
+	}
+	return color + text + reset
+}
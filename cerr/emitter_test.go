@@ -0,0 +1,127 @@
+package cerr
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEmitterSnippet(t *testing.T) {
+	src := "func main() {\n\tlet x = 1;\n    x = 2;\n}"
+
+	diags := NewDiagnostics()
+	diags.Error(CODE_SYNTAX, Span{
+		File:  "main.kori",
+		Start: Pos{Offset: 31, Line: 2, Column: 4},
+		End:   Pos{Offset: 36, Line: 2, Column: 9},
+	}, "Cannot assign twice").
+		WithLabel(Span{
+			File:  "main.kori",
+			Start: Pos{Offset: 19, Line: 1, Column: 5},
+			End:   Pos{Offset: 20, Line: 1, Column: 6},
+		}, "declared here").
+		WithNote("use 'var' for a mutable variable")
+
+	var out strings.Builder
+	emitter := NewEmitter(&out, false)
+	emitter.AddFile("main.kori", src)
+	emitter.EmitAll(diags)
+
+	expected := `error[E0100]: Cannot assign twice
+ --> main.kori:3:5
+  |
+3 |     x = 2;
+  |     ^^^^^
+  |
+2 |     let x = 1;
+  |         - declared here
+  |
+  = note: use 'var' for a mutable variable
+
+error: aborting due to previous error
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestEmitterColor(t *testing.T) {
+	diags := NewDiagnostics()
+	diags.Warning(CODE_SYNTAX, Span{}, "careful")
+
+	var out strings.Builder
+	NewEmitter(&out, true).EmitAll(diags)
+	if !strings.HasPrefix(out.String(), yellow+"warning[E0100]"+reset) {
+		t.Errorf("Expected a yellow header, got %q", out.String())
+	}
+
+	out.Reset()
+	NewEmitter(&out, false).EmitAll(diags)
+	if strings.Contains(out.String(), "\033[") {
+		t.Errorf("Expected no escape codes, got %q", out.String())
+	}
+}
+
+func TestShouldColor(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if ShouldColor(w) {
+		t.Error("Pipes are not terminals")
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if ShouldColor(os.Stdout) {
+		t.Error("NO_COLOR must disable colours")
+	}
+}
+
+func TestEmitterLabelsOnOneLine(t *testing.T) {
+	src := "func main() {\n    println(xs[1;\n}"
+	diags := NewDiagnostics()
+	diags.Error(CODE_SYNTAX, Span{
+		File:  "main.kori",
+		Start: Pos{Offset: 30, Line: 1, Column: 16},
+		End:   Pos{Offset: 31, Line: 1, Column: 17},
+	}, "Expected ']' after index, found ';'").
+		WithLabel(Span{
+			File:  "main.kori",
+			Start: Pos{Offset: 25, Line: 1, Column: 11},
+			End:   Pos{Offset: 26, Line: 1, Column: 12},
+		}, "'(' opened here").
+		WithLabel(Span{
+			File:  "main.kori",
+			Start: Pos{Offset: 12, Line: 0, Column: 12},
+			End:   Pos{Offset: 13, Line: 0, Column: 13},
+		}, "'{' opened here").
+		WithLabel(Span{
+			File:  "main.kori",
+			Start: Pos{Offset: 28, Line: 1, Column: 14},
+			End:   Pos{Offset: 29, Line: 1, Column: 15},
+		}, "'[' opened here")
+
+	var out strings.Builder
+	emitter := NewEmitter(&out, false)
+	emitter.AddFile("main.kori", src)
+	emitter.Emit(diags.All()[0])
+
+	expected := `error[E0100]: Expected ']' after index, found ';'
+ --> main.kori:2:17
+  |
+2 |     println(xs[1;
+  |                 ^
+  |            - '(' opened here
+  |               - '[' opened here
+  |
+1 | func main() {
+  |             - '{' opened here
+
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,33 @@
+package cerr
+
+// Pos is a position in a source file. Line and Column are zero based, Column
+// counts runes.
+type Pos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Span is the half-open source range [Start, End) in File.
+type Span struct {
+	File  string `json:"file"`
+	Start Pos    `json:"start"`
+	End   Pos    `json:"end"`
+}
+
+// To returns the span from the start of s to the end of other, a zero span on
+// either side is ignored.
+func (s Span) To(other Span) Span {
+	if s.IsZero() {
+		return other
+	}
+	if other.IsZero() {
+		return s
+	}
+	return Span{File: s.File, Start: s.Start, End: other.End}
+}
+
+// IsZero reports whether the span was never set, e.g. for synthesized nodes.
+func (s Span) IsZero() bool {
+	return s == Span{}
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/Kori-Sama/kori-compiler/analysis"
+	"github.com/Kori-Sama/kori-compiler/cerr"
 	"github.com/Kori-Sama/kori-compiler/codegen"
 	"github.com/Kori-Sama/kori-compiler/lexer"
 	"github.com/Kori-Sama/kori-compiler/parser"
@@ -17,40 +19,45 @@ const (
 )
 
 func main() {
-	inputPath, outputPath := parse_args()
-
-//	fmt.Printf("Input path: %s\n", inputPath)
-//	fmt.Printf("Output path: %s\n", outputPath)
+	inputPath, outputPath, opts, emitTypes := parse_args()
 
 	input := read_file(inputPath)
 
+	diags := cerr.NewDiagnostics()
+
 	lexer := lexer.NewLexer(input)
+	lexer.File = inputPath
+	lexer.Diags = diags
 
 	tokens := lexer.ParseAll()
 
-	if lexer.Err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", lexer.Err)
-		os.Exit(1)
-	}
-
 	parser := parser.NewParser(tokens)
-	asts := parser.Parse()
+	parser.Diags = diags
+	prog := parser.Parse()
 
-	output, err := codegen.GenJsCode(asts)
+	if !diags.HasErrors() {
+		analysis.Check(prog, diags)
+	}
 
-	if parser.Err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", parser.Err)
-		os.Exit(1)
+	var output string
+	if !diags.HasErrors() && !emitTypes {
+		output = codegen.GenJsCodeWithOptions(prog, diags, opts)
 	}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", err)
+	emitter := cerr.NewEmitter(os.Stderr, cerr.ShouldColor(os.Stderr))
+	emitter.AddFile(inputPath, *input)
+	emitter.EmitAll(diags)
+
+	if diags.HasErrors() {
 		os.Exit(1)
 	}
 
-	output = squish(output)
+	if emitTypes {
+		fmt.Print(analysis.Signatures(prog))
+		return
+	}
 
-	err = os.WriteFile(outputPath, []byte(output), 0644)
+	err := os.WriteFile(outputPath, []byte(output), 0644)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
 		os.Exit(1)
@@ -78,11 +85,11 @@ func read_file(path string) *string {
 		os.Exit(1)
 	}
 
-	str := strings.TrimSpace(string(data))
+	str := string(data)
 	return &str
 }
 
-func parse_args() (inputPath string, outputPath string) {
+func parse_args() (inputPath string, outputPath string, opts codegen.Options, emitTypes bool) {
 	program := os.Args[0]
 
 	if len(os.Args) == 0 {
@@ -99,10 +106,26 @@ func parse_args() (inputPath string, outputPath string) {
 				os.Exit(1)
 			}
 			outputPath = os.Args[idx]
+		case "--maps=object":
+			opts.Maps = codegen.MAPS_OBJECT
+		case "--maps=map":
+			opts.Maps = codegen.MAPS_MAP
+		case "--emit=js":
+			emitTypes = false
+		case "--emit=types":
+			emitTypes = true
 		case "-h":
 			usage(os.Stdout, program)
 			os.Exit(0)
 		default:
+			if strings.HasPrefix(os.Args[idx], "--maps=") {
+				fmt.Fprintf(os.Stderr, "ERROR: Unknown map representation '%s', expected 'object' or 'map'\n", strings.TrimPrefix(os.Args[idx], "--maps="))
+				os.Exit(1)
+			}
+			if strings.HasPrefix(os.Args[idx], "--emit=") {
+				fmt.Fprintf(os.Stderr, "ERROR: Unknown output '%s', expected 'js' or 'types'\n", strings.TrimPrefix(os.Args[idx], "--emit="))
+				os.Exit(1)
+			}
 			inputPath = os.Args[idx]
 		}
 		idx++
@@ -118,16 +141,14 @@ func parse_args() (inputPath string, outputPath string) {
 		outputPath = prefix + OUTPUT_SUFFIX
 	}
 
-	return inputPath, outputPath
+	return inputPath, outputPath, opts, emitTypes
 }
 
 func usage(w io.Writer, program string) {
 	fmt.Fprintf(w, "Usage: %s [options] <input>\n", program)
 	fmt.Fprintf(w, "Options:\n")
 	fmt.Fprintf(w, "    -o <output>     Provide output path\n")
+	fmt.Fprintf(w, "    --maps=<repr>   Emit map literals as 'object' (default) or 'map'\n")
+	fmt.Fprintf(w, "    --emit=<kind>   Emit 'js' (default), or print the inferred 'types'\n")
 	fmt.Fprintf(w, "    -h              Show this help message\n")
 }
-
-func squish(s string) string {
-	return strings.Join(strings.Fields(s), " ")
-}
@@ -1,18 +1,67 @@
 package codegen
 
 import (
-	"errors"
-
+	"github.com/Kori-Sama/kori-compiler/cerr"
 	"github.com/Kori-Sama/kori-compiler/parser"
 )
 
-func GenJsCode(asts []*parser.FunctionAST) (target string, err error) {
-	if hasRepeatedFunc(asts) {
-		return "", errors.New("repeated function found")
+// MapRepr is the JavaScript representation of map literals.
+type MapRepr int
+
+const (
+	// MAPS_OBJECT emits plain objects, their keys are converted to strings.
+	MAPS_OBJECT MapRepr = iota
+	// MAPS_MAP emits Map objects, their keys keep their type.
+	MAPS_MAP
+)
+
+// Options control how GenJsCodeWithOptions emits a program.
+type Options struct {
+	Maps MapRepr
+}
+
+// GenJsCode generates the JavaScript program for prog with the default
+// options.
+func GenJsCode(prog *parser.Program, diags *cerr.Diagnostics) string {
+	return GenJsCodeWithOptions(prog, diags, Options{})
+}
+
+// GenJsCodeWithOptions generates the JavaScript program for prog, problems
+// that prevent a runnable program are reported to diags.
+//
+// Structs and enums are emitted first since classes and constants are not
+// hoisted, then globals in source order. main is called last, so every
+// global is initialized before main runs. Function declarations are hoisted
+// by JavaScript and may be called from global initializers, but only see the
+// globals declared before that initializer.
+func GenJsCodeWithOptions(prog *parser.Program, diags *cerr.Diagnostics, opts Options) (target string) {
+	checkRepeatedFunc(prog.Functions, diags)
+	checkGlobals(prog, diags)
+
+	if opts.Maps == MAPS_MAP {
+		useJsMaps(prog)
+	}
+
+	impls := make(map[string][]*parser.ImplAST)
+	for _, impl := range prog.Impls {
+		impls[impl.Name] = append(impls[impl.Name], impl)
+	}
+	for _, st := range prog.Structs {
+		target += st.CodegenClass(impls[st.Name]) + "\n"
+	}
+	for _, enum := range prog.Enums {
+		target += enum.Codegen() + "\n"
+	}
+
+	for _, global := range prog.Globals {
+		target += global.Codegen() + ";\n"
+	}
+	if len(prog.Globals) > 0 {
+		target += "\n"
 	}
 
 	hasMain := false
-	for _, ast := range asts {
+	for _, ast := range prog.Functions {
 		if ast == nil {
 			continue
 		}
@@ -24,22 +73,83 @@ func GenJsCode(asts []*parser.FunctionAST) (target string, err error) {
 	}
 
 	if !hasMain {
-		return "", errors.New("no main function found")
+		diags.Error(cerr.CODE_MISSING_MAIN, cerr.Span{}, "No main function found")
 	}
 
-	return target + "\nmain();\n", nil
+	return genRuntime(prog) + target + "\nmain();\n"
 }
 
-func hasRepeatedFunc(asts []*parser.FunctionAST) bool {
-	funcs := make(map[string]bool)
+func checkRepeatedFunc(asts []*parser.FunctionAST, diags *cerr.Diagnostics) {
+	funcs := make(map[string]*parser.FunctionAST)
 	for _, ast := range asts {
 		if ast == nil {
 			continue
 		}
-		if _, ok := funcs[ast.Proto.Name]; ok {
-			return true
+		if first, ok := funcs[ast.Proto.Name]; ok {
+			diags.Error(cerr.CODE_DUPLICATE_FUNCTION, ast.Proto.Span, "Function '%s' is defined more than once", ast.Proto.Name).
+				WithLabel(first.Proto.Span, "first defined here")
+			continue
+		}
+		funcs[ast.Proto.Name] = ast
+	}
+}
+
+// checkGlobals reports globals that reuse the name of a function or of an
+// earlier global, and constants whose initializer is not a constant
+// expression.
+func checkGlobals(prog *parser.Program, diags *cerr.Diagnostics) {
+	defined := make(map[string]cerr.Span)
+	for _, fn := range prog.Functions {
+		if _, ok := defined[fn.Proto.Name]; !ok {
+			defined[fn.Proto.Name] = fn.Proto.Span
+		}
+	}
+
+	consts := make(map[string]bool)
+	for _, global := range prog.Globals {
+		duplicate := false
+		for _, binding := range global.Bindings() {
+			if first, ok := defined[binding.Name]; ok {
+				diags.Error(cerr.CODE_DUPLICATE_GLOBAL, binding.Span, "'%s' is defined more than once", binding.Name).
+					WithLabel(first, "first defined here")
+				duplicate = true
+				continue
+			}
+			defined[binding.Name] = binding.Span
+		}
+
+		if duplicate || global.Kind != "const" {
+			continue
+		}
+		if !isConstant(global.Expr, consts) {
+			diags.Error(cerr.CODE_NOT_CONSTANT, global.Expr.GetSpan(), "Constant '%s' must be initialized with a constant expression", global.VarName).
+				WithNote("constants may only use literals, operators and other constants declared before them")
+			continue
+		}
+		consts[global.VarName] = true
+	}
+}
+
+// isConstant reports whether expr can be evaluated without running any code,
+// consts holds the constants that may be referenced.
+func isConstant(expr parser.Expr, consts map[string]bool) bool {
+	switch e := expr.(type) {
+	case *parser.NumberExpr, *parser.BooleanExpr, *parser.StringExpr:
+		return true
+	case *parser.InterpolatedStringExpr:
+		for _, part := range e.Exprs {
+			if !isConstant(part, consts) {
+				return false
+			}
 		}
-		funcs[ast.Proto.Name] = true
+		return true
+	case *parser.VariableExpr:
+		return consts[e.Name]
+	case *parser.UnaryExpr:
+		return isConstant(e.RHS, consts)
+	case *parser.BinaryExpr:
+		return isConstant(e.LHS, consts) && isConstant(e.RHS, consts)
+	default:
+		return false
 	}
-	return false
 }
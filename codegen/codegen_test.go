@@ -1,8 +1,10 @@
 package codegen
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/Kori-Sama/kori-compiler/cerr"
 	"github.com/Kori-Sama/kori-compiler/lexer"
 	"github.com/Kori-Sama/kori-compiler/parser"
 )
@@ -15,9 +17,394 @@ func TestCodegenJavascript(t *testing.T) {
 
 	res := parser.Parse()
 
-	for _, ast := range res {
+	for _, ast := range res.Functions {
 		t.Log(ast)
 	}
 
-	t.Log(GenJsCode(res))
+	diags := cerr.NewDiagnostics()
+	t.Log(GenJsCode(res, diags))
+	for _, diag := range diags.All() {
+		t.Log(diag)
+	}
+}
+
+func genJs(t *testing.T, src string) string {
+	t.Helper()
+	return genJsWithOptions(t, src, Options{})
+}
+
+func genJsWithOptions(t *testing.T, src string, opts Options) string {
+	t.Helper()
+
+	diags := cerr.NewDiagnostics()
+	lexer := lexer.NewLexer(&src)
+	lexer.Diags = diags
+
+	parser := parser.NewParser(lexer.ParseAll())
+	parser.Diags = diags
+	res := parser.Parse()
+
+	target := ""
+	if !diags.HasErrors() {
+		target = GenJsCodeWithOptions(res, diags, opts)
+	}
+
+	for _, diag := range diags.All() {
+		t.Fatal(diag)
+	}
+	return target
+}
+
+func TestCodegenStringEscapes(t *testing.T) {
+	tests := map[string]string{
+		`"plain"`:           `"plain"`,
+		`"quote \" here"`:   `"quote \" here"`,
+		`"back\\slash"`:     `"back\\slash"`,
+		`"tab\tnew\nline"`:  `"tab\tnew\nline"`,
+		`"multi  space"`:    `"multi  space"`,
+		`"nul\0 \u{2028}"`:  `"nul\u0000 \u2028"`,
+		`"emoji \u{1F600}"`: "\"emoji \U0001F600\"",
+		"\"raw\nnewline\"":  `"raw\nnewline"`,
+	}
+
+	for src, expected := range tests {
+		target := genJs(t, "func main() { println("+src+"); }")
+		if !strings.Contains(target, "console.log("+expected+")") {
+			t.Errorf("%s: expected %s in output, got %s", src, expected, target)
+		}
+	}
+}
+
+func TestCodegenInterpolatedString(t *testing.T) {
+	tests := map[string]string{
+		`"total: ${sum(a) * 2}"`:   "`total: ${(sum(a) * 2)}`",
+		`"${a}${"\n"}"`:            "`${a}${\"\\n\"}`",
+		"\"tick ` and \\${ ${x}\"": "`tick \\` and \\${ ${x}`",
+		`"nested ${"in ${x}"}"`:    "`nested ${`in ${x}`}`",
+	}
+
+	for src, expected := range tests {
+		target := genJs(t, "func main() { println("+src+"); }")
+		if !strings.Contains(target, "console.log("+expected+")") {
+			t.Errorf("%s: expected %s in output, got %s", src, expected, target)
+		}
+	}
+}
+
+func TestCodegenNumbers(t *testing.T) {
+	tests := map[string]string{
+		"0.1234567":                  "0.1234567",
+		"1_000_000":                  "1000000",
+		"0x1F":                       "31",
+		"0b1010":                     "10",
+		"0o17":                       "15",
+		"1e-9":                       "1e-09",
+		"2.5E+3":                     "2500",
+		"1e21":                       "1e+21",
+		"0.1":                        "0.1",
+		"9007199254740993":           "9007199254740992",
+		"0xFFFF_FFFF_FFFF_FFFF_FFFF": "1.2089258196146292e+24",
+	}
+
+	for src, expected := range tests {
+		target := genJs(t, "func main() { println("+src+"); }")
+		if !strings.Contains(target, "console.log("+expected+")") {
+			t.Errorf("%s: expected %s in output, got %s", src, expected, target)
+		}
+	}
+}
+
+func TestCodegenReportsProgramErrors(t *testing.T) {
+	src := "func foo() { 1; } func foo() { 2; }"
+	diags := cerr.NewDiagnostics()
+	lexer := lexer.NewLexer(&src)
+	parser := parser.NewParser(lexer.ParseAll())
+
+	GenJsCode(parser.Parse(), diags)
+
+	codes := []cerr.Code{}
+	for _, diag := range diags.All() {
+		codes = append(codes, diag.Code)
+	}
+	if len(codes) != 2 || codes[0] != cerr.CODE_DUPLICATE_FUNCTION || codes[1] != cerr.CODE_MISSING_MAIN {
+		t.Errorf("Expected duplicate function and missing main, got %v", codes)
+	}
+
+	dup := diags.All()[0]
+	if dup.Span.Start.Column != 23 || len(dup.Labels) != 1 || dup.Labels[0].Span.Start.Column != 5 {
+		t.Errorf("Expected duplicate at column 23 with a label at column 5, got %v", dup)
+	}
+}
+
+func TestCodegenElseIf(t *testing.T) {
+	tests := map[string]string{
+		"if a { 1; } else if b { 2; }":                  "if (a) { 1; } else if (b) { 2; }",
+		"if a { 1; } else if b { 2; } else { 3; }":      "if (a) { 1; } else if (b) { 2; } else { 3; }",
+		"if a { 1; } else /* c */ if b { 2; } else {}":  "if (a) { 1; } else if (b) { 2; } else {  }",
+		"if a { 1; } else if b {} else if c { 3; }":     "if (a) { 1; } else if (b) {  } else if (c) { 3; }",
+		"if a { 1; }\nelse\n{ 2; }":                     "if (a) { 1; } else { 2; }",
+		"if a { if b { 1; } else { 2; } } else if c {}": "if (a) { if (b) { 1; } else { 2; }; } else if (c) {  }",
+	}
+
+	for src, expected := range tests {
+		target := genJs(t, "func main() { "+src+" }")
+		if !strings.Contains(target, expected) {
+			t.Errorf("%s: expected %s in output, got %s", src, expected, target)
+		}
+	}
+}
+
+func TestCodegenOperators(t *testing.T) {
+	tests := map[string]string{
+		"1 != 2":              "(1 != 2)",
+		"7 % 3 * 2":           "((7 % 3) * 2)",
+		"1 + 2 * 3 % 4":       "(1 + ((2 * 3) % 4))",
+		"2 ** 3 ** 2":         "(2 ** (3 ** 2))",
+		"2 * 3 ** 2":          "(2 * (3 ** 2))",
+		"-2 ** 2":             "(- (2 ** 2))",
+		"2 ** -1":             "(2 ** (- 1))",
+		"-a * b":              "((- a) * b)",
+		"+a - ~b":             "((+ a) - (~ b))",
+		"!a == b":             "((! a) == b)",
+		"1 << 2 + 1":          "(1 << (2 + 1))",
+		"a >> 1 < b":          "((a >> 1) < b)",
+		"a & 1 == 0":          "(a & (1 == 0))",
+		"a | b ^ c & d":       "(a | (b ^ (c & d)))",
+		"a || b && c":         "(a || (b && c))",
+		"a == b && c != d":    "((a == b) && (c != d))",
+		"a < b == c >= d":     "((a < b) == (c >= d))",
+		"a - b - c":           "((a - b) - c)",
+		"a / b / c":           "((a / b) / c)",
+		"- -a":                "(- (- a))",
+		"a || b | c && d ^ e": "(a || ((b | c) && (d ^ e)))",
+	}
+
+	for src, expected := range tests {
+		target := genJs(t, "func main() { println("+src+"); }")
+		if !strings.Contains(target, "console.log("+expected+")") {
+			t.Errorf("%s: expected %s in output, got %s", src, expected, target)
+		}
+	}
+}
+
+func TestCodegenGlobals(t *testing.T) {
+	src := `const size = 2 ** 3;
+const label = "size: ${size}";
+func main() { println(label, names); }
+let names = ["a", "b"];
+var count = size + 1;`
+	expected := `const size = (2 ** 3);
+const label = ` + "`size: ${size}`" + `;
+const names = ["a", "b"];
+let count = (size + 1);
+
+function main() { console.log(label, names); }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenGlobalErrors(t *testing.T) {
+	tests := map[string]cerr.Code{
+		"const a = f(); func f() { 1; }":      cerr.CODE_NOT_CONSTANT,
+		"const a = b; const b = 1;":           cerr.CODE_NOT_CONSTANT,
+		"let b = 1; const a = b;":             cerr.CODE_NOT_CONSTANT,
+		"const a = [1];":                      cerr.CODE_NOT_CONSTANT,
+		"let a = 1; var a = 2;":               cerr.CODE_DUPLICATE_GLOBAL,
+		"func a() { 1; } let a = 1;":          cerr.CODE_DUPLICATE_GLOBAL,
+		"let main = 1; func main() { main; }": cerr.CODE_DUPLICATE_GLOBAL,
+	}
+
+	for src, code := range tests {
+		diags := cerr.NewDiagnostics()
+		lexer := lexer.NewLexer(&src)
+		parser := parser.NewParser(lexer.ParseAll())
+
+		GenJsCode(parser.Parse(), diags)
+
+		if len(diags.All()) == 0 || diags.All()[0].Code != code {
+			t.Errorf("%s: expected %s, got %v", src, code, diags.All())
+		}
+	}
+}
+
+func TestCodegenStructs(t *testing.T) {
+	src := `struct Point { x, y }
+func main() {
+    var p = Point { y: 2, x: 1 };
+    p.x += 1;
+    p.y = Point {x: 0, y: 0}.x;
+}`
+	expected := `class Point { constructor(fields) { this.x = fields.x; this.y = fields.y; } }
+function main() { let p = new Point({ y: 2, x: 1 });p.x += 1;p.y = new Point({ x: 0, y: 0 }).x; }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenMethods(t *testing.T) {
+	src := `struct Counter { n }
+impl Counter {
+    func new() { return Counter { n: 0 }; }
+    func add(self, k) { self.n += k; return self; }
+}
+func main() { println(Counter.new().add(2).add(3).n); }`
+	expected := `class Counter { constructor(fields) { this.n = fields.n; } ` +
+		`static new() { return new Counter({ n: 0 }); } ` +
+		`add(k) { const self = this; self.n += k;return self; } }
+function main() { console.log(Counter.new().add(2).add(3).n); }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenEnums(t *testing.T) {
+	src := `enum Opt { Some(v), None }
+func main() {
+    let v = match Opt.Some(1) { Opt.Some(x) if x > 0 => x, _ => 0 };
+    match Opt.None { Opt.None => println("none"), _ => {} }
+}`
+	expected := `const Opt = { Some: ($0) => ({ $tag: "Some", $0 }), None: { $tag: "None" } };
+function main() { ` +
+		`const v = (($m0) => { if ($m0.$tag === "Some") { const x = $m0.$0; if ((x > 0)) { return x; } } { return 0; } })(Opt.Some(1));` +
+		`$match0: { const $m0 = Opt.None; if ($m0.$tag === "None") { console.log("none"); break $match0; } { break $match0; } }; }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenPostfix(t *testing.T) {
+	src := `func main() {
+    var grid = [[1]];
+    grid[0][0] += f(1)(2);
+    [func(x) { return x; }][0](1);
+    (func() { return [1]; })()[0];
+}`
+	expected := `function main() { let grid = [[1]];grid[0][0] += f(1)(2);[(x) => { return x; }][0](1);(() => { return [1]; })()[0]; }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenLoops(t *testing.T) {
+	src := `func main() {
+    outer: while true {
+        for x in [1] { if x > 0 { continue outer; } break; }
+    }
+}`
+	expected := `function main() { outer: while (true) { for (let x of [1]) { if ((x > 0)) { continue outer; };break; }; }; }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenMaps(t *testing.T) {
+	src := `func main() {
+    let m = #{ "a": 1, k: 2 };
+    m["a"] += 1;
+    for k, v in m { println(has(m, k), m[k]); }
+}`
+	tests := map[MapRepr]string{
+		MAPS_OBJECT: `const $has = (c, k) => c instanceof Map ? c.has(k) : Object.hasOwn(c, k);
+const $entries = (c) => c instanceof Map || Array.isArray(c) ? c.entries() : Object.entries(c);
+function main() { const m = { "a": 1, [k]: 2 };m["a"] += 1;for (let [k, v] of $entries(m)) { console.log($has(m, k), m[k]); }; }
+
+main();
+`,
+		MAPS_MAP: `const $get = (c, k) => c instanceof Map ? c.get(k) : c[k];
+const $set = (c, k, v) => c instanceof Map ? (c.set(k, v), v) : (c[k] = v);
+const $has = (c, k) => c instanceof Map ? c.has(k) : Object.hasOwn(c, k);
+const $entries = (c) => c instanceof Map || Array.isArray(c) ? c.entries() : Object.entries(c);
+function main() { const m = new Map([["a", 1], [k, 2]]);(($c, $k) => $set($c, $k, $get($c, $k) + 1))(m, "a");for (let [k, v] of $entries(m)) { console.log($has(m, k), $get(m, k)); }; }
+
+main();
+`,
+	}
+
+	for maps, expected := range tests {
+		if target := genJsWithOptions(t, src, Options{Maps: maps}); target != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+		}
+	}
+}
+
+func TestCodegenNoMapsNoRuntime(t *testing.T) {
+	src := "func main() { let a = [1]; a[0] = 2; }"
+	expected := `function main() { const a = [1];a[0] = 2; }
+
+main();
+`
+	if target := genJsWithOptions(t, src, Options{Maps: MAPS_MAP}); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenRuntimeNotInStrings(t *testing.T) {
+	src := `func main() { let k = "has"; println("$get(m, k)", "${k}: $range(0, 1)"); for i in 0..3 { println(i); } }`
+	expected := `function main() { const k = "has";console.log("$get(m, k)", ` + "`${k}: $range(0, 1)`" + `);for (let i = 0; i < 3; i++) { console.log(i); }; }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenRanges(t *testing.T) {
+	src := `func main() {
+    for i in 0..len(a) { }
+    for i, x in 1..=3 { }
+    a[1..n];
+    s[..=2];
+    a[2..];
+    let r = 0..3;
+}`
+	expected := `const $range = (start, end) => Array.from({ length: Math.max(0, Math.ceil(end - start)) }, (_, i) => start + i);
+function main() { for (let i = 0, $end = a.length; i < $end; i++) {  };for (let i = 0, x = 1; x <= 3; i++, x++) {  };a.slice(1, n);s.slice(0, 2 + 1);a.slice(2);const r = $range(0, 3); }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
+}
+
+func TestCodegenDestructuring(t *testing.T) {
+	src := `struct Point { x, y }
+func main() {
+    let [a, _, ..rest] = [1, 2, 3];
+    var [_, b, _, ..] = [1, 2, 3];
+    let Point { x, y: [c, _], } = p;
+    let Point { x: _ } = p;
+    for [i, v] in enumerate(xs) {}
+    for [s, e] in 0..3 {}
+}`
+	expected := `const $range = (start, end) => Array.from({ length: Math.max(0, Math.ceil(end - start)) }, (_, i) => start + i);
+const $enumerate = (c) => Array.from(c instanceof Map || Array.isArray(c) || typeof c === "string" ? c : Object.entries(c), (v, i) => [i, v]);
+class Point { constructor(fields) { this.x = fields.x; this.y = fields.y; } }
+function main() { const [a, , ...rest] = [1, 2, 3];let [, b] = [1, 2, 3];const { x, y: [c] } = p;const {} = p;for (let [i, v] of $enumerate(xs)) {  };for (let [s, e] of $range(0, 3)) {  }; }
+
+main();
+`
+	if target := genJs(t, src); target != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, target)
+	}
 }
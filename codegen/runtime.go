@@ -0,0 +1,72 @@
+package codegen
+
+import (
+	"github.com/Kori-Sama/kori-compiler/parser"
+)
+
+// runtime holds the JavaScript helpers generated code may call. Their names
+// start with '$', which no identifier of the language can, and only the
+// helpers a program calls are emitted.
+//
+// The helpers take maps of either representation as well as arrays, since
+// values are untyped and a program emitted with Maps may still index arrays.
+var runtime = []struct {
+	name string
+	code string
+}{
+	{"$get", "const $get = (c, k) => c instanceof Map ? c.get(k) : c[k];"},
+	{"$set", "const $set = (c, k, v) => c instanceof Map ? (c.set(k, v), v) : (c[k] = v);"},
+	{"$has", "const $has = (c, k) => c instanceof Map ? c.has(k) : Object.hasOwn(c, k);"},
+	{"$keys", "const $keys = (c) => c instanceof Map || Array.isArray(c) ? [...c.keys()] : Object.keys(c);"},
+	{"$values", "const $values = (c) => c instanceof Map || Array.isArray(c) ? [...c.values()] : Object.values(c);"},
+	{"$range", "const $range = (start, end) => Array.from({ length: Math.max(0, Math.ceil(end - start)) }, (_, i) => start + i);"},
+	{"$enumerate", "const $enumerate = (c) => Array.from(c instanceof Map || Array.isArray(c) || typeof c === \"string\" ? c : Object.entries(c), (v, i) => [i, v]);"},
+	{"$entries", "const $entries = (c) => c instanceof Map || Array.isArray(c) ? c.entries() : Object.entries(c);"},
+}
+
+// genRuntime returns the helpers called by the code generated for prog, as
+// recorded by the expressions that call them.
+func genRuntime(prog *parser.Program) string {
+	used := make(map[string]bool)
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		for _, name := range expr.Helpers() {
+			used[name] = true
+		}
+		return true
+	})
+
+	code := ""
+	for _, helper := range runtime {
+		if used[helper.name] {
+			code += helper.code + "\n"
+		}
+	}
+	return code
+}
+
+// useJsMaps emits the map literals of prog as Maps. Indexing a Map needs a
+// method call, so if prog has any map literal every index goes through the
+// runtime.
+func useJsMaps(prog *parser.Program) {
+	var maps []*parser.MapExpr
+	var indexes []*parser.IndexExpr
+	parser.InspectProgram(prog, func(expr parser.Expr) bool {
+		switch e := expr.(type) {
+		case *parser.MapExpr:
+			maps = append(maps, e)
+		case *parser.IndexExpr:
+			indexes = append(indexes, e)
+		}
+		return true
+	})
+
+	if len(maps) == 0 {
+		return
+	}
+	for _, m := range maps {
+		m.JsMap = true
+	}
+	for _, index := range indexes {
+		index.Dynamic = true
+	}
+}
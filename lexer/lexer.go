@@ -1,19 +1,47 @@
 package lexer
 
-import "github.com/Kori-Sama/kori-compiler/cerr"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+)
 
 type Lexer struct {
-	Err     *cerr.LexerError
-	content *string
-	current int
-	line    int
-	linePos int
-	ch      byte
+	// Diags receives every problem found while lexing, the lexer reports and
+	// keeps going so that a single run finds as many as possible.
+	Diags *cerr.Diagnostics
+	// File is the name recorded in the position of every token.
+	File string
+	// KeepComments makes Next return comments as TOKEN_COMMENT instead of
+	// skipping them, for tools that need to preserve them.
+	KeepComments bool
+	content      *string
+	current      int
+	line         int
+	linePos      int
+	ch           rune
+	// interps holds one entry per string interpolation we are inside of.
+	interps []interpolation
+	// peeking silences diagnostics while PeekToken looks ahead, the token
+	// is lexed again and reported then if it does not match.
+	peeking bool
+}
+
+type interpolation struct {
+	// braces counts the '{' opened inside the embedded expression, the '}'
+	// that closes the interpolation is the one seen while it is zero.
+	braces int
+	// quote is the offset of the opening quote of the string.
+	quote int
 }
 
 func NewLexer(content *string) *Lexer {
 	return &Lexer{
-		Err:     nil,
+		Diags:   cerr.NewDiagnostics(),
 		content: content,
 		current: 0,
 		line:    0,
@@ -27,7 +55,7 @@ func (l *Lexer) ParseAll() []*Token {
 	for {
 		token := l.Next()
 		tokens = append(tokens, token)
-		if token.Kind == TOKEN_EOF || token.Kind == TOKEN_ILLEGAL {
+		if token.Kind == TOKEN_EOF {
 			break
 		}
 	}
@@ -40,37 +68,134 @@ func (l *Lexer) Next() *Token {
 
 	var token *Token
 
-	if l.current >= len(*text) {
-		token = NewToken(TOKEN_EOF, "")
-		return token
-	}
-
-	l.ch = (*text)[l.current]
-	if isWhitespace(l.ch) {
+	for {
 		l.SkipWhitespace()
+
+		if l.current >= len(*text) {
+			if len(l.interps) > 0 {
+				quote := l.interps[0].quote
+				l.interps = nil
+				l.report(cerr.CODE_UNTERMINATED_STRING, quote, quote+1, "Unterminated string interpolation")
+				return l.finish(NewToken(TOKEN_ILLEGAL, "EOF"), l.current)
+			}
+			return l.finish(NewToken(TOKEN_EOF, ""), l.current)
+		}
+
+		if !l.isCommentStart() {
+			break
+		}
+
+		token = l.readComment()
+		if token.Kind == TOKEN_ILLEGAL || l.KeepComments {
+			return token
+		}
 	}
 
-	line := l.line
-	pos := l.current - l.linePos
+	l.ch, _ = utf8.DecodeRuneInString((*text)[l.current:])
+
+	start := l.current
 
-	if isLetter(l.ch) {
+	if isIdentStart(l.ch) {
 		token = l.readName()
-	} else if isDigit(l.ch) {
+	} else if l.ch < utf8.RuneSelf && isDigit(byte(l.ch)) {
 		token = l.readNumber()
 	} else if l.ch == '"' {
 		token = l.readString()
 	} else {
 		token = l.readSymbol()
 		if token.Kind == TOKEN_ILLEGAL {
-			l.Err = cerr.NewLexerError("Illegal character", l.line, l.current-l.linePos)
+			l.report(cerr.CODE_ILLEGAL_CHARACTER, start, l.current, "Illegal character '%s'", token.Literal)
 		}
 	}
 
-	token.Line = line
-	token.Location = pos
+	return l.finish(token, start)
+}
+
+// finish records the position of a token that starts at offset start and
+// ends at the cursor.
+func (l *Lexer) finish(token *Token, start int) *Token {
+	pos := l.posAt(start)
+	token.File = l.File
+	token.Line = pos.Line
+	token.Location = pos.Column
+	token.Offset = start
+	token.End = l.posAt(l.current)
 	return token
 }
 
+func (l *Lexer) report(code cerr.Code, start, end int, format string, args ...any) {
+	if l.peeking {
+		return
+	}
+	l.Diags.Error(code, cerr.Span{File: l.File, Start: l.posAt(start), End: l.posAt(end)}, format, args...)
+}
+
+// posAt converts a byte offset at or before the cursor to a position. Columns
+// are counted in runes so they stay right on lines with non-ASCII text.
+func (l *Lexer) posAt(offset int) cerr.Pos {
+	text := *l.content
+	line, lineStart := l.line, l.linePos
+	for offset < lineStart {
+		line--
+		lineStart = strings.LastIndexByte(text[:lineStart-1], '\n') + 1
+	}
+	return cerr.Pos{Offset: offset, Line: line, Column: utf8.RuneCountInString(text[lineStart:offset])}
+}
+
+func (l *Lexer) isCommentStart() bool {
+	text := *l.content
+	if l.current+1 >= len(text) || text[l.current] != '/' {
+		return false
+	}
+	next := text[l.current+1]
+	return next == '/' || next == '*'
+}
+
+// readComment reads a line comment up to the end of the line, or a block
+// comment up to its matching "*/". Block comments nest.
+func (l *Lexer) readComment() *Token {
+	text := *l.content
+	start := l.current
+
+	var token *Token
+	if text[l.current+1] == '/' {
+		for l.current < len(text) && text[l.current] != '\n' {
+			l.current++
+		}
+		token = NewToken(TOKEN_COMMENT, text[start:l.current])
+	} else {
+		l.current += 2
+		depth := 1
+		for depth > 0 {
+			if l.current >= len(text) {
+				l.report(cerr.CODE_UNTERMINATED_COMMENT, start, start+2, "Unterminated block comment")
+				token = NewToken(TOKEN_ILLEGAL, text[start:])
+				break
+			}
+
+			switch {
+			case strings.HasPrefix(text[l.current:], "/*"):
+				depth++
+				l.current += 2
+			case strings.HasPrefix(text[l.current:], "*/"):
+				depth--
+				l.current += 2
+			default:
+				if text[l.current] == '\n' {
+					l.line++
+					l.linePos = l.current + 1
+				}
+				l.current++
+			}
+		}
+		if token == nil {
+			token = NewToken(TOKEN_COMMENT, text[start:l.current])
+		}
+	}
+
+	return l.finish(token, start)
+}
+
 func (l *Lexer) readSymbol() *Token {
 	l.current++
 	switch l.ch {
@@ -78,6 +203,9 @@ func (l *Lexer) readSymbol() *Token {
 		if l.peekChar('=') {
 			return NewToken(TOKEN_EQ, "==")
 		}
+		if l.peekChar('>') {
+			return NewToken(TOKEN_FAT_ARROW, "=>")
+		}
 		return NewToken(TOKEN_ASSIGN, "=")
 	case '!':
 		if l.peekChar('=') {
@@ -85,11 +213,17 @@ func (l *Lexer) readSymbol() *Token {
 		}
 		return NewToken(TOKEN_BANG, "!")
 	case '<':
+		if l.peekChar('<') {
+			return NewToken(TOKEN_SHIFT_LEFT, "<<")
+		}
 		if l.peekChar('=') {
 			return NewToken(TOKEN_LESS_EQ, "<=")
 		}
 		return NewToken(TOKEN_LESS, "<")
 	case '>':
+		if l.peekChar('>') {
+			return NewToken(TOKEN_SHIFT_RIGHT, ">>")
+		}
 		if l.peekChar('=') {
 			return NewToken(TOKEN_GREATER_EQ, ">=")
 		}
@@ -99,9 +233,28 @@ func (l *Lexer) readSymbol() *Token {
 	case ':':
 		return NewToken(TOKEN_COLON, ":")
 	case '{':
+		if len(l.interps) > 0 {
+			l.interps[len(l.interps)-1].braces++
+		}
 		return NewToken(TOKEN_LBRACE, "{")
 	case '}':
+		if len(l.interps) > 0 {
+			top := &l.interps[len(l.interps)-1]
+			if top.braces == 0 {
+				l.interps = l.interps[:len(l.interps)-1]
+				return l.readStringPart(top.quote, true)
+			}
+			top.braces--
+		}
 		return NewToken(TOKEN_RBRACE, "}")
+	case '#':
+		if !l.peekChar('{') {
+			return NewToken(TOKEN_ILLEGAL, "#")
+		}
+		if len(l.interps) > 0 {
+			l.interps[len(l.interps)-1].braces++
+		}
+		return NewToken(TOKEN_HASH_LBRACE, "#{")
 	case '[':
 		return NewToken(TOKEN_LBRACKET, "[")
 	case ']':
@@ -112,6 +265,14 @@ func (l *Lexer) readSymbol() *Token {
 		return NewToken(TOKEN_RPAREN, ")")
 	case ',':
 		return NewToken(TOKEN_COMMA, ",")
+	case '.':
+		if l.peekChar('.') {
+			if l.peekChar('=') {
+				return NewToken(TOKEN_DOT_DOT_EQ, "..=")
+			}
+			return NewToken(TOKEN_DOT_DOT, "..")
+		}
+		return NewToken(TOKEN_DOT, ".")
 	case '+':
 		if l.peekChar('=') {
 			return NewToken(TOKEN_PLUS_EQ, "+=")
@@ -121,6 +282,9 @@ func (l *Lexer) readSymbol() *Token {
 		if l.peekChar('=') {
 			return NewToken(TOKEN_MINUS_EQ, "-=")
 		}
+		if l.peekChar('>') {
+			return NewToken(TOKEN_ARROW, "->")
+		}
 		return NewToken(TOKEN_MINUS, "-")
 	case '/':
 		if l.peekChar('=') {
@@ -128,10 +292,19 @@ func (l *Lexer) readSymbol() *Token {
 		}
 		return NewToken(TOKEN_SLASH, "/")
 	case '*':
+		if l.peekChar('*') {
+			return NewToken(TOKEN_STAR_STAR, "**")
+		}
 		if l.peekChar('=') {
 			return NewToken(TOKEN_STAR_EQ, "*=")
 		}
 		return NewToken(TOKEN_STAR, "*")
+	case '%':
+		return NewToken(TOKEN_PERCENT, "%")
+	case '^':
+		return NewToken(TOKEN_CARET, "^")
+	case '~':
+		return NewToken(TOKEN_TILDE, "~")
 	case '&':
 		if l.peekChar('&') {
 			return NewToken(TOKEN_LOGICAL_AND, "&&")
@@ -143,6 +316,7 @@ func (l *Lexer) readSymbol() *Token {
 		}
 		return NewToken(TOKEN_OR, "|")
 	default:
+		l.current += utf8.RuneLen(l.ch) - 1
 		return NewToken(TOKEN_ILLEGAL, string(l.ch))
 	}
 }
@@ -153,6 +327,8 @@ func (l *Lexer) readKeyword(name string) *Token {
 		return NewToken(TOKEN_LET, "let")
 	case "var":
 		return NewToken(TOKEN_VAR, "var")
+	case "const":
+		return NewToken(TOKEN_CONST, "const")
 	case "func":
 		return NewToken(TOKEN_FUNC, "func")
 	case "return":
@@ -172,28 +348,125 @@ func (l *Lexer) readKeyword(name string) *Token {
 		return NewToken(TOKEN_FOR, "for")
 	case "in":
 		return NewToken(TOKEN_IN, "in")
+	case "while":
+		return NewToken(TOKEN_WHILE, "while")
+	case "break":
+		return NewToken(TOKEN_BREAK, "break")
+	case "continue":
+		return NewToken(TOKEN_CONTINUE, "continue")
 	case "struct":
 		return NewToken(TOKEN_STRUCT, "struct")
+	case "impl":
+		return NewToken(TOKEN_IMPL, "impl")
+	case "enum":
+		return NewToken(TOKEN_ENUM, "enum")
+	case "match":
+		return NewToken(TOKEN_MATCH, "match")
 	default:
 		return nil
 	}
 }
 
+// readString reads a double quoted string literal and decodes its escape
+// sequences, the literal of the returned token is the decoded value.
 func (l *Lexer) readString() *Token {
-	text := l.content
+	quote := l.current
 	l.current++
-	start := l.current
+	return l.readStringPart(quote, false)
+}
+
+// readStringPart reads string content up to the closing quote or up to the
+// next "${". resumed tells whether we are continuing a string after an
+// interpolation, quote is the offset of its opening quote.
+func (l *Lexer) readStringPart(quote int, resumed bool) *Token {
+	text := *l.content
+
+	var value strings.Builder
 	for {
-		if l.current >= len(*text) {
+		if l.current >= len(text) {
+			l.report(cerr.CODE_UNTERMINATED_STRING, quote, quote+1, "Unterminated string")
 			return NewToken(TOKEN_ILLEGAL, "EOF")
 		}
-		if (*text)[l.current] == '"' {
-			break
+
+		ch := text[l.current]
+		if ch == '"' {
+			l.current++
+			if resumed {
+				return NewToken(TOKEN_STRING_TAIL, value.String())
+			}
+			return NewToken(TOKEN_STRING, value.String())
+		}
+
+		if strings.HasPrefix(text[l.current:], "${") {
+			l.current += 2
+			l.interps = append(l.interps, interpolation{quote: quote})
+			if resumed {
+				return NewToken(TOKEN_STRING_MIDDLE, value.String())
+			}
+			return NewToken(TOKEN_STRING_HEAD, value.String())
+		}
+
+		if ch == '\\' {
+			if r, ok := l.readEscape(); ok {
+				value.WriteRune(r)
+			}
+			continue
+		}
+
+		if ch == '\n' {
+			l.line++
+			l.linePos = l.current + 1
 		}
+		value.WriteByte(ch)
 		l.current++
 	}
-	l.current++
-	return NewToken(TOKEN_STRING, (*text)[start:l.current-1])
+}
+
+// readEscape decodes the escape sequence starting at the backslash under the
+// cursor and moves past it. An invalid escape is reported and skipped.
+func (l *Lexer) readEscape() (rune, bool) {
+	text := *l.content
+	start := l.current
+
+	if start+1 >= len(text) {
+		l.current++
+		l.report(cerr.CODE_INVALID_ESCAPE, start, l.current, "Unterminated escape sequence")
+		return 0, false
+	}
+
+	l.current += 2
+	switch text[start+1] {
+	case '"':
+		return '"', true
+	case '\\':
+		return '\\', true
+	case '$':
+		return '$', true
+	case 'n':
+		return '\n', true
+	case 't':
+		return '\t', true
+	case 'r':
+		return '\r', true
+	case '0':
+		return 0, true
+	case 'u':
+		end := strings.IndexByte(text[l.current:], '}')
+		if !strings.HasPrefix(text[l.current:], "{") || end < 2 || end > 7 {
+			break
+		}
+		code, err := strconv.ParseUint(text[l.current+1:l.current+end], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			break
+		}
+		l.current += end + 1
+		return rune(code), true
+	}
+
+	_, size := utf8.DecodeRuneInString(text[start+1:])
+	l.current = start + 1 + size
+	l.report(cerr.CODE_INVALID_ESCAPE, start, l.current, "Invalid escape sequence '%s'", text[start:l.current])
+	return 0, false
 }
 
 func (l *Lexer) readName() *Token {
@@ -201,11 +474,11 @@ func (l *Lexer) readName() *Token {
 	start := l.current
 
 	for l.current < len(*text) {
-		ch := (*text)[l.current]
-		if !isLetter(ch) {
+		r, size := utf8.DecodeRuneInString((*text)[l.current:])
+		if !isIdentContinue(r) {
 			break
 		}
-		l.current++
+		l.current += size
 	}
 
 	name := (*text)[start:l.current]
@@ -217,19 +490,128 @@ func (l *Lexer) readName() *Token {
 	return NewToken(TOKEN_NAME, name)
 }
 
+// readNumber reads a decimal literal with an optional fraction and exponent,
+// or a 0x, 0b or 0o prefixed integer. '_' may separate digits. The literal of
+// the returned token is the source text, it is converted by the parser.
 func (l *Lexer) readNumber() *Token {
-	text := l.content
+	text := *l.content
 	start := l.current
 
-	for l.current < len(*text) {
-		ch := (*text)[l.current]
-		if !isDigit(ch) && ch != '.' {
+	base := 10
+	if text[start] == '0' && start+1 < len(text) {
+		switch text[start+1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		case 'o', 'O':
+			base = 8
+		}
+	}
+
+	if base != 10 {
+		l.current += 2
+		n, ok := l.readDigits(base)
+		if !ok {
+			return NewToken(TOKEN_ILLEGAL, text[start:l.current])
+		}
+		if n == 0 {
+			return l.numberError(fmt.Sprintf("Expected digits after '%s'", text[start:start+2]))
+		}
+	} else {
+		if _, ok := l.readDigits(10); !ok {
+			return NewToken(TOKEN_ILLEGAL, text[start:l.current])
+		}
+
+		if l.current+1 < len(text) && text[l.current] == '.' && isDigit(text[l.current+1]) {
+			l.current++
+			if _, ok := l.readDigits(10); !ok {
+				return NewToken(TOKEN_ILLEGAL, text[start:l.current])
+			}
+		}
+
+		if l.current < len(text) && (text[l.current] == 'e' || text[l.current] == 'E') {
+			l.current++
+			if l.current < len(text) && (text[l.current] == '+' || text[l.current] == '-') {
+				l.current++
+			}
+			n, ok := l.readDigits(10)
+			if !ok {
+				return NewToken(TOKEN_ILLEGAL, text[start:l.current])
+			}
+			if n == 0 {
+				return l.numberError("Expected digits in exponent")
+			}
+		}
+	}
+
+	if l.current < len(text) {
+		ch := text[l.current]
+		if isDigit(ch) {
+			return l.numberError(fmt.Sprintf("Invalid digit '%c' in base %d literal", ch, base))
+		}
+		if r, _ := utf8.DecodeRuneInString(text[l.current:]); isIdentContinue(r) {
+			return l.numberError(fmt.Sprintf("Unexpected '%c' in number literal", r))
+		}
+		if ch == '.' && l.current+1 < len(text) && isDigit(text[l.current+1]) {
+			return l.numberError(fmt.Sprintf("Unexpected '%c' in number literal", ch))
+		}
+	}
+
+	return NewToken(TOKEN_NUMBER, text[start:l.current])
+}
+
+// readDigits reads digits of the given base, a single '_' may separate two
+// digits. It returns how many digits were read, ok is false when a misplaced
+// '_' was reported.
+func (l *Lexer) readDigits(base int) (n int, ok bool) {
+	text := *l.content
+
+	for l.current < len(text) {
+		ch := text[l.current]
+		if ch == '_' {
+			if n == 0 || l.current+1 >= len(text) || !isDigitOf(text[l.current+1], base) {
+				l.numberError("'_' must separate digits in number literal")
+				return n, false
+			}
+			l.current++
+			continue
+		}
+		if !isDigitOf(ch, base) {
 			break
 		}
 		l.current++
+		n++
 	}
 
-	return NewToken(TOKEN_NUMBER, (*text)[start:l.current])
+	return n, true
+}
+
+// numberError reports a malformed number literal at the cursor and skips the
+// rest of the literal, so that it does not show up as further tokens.
+func (l *Lexer) numberError(message string) *Token {
+	text := *l.content
+	start := l.current
+
+	end := start
+	if end < len(text) {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	l.report(cerr.CODE_INVALID_NUMBER, start, end, "%s", message)
+
+	for l.current < len(text) {
+		r, size := utf8.DecodeRuneInString(text[l.current:])
+		if !isIdentContinue(r) && r != '.' {
+			break
+		}
+		if r == '.' && (l.current+1 >= len(text) || !isDigit(text[l.current+1])) {
+			break
+		}
+		l.current += size
+	}
+
+	return NewToken(TOKEN_ILLEGAL, text[start:l.current])
 }
 
 func (l *Lexer) SkipWhitespace() {
@@ -248,15 +630,18 @@ func (l *Lexer) SkipWhitespace() {
 
 		l.current++
 	}
-
-	l.ch = (*text)[l.current]
 }
 
 func (l *Lexer) PeekToken(expect TokenKind) bool {
-	start := l.current
+	start, line, linePos, ch := l.current, l.line, l.linePos, l.ch
+	interps := append([]interpolation(nil), l.interps...)
+	l.peeking = true
 	token := l.Next()
+	l.peeking = false
 	if token.Kind != expect {
-		l.current = start
+		// Skipping whitespace may have counted newlines, rewind them too.
+		l.current, l.line, l.linePos, l.ch = start, line, linePos, ch
+		l.interps = interps
 		return false
 	}
 	return true
@@ -274,14 +659,48 @@ func (l *Lexer) peekChar(expect byte) bool {
 	return true
 }
 
-func isLetter(ch byte) bool {
-	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
+// isIdentStart follows XID_Start and also accepts '_'. Identifiers are not
+// NFKC normalized, so the few characters where XID_Start and ID_Start differ
+// are accepted as they are.
+func isIdentStart(r rune) bool {
+	if r == '_' {
+		return true
+	}
+	if unicode.Is(unicode.Pattern_Syntax, r) || unicode.Is(unicode.Pattern_White_Space, r) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.Is(unicode.Nl, r) || unicode.Is(unicode.Other_ID_Start, r)
+}
+
+// isIdentContinue follows XID_Continue, so digits are allowed after the first
+// character of an identifier.
+func isIdentContinue(r rune) bool {
+	if isIdentStart(r) {
+		return true
+	}
+	if unicode.Is(unicode.Pattern_Syntax, r) || unicode.Is(unicode.Pattern_White_Space, r) {
+		return false
+	}
+	return unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
 }
 
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isDigitOf(ch byte, base int) bool {
+	switch base {
+	case 2:
+		return ch == '0' || ch == '1'
+	case 8:
+		return '0' <= ch && ch <= '7'
+	case 16:
+		return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+	default:
+		return isDigit(ch)
+	}
+}
+
 func isWhitespace(ch byte) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
@@ -6,13 +6,21 @@ import (
 	"github.com/Kori-Sama/kori-compiler/cerr"
 )
 
+// expectedToken holds the token fields checked by the tests.
+type expectedToken struct {
+	Kind     TokenKind
+	Literal  string
+	Line     int
+	Location int
+}
+
 var validTokens = map[string](struct {
 	src string
-	tok []Token
+	tok []expectedToken
 }){
 	"One_Line": {
 		"let a = 9;",
-		[]Token{
+		[]expectedToken{
 			{TOKEN_LET, "let", 0, 0},
 			{TOKEN_NAME, "a", 0, 4},
 			{TOKEN_ASSIGN, "=", 0, 6},
@@ -21,7 +29,7 @@ var validTokens = map[string](struct {
 	},
 	"Two_Lines": {
 		"let a = 9 / 9 - 1;\nlet b = 10 * 2;",
-		[]Token{
+		[]expectedToken{
 			{TOKEN_LET, "let", 0, 0},
 			{TOKEN_NAME, "a", 0, 4},
 			{TOKEN_ASSIGN, "=", 0, 6},
@@ -41,7 +49,7 @@ var validTokens = map[string](struct {
 	},
 	"Function": {
 		"func add(a, b) {\n    return a + b;\n}",
-		[]Token{
+		[]expectedToken{
 			{TOKEN_FUNC, "func", 0, 0},
 			{TOKEN_NAME, "add", 0, 5},
 			{TOKEN_LPAREN, "(", 0, 8},
@@ -60,7 +68,7 @@ var validTokens = map[string](struct {
 
 	"Token_With_Double_Operators": {
 		"a == b; a <= b; a >= b; a !=b; a < b; a > b;",
-		[]Token{
+		[]expectedToken{
 			{TOKEN_NAME, "a", 0, 0},
 			{TOKEN_EQ, "==", 0, 2},
 			{TOKEN_NAME, "b", 0, 5},
@@ -88,7 +96,7 @@ var validTokens = map[string](struct {
 	},
 	"Token_With_Double_Keywords": {
 		"if true { return; } else if false { return; } else {}",
-		[]Token{
+		[]expectedToken{
 			{TOKEN_IF, "if", 0, 0},
 			{TOKEN_TRUE, "true", 0, 3},
 			{TOKEN_LBRACE, "{", 0, 8},
@@ -107,7 +115,7 @@ var validTokens = map[string](struct {
 	},
 	"Token_Array": {
 		"[1, 2, 3]",
-		[]Token{
+		[]expectedToken{
 			{TOKEN_LBRACKET, "[", 0, 0},
 			{TOKEN_NUMBER, "1", 0, 1},
 			{TOKEN_COMMA, ",", 0, 2},
@@ -116,9 +124,117 @@ var validTokens = map[string](struct {
 			{TOKEN_NUMBER, "3", 0, 7},
 			{TOKEN_RBRACKET, "]", 0, 8}},
 	},
+	"Operators": {
+		"a % b ** c ^ ~d << 1 >> 2 != e",
+		[]expectedToken{
+			{TOKEN_NAME, "a", 0, 0},
+			{TOKEN_PERCENT, "%", 0, 2},
+			{TOKEN_NAME, "b", 0, 4},
+			{TOKEN_STAR_STAR, "**", 0, 6},
+			{TOKEN_NAME, "c", 0, 9},
+			{TOKEN_CARET, "^", 0, 11},
+			{TOKEN_TILDE, "~", 0, 13},
+			{TOKEN_NAME, "d", 0, 14},
+			{TOKEN_SHIFT_LEFT, "<<", 0, 16},
+			{TOKEN_NUMBER, "1", 0, 19},
+			{TOKEN_SHIFT_RIGHT, ">>", 0, 21},
+			{TOKEN_NUMBER, "2", 0, 24},
+			{TOKEN_NOT_EQ, "!=", 0, 26},
+			{TOKEN_NAME, "e", 0, 29}},
+	},
+	"Member": {
+		"p.x = 1.5 + 2.y",
+		[]expectedToken{
+			{TOKEN_NAME, "p", 0, 0},
+			{TOKEN_DOT, ".", 0, 1},
+			{TOKEN_NAME, "x", 0, 2},
+			{TOKEN_ASSIGN, "=", 0, 4},
+			{TOKEN_NUMBER, "1.5", 0, 6},
+			{TOKEN_PLUS, "+", 0, 10},
+			{TOKEN_NUMBER, "2", 0, 12},
+			{TOKEN_DOT, ".", 0, 13},
+			{TOKEN_NAME, "y", 0, 14}},
+	},
+	"Match": {
+		"match s { _ => a == b }",
+		[]expectedToken{
+			{TOKEN_MATCH, "match", 0, 0},
+			{TOKEN_NAME, "s", 0, 6},
+			{TOKEN_LBRACE, "{", 0, 8},
+			{TOKEN_NAME, "_", 0, 10},
+			{TOKEN_FAT_ARROW, "=>", 0, 12},
+			{TOKEN_NAME, "a", 0, 15},
+			{TOKEN_EQ, "==", 0, 17},
+			{TOKEN_NAME, "b", 0, 20},
+			{TOKEN_RBRACE, "}", 0, 22}},
+	},
+	"Loops": {
+		"a: while x { break a; continue }",
+		[]expectedToken{
+			{TOKEN_NAME, "a", 0, 0},
+			{TOKEN_COLON, ":", 0, 1},
+			{TOKEN_WHILE, "while", 0, 3},
+			{TOKEN_NAME, "x", 0, 9},
+			{TOKEN_LBRACE, "{", 0, 11},
+			{TOKEN_BREAK, "break", 0, 13},
+			{TOKEN_NAME, "a", 0, 19},
+			{TOKEN_SEMI, ";", 0, 20},
+			{TOKEN_CONTINUE, "continue", 0, 22},
+			{TOKEN_RBRACE, "}", 0, 31}},
+	},
+	"Map": {
+		`#{ "a": 1 }`,
+		[]expectedToken{
+			{TOKEN_HASH_LBRACE, "#{", 0, 0},
+			{TOKEN_STRING, "a", 0, 3},
+			{TOKEN_COLON, ":", 0, 6},
+			{TOKEN_NUMBER, "1", 0, 8},
+			{TOKEN_RBRACE, "}", 0, 10},
+			{TOKEN_EOF, "", 0, 11}},
+	},
+	"Annotation": {
+		"func(a: [int]) -> x-1",
+		[]expectedToken{
+			{TOKEN_FUNC, "func", 0, 0},
+			{TOKEN_LPAREN, "(", 0, 4},
+			{TOKEN_NAME, "a", 0, 5},
+			{TOKEN_COLON, ":", 0, 6},
+			{TOKEN_LBRACKET, "[", 0, 8},
+			{TOKEN_NAME, "int", 0, 9},
+			{TOKEN_RBRACKET, "]", 0, 12},
+			{TOKEN_RPAREN, ")", 0, 13},
+			{TOKEN_ARROW, "->", 0, 15},
+			{TOKEN_NAME, "x", 0, 18},
+			{TOKEN_MINUS, "-", 0, 19},
+			{TOKEN_NUMBER, "1", 0, 20},
+			{TOKEN_EOF, "", 0, 21}},
+	},
+	"Range": {
+		"0..n a..=1.5 .",
+		[]expectedToken{
+			{TOKEN_NUMBER, "0", 0, 0},
+			{TOKEN_DOT_DOT, "..", 0, 1},
+			{TOKEN_NAME, "n", 0, 3},
+			{TOKEN_NAME, "a", 0, 5},
+			{TOKEN_DOT_DOT_EQ, "..=", 0, 6},
+			{TOKEN_NUMBER, "1.5", 0, 9},
+			{TOKEN_DOT, ".", 0, 13},
+			{TOKEN_EOF, "", 0, 14}},
+	},
+	"Else_Newline": {
+		"if a {}\nelse\n{\n}",
+		[]expectedToken{
+			{TOKEN_IF, "if", 0, 0},
+			{TOKEN_NAME, "a", 0, 3},
+			{TOKEN_LBRACE, "{", 0, 5},
+			{TOKEN_RBRACE, "}", 0, 6},
+			{TOKEN_ELSE, "else", 1, 0},
+			{TOKEN_LBRACE, "{", 2, 0},
+			{TOKEN_RBRACE, "}", 3, 0}},
+	},
 	"Out_Of_Range": {
 		"if 1234 {} else {}",
-		[]Token{
+		[]expectedToken{
 			{TOKEN_IF, "if", 0, 0},
 			{TOKEN_NUMBER, "1234", 0, 3},
 			{TOKEN_LBRACE, "{", 0, 8},
@@ -129,7 +245,7 @@ var validTokens = map[string](struct {
 	},
 	"String": {
 		`let str = "Hello, World!";`,
-		[]Token{
+		[]expectedToken{
 			{TOKEN_LET, "let", 0, 0},
 			{TOKEN_NAME, "str", 0, 4},
 			{TOKEN_ASSIGN, "=", 0, 8},
@@ -137,9 +253,71 @@ var validTokens = map[string](struct {
 			{TOKEN_SEMI, ";", 0, 25},
 		},
 	},
+	"String_Escapes": {
+		`"say \"hi\"\n\t\\ \u{48}\u{1F600}"`,
+		[]expectedToken{
+			{TOKEN_STRING, "say \"hi\"\n\t\\ H\U0001F600", 0, 0},
+			{TOKEN_EOF, "", 0, 34},
+		},
+	},
+	"String_Interpolation": {
+		`"a ${f("}", {x}) + 1} b ${y}\${z}"`,
+		[]expectedToken{
+			{TOKEN_STRING_HEAD, "a ", 0, 0},
+			{TOKEN_NAME, "f", 0, 5},
+			{TOKEN_LPAREN, "(", 0, 6},
+			{TOKEN_STRING, "}", 0, 7},
+			{TOKEN_COMMA, ",", 0, 10},
+			{TOKEN_LBRACE, "{", 0, 12},
+			{TOKEN_NAME, "x", 0, 13},
+			{TOKEN_RBRACE, "}", 0, 14},
+			{TOKEN_RPAREN, ")", 0, 15},
+			{TOKEN_PLUS, "+", 0, 17},
+			{TOKEN_NUMBER, "1", 0, 19},
+			{TOKEN_STRING_MIDDLE, " b ", 0, 20},
+			{TOKEN_NAME, "y", 0, 26},
+			{TOKEN_STRING_TAIL, "${z}", 0, 27},
+			{TOKEN_EOF, "", 0, 34},
+		},
+	},
+	"Numbers": {
+		"0x1F 0b1010 0o17 1_000_000 3.25 1e-9 2.5E+3 0..1",
+		[]expectedToken{
+			{TOKEN_NUMBER, "0x1F", 0, 0},
+			{TOKEN_NUMBER, "0b1010", 0, 5},
+			{TOKEN_NUMBER, "0o17", 0, 12},
+			{TOKEN_NUMBER, "1_000_000", 0, 17},
+			{TOKEN_NUMBER, "3.25", 0, 27},
+			{TOKEN_NUMBER, "1e-9", 0, 32},
+			{TOKEN_NUMBER, "2.5E+3", 0, 37},
+			{TOKEN_NUMBER, "0", 0, 44},
+		},
+	},
+	"Identifiers": {
+		"let x1 = vec3 + _tmp_2 + 名前 + café;\nlet s = \"héllo ✓\"; s;",
+		[]expectedToken{
+			{TOKEN_LET, "let", 0, 0},
+			{TOKEN_NAME, "x1", 0, 4},
+			{TOKEN_ASSIGN, "=", 0, 7},
+			{TOKEN_NAME, "vec3", 0, 9},
+			{TOKEN_PLUS, "+", 0, 14},
+			{TOKEN_NAME, "_tmp_2", 0, 16},
+			{TOKEN_PLUS, "+", 0, 23},
+			{TOKEN_NAME, "名前", 0, 25},
+			{TOKEN_PLUS, "+", 0, 28},
+			{TOKEN_NAME, "café", 0, 30},
+			{TOKEN_SEMI, ";", 0, 34},
+			{TOKEN_LET, "let", 1, 0},
+			{TOKEN_NAME, "s", 1, 4},
+			{TOKEN_ASSIGN, "=", 1, 6},
+			{TOKEN_STRING, "héllo ✓", 1, 8},
+			{TOKEN_SEMI, ";", 1, 17},
+			{TOKEN_NAME, "s", 1, 19},
+		},
+	},
 	"Infinite_For_Loop": {
 		`for { 1; }`,
-		[]Token{
+		[]expectedToken{
 			{TOKEN_FOR, "for", 0, 0},
 			{TOKEN_LBRACE, "{", 0, 4},
 			{TOKEN_NUMBER, "1", 0, 6},
@@ -147,6 +325,21 @@ var validTokens = map[string](struct {
 			{TOKEN_RBRACE, "}", 0, 9},
 		},
 	},
+	"Comments": {
+		"let a = 1; // trailing\n/* block /* nested */ still */ a / 2;",
+		[]expectedToken{
+			{TOKEN_LET, "let", 0, 0},
+			{TOKEN_NAME, "a", 0, 4},
+			{TOKEN_ASSIGN, "=", 0, 6},
+			{TOKEN_NUMBER, "1", 0, 8},
+			{TOKEN_SEMI, ";", 0, 9},
+			{TOKEN_NAME, "a", 1, 31},
+			{TOKEN_SLASH, "/", 1, 33},
+			{TOKEN_NUMBER, "2", 1, 35},
+			{TOKEN_SEMI, ";", 1, 36},
+			{TOKEN_EOF, "", 1, 37},
+		},
+	},
 }
 
 func TestNextToken(t *testing.T) {
@@ -179,33 +372,104 @@ func TestNextToken(t *testing.T) {
 	}
 }
 
-var invalidTokensMap = map[string]cerr.LexerError{
-	"let a = 9; !":   {Message: "Illegal character", Line: 0, Location: 11},
-	"let a = 9;\n !": {Message: "Illegal character", Line: 1, Location: 1},
+type expectedError struct {
+	Message  string
+	Line     int
+	Location int
+}
+
+var invalidTokensMap = map[string]expectedError{
+	"let a = 9; !":        {Message: "Illegal character", Line: 0, Location: 11},
+	"let a = 9;\n !":      {Message: "Illegal character", Line: 1, Location: 1},
+	"a;\n  /* /* */":      {Message: "Unterminated block comment", Line: 1, Location: 2},
+	`let s = "a\q";`:      {Message: "Invalid escape sequence '\\q'", Line: 0, Location: 10},
+	`let s = "\u{D800}";`: {Message: "Invalid escape sequence '\\u'", Line: 0, Location: 9},
+	`"a ${b`:              {Message: "Unterminated string interpolation", Line: 0, Location: 0},
+	"let a = 1.2.3;":      {Message: "Unexpected '.' in number literal", Line: 0, Location: 11},
+	"let a = 0b102;":      {Message: "Invalid digit '2' in base 2 literal", Line: 0, Location: 12},
+	"let a = 0x;":         {Message: "Expected digits after '0x'", Line: 0, Location: 10},
+	"let a = 1e+;":        {Message: "Expected digits in exponent", Line: 0, Location: 11},
+	"let a = 1__0;":       {Message: "'_' must separate digits in number literal", Line: 0, Location: 9},
+	"let a = 10_;":        {Message: "'_' must separate digits in number literal", Line: 0, Location: 10},
+	"let a = 12ab;":       {Message: "Unexpected 'a' in number literal", Line: 0, Location: 10},
+	"let ü = 1; ü @":      {Message: "Illegal character '@'", Line: 0, Location: 13},
+	`"abc`:                {Message: "Unterminated string", Line: 0, Location: 0},
+	"let m = # {};":       {Message: "Illegal character '#'", Line: 0, Location: 8},
 }
 
 func TestNextTokenError(t *testing.T) {
 	for input, expected := range invalidTokensMap {
 		lexer := NewLexer(&input)
 
-		for {
-			token := lexer.Next()
-			if token.Kind == TOKEN_ILLEGAL || token.Kind == TOKEN_EOF {
-				break
-			}
-		}
+		lexer.ParseAll()
 
-		if lexer.Err == nil {
+		if lexer.Diags.Len() == 0 {
 			continue
 		}
-		if lexer.Err.Message != expected.Message {
-			t.Errorf("Expected %s, got %s", expected.Message, lexer.Err.Message)
+		err := lexer.Diags.All()[0]
+		if err.Message != expected.Message {
+			t.Errorf("Expected %s, got %s", expected.Message, err.Message)
+		}
+		if err.Span.Start.Line != expected.Line {
+			t.Errorf("Expected %d, got %d", expected.Line, err.Span.Start.Line)
+		}
+		if err.Span.Start.Column != expected.Location {
+			t.Errorf("Expected %d, got %d", expected.Location, err.Span.Start.Column)
+		}
+	}
+}
+
+func TestKeepComments(t *testing.T) {
+	src := "// doc\nfunc /* inline */ main() {}"
+	expected := []expectedToken{
+		{TOKEN_COMMENT, "// doc", 0, 0},
+		{TOKEN_FUNC, "func", 1, 0},
+		{TOKEN_COMMENT, "/* inline */", 1, 5},
+		{TOKEN_NAME, "main", 1, 18},
+	}
+
+	lexer := NewLexer(&src)
+	lexer.KeepComments = true
+
+	for _, want := range expected {
+		token := lexer.Next()
+		if token.Kind != want.Kind || token.Literal != want.Literal {
+			t.Errorf("Expected %s %q, got %s %q", want.Kind, want.Literal, token.Kind, token.Literal)
 		}
-		if lexer.Err.Line != expected.Line {
-			t.Errorf("Expected %d, got %d", expected.Line, lexer.Err.Line)
+		if token.Line != want.Line || token.Location != want.Location {
+			t.Errorf("Expected %q at %d:%d, got %d:%d", want.Literal, want.Line, want.Location, token.Line, token.Location)
 		}
-		if lexer.Err.Location != expected.Location {
-			t.Errorf("Expected %d, got %d", expected.Location, lexer.Err.Location)
+	}
+}
+
+func TestMultipleErrors(t *testing.T) {
+	src := "let a = 1 @ 2;\nlet b = 0x;\nlet c = \"\\q\" + 12ab;"
+	lexer := NewLexer(&src)
+	lexer.File = "test.kori"
+	tokens := lexer.ParseAll()
+
+	expected := []struct {
+		code cerr.Code
+		span cerr.Span
+	}{
+		{cerr.CODE_ILLEGAL_CHARACTER, cerr.Span{File: "test.kori", Start: cerr.Pos{Offset: 10, Line: 0, Column: 10}, End: cerr.Pos{Offset: 11, Line: 0, Column: 11}}},
+		{cerr.CODE_INVALID_NUMBER, cerr.Span{File: "test.kori", Start: cerr.Pos{Offset: 25, Line: 1, Column: 10}, End: cerr.Pos{Offset: 26, Line: 1, Column: 11}}},
+		{cerr.CODE_INVALID_ESCAPE, cerr.Span{File: "test.kori", Start: cerr.Pos{Offset: 36, Line: 2, Column: 9}, End: cerr.Pos{Offset: 38, Line: 2, Column: 11}}},
+		{cerr.CODE_INVALID_NUMBER, cerr.Span{File: "test.kori", Start: cerr.Pos{Offset: 44, Line: 2, Column: 17}, End: cerr.Pos{Offset: 45, Line: 2, Column: 18}}},
+	}
+
+	diags := lexer.Diags.All()
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(diags), diags)
+	}
+	for i, want := range expected {
+		if diags[i].Code != want.code || diags[i].Span != want.span {
+			t.Errorf("Expected %s at %+v, got %s at %+v", want.code, want.span, diags[i].Code, diags[i].Span)
 		}
 	}
+
+	last := tokens[len(tokens)-2]
+	if last.Kind != TOKEN_SEMI || last.Line != 2 || last.Location != 19 {
+		t.Errorf("Expected lexing to continue to the final ';', got %s at %d:%d", last.Kind, last.Line, last.Location)
+	}
 }
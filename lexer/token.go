@@ -1,5 +1,7 @@
 package lexer
 
+import "github.com/Kori-Sama/kori-compiler/cerr"
+
 type TokenKind int
 
 const (
@@ -7,6 +9,11 @@ const (
 	TOKEN_NAME
 	TOKEN_NUMBER
 	TOKEN_STRING
+	// An interpolated string "a ${x} b ${y} c" is split into STRING_HEAD "a ",
+	// the tokens of x, STRING_MIDDLE " b ", the tokens of y and STRING_TAIL " c".
+	TOKEN_STRING_HEAD
+	TOKEN_STRING_MIDDLE
+	TOKEN_STRING_TAIL
 	TOKEN_ASSIGN
 	TOKEN_EQ
 	TOKEN_NOT_EQ
@@ -23,25 +30,42 @@ const (
 	TOKEN_COLON
 	TOKEN_LBRACE
 	TOKEN_RBRACE
+	TOKEN_HASH_LBRACE
 	TOKEN_LPAREN
 	TOKEN_RPAREN
 	TOKEN_LBRACKET
 	TOKEN_RBRACKET
 	TOKEN_COMMA
+	TOKEN_DOT
+	TOKEN_DOT_DOT
+	TOKEN_DOT_DOT_EQ
+	TOKEN_FAT_ARROW
+	TOKEN_ARROW
 	TOKEN_PLUS
 	TOKEN_MINUS
 	TOKEN_SLASH
 	TOKEN_STAR
+	TOKEN_STAR_STAR
+	TOKEN_PERCENT
+	TOKEN_CARET
+	TOKEN_TILDE
+	TOKEN_SHIFT_LEFT
+	TOKEN_SHIFT_RIGHT
 	TOKEN_PLUS_EQ
 	TOKEN_MINUS_EQ
 	TOKEN_SLASH_EQ
 	TOKEN_STAR_EQ
 	TOKEN_STRUCT
+	TOKEN_IMPL
+	TOKEN_ENUM
+	TOKEN_MATCH
+	TOKEN_COMMENT
 	TOKEN_EOF
 	// Keyword
 	TOKEN_FUNC
 	TOKEN_LET
 	TOKEN_VAR
+	TOKEN_CONST
 	TOKEN_RETURN
 	TOKEN_IF
 	TOKEN_ELSE_IF
@@ -50,13 +74,22 @@ const (
 	TOKEN_FALSE
 	TOKEN_FOR
 	TOKEN_IN
+	TOKEN_WHILE
+	TOKEN_BREAK
+	TOKEN_CONTINUE
 )
 
 type Token struct {
-	Kind     TokenKind
-	Literal  string
+	Kind    TokenKind
+	Literal string
+	// Line and Location are the zero based line and column of the first
+	// character, Offset is its byte offset.
 	Line     int
 	Location int
+	Offset   int
+	// End is the position just past the last character.
+	End  cerr.Pos
+	File string
 }
 
 func NewToken(kind TokenKind, literal string) *Token {
@@ -66,6 +99,14 @@ func NewToken(kind TokenKind, literal string) *Token {
 	}
 }
 
+func (t *Token) Pos() cerr.Pos {
+	return cerr.Pos{Offset: t.Offset, Line: t.Line, Column: t.Location}
+}
+
+func (t *Token) Span() cerr.Span {
+	return cerr.Span{File: t.File, Start: t.Pos(), End: t.End}
+}
+
 func (t *Token) String() string {
 	return t.Literal
 }
@@ -82,46 +123,69 @@ func (t TokenKind) String() string {
 }
 
 var tokenNamesMap = map[TokenKind]string{
-	TOKEN_ILLEGAL:    "ILLEGAL",
-	TOKEN_NAME:       "NAME",
-	TOKEN_NUMBER:     "NUMBER",
-	TOKEN_STRING:     "STRING",
-	TOKEN_ASSIGN:     "ASSIGN",
-	TOKEN_EQ:         "EQ",
-	TOKEN_NOT_EQ:     "NOT_EQ",
-	TOKEN_BANG:       "BANG",
-	TOKEN_LESS:       "LESS",
-	TOKEN_GREATER:    "GREATER",
-	TOKEN_LESS_EQ:    "LESS_EQ",
-	TOKEN_GREATER_EQ: "GREATER_EQ",
-	TOKEN_SEMI:       "SEMI",
-	TOKEN_COLON:      "COLON",
-	TOKEN_LBRACE:     "LBRACE",
-	TOKEN_RBRACE:     "RBRACE",
-	TOKEN_LPAREN:     "LPAREN",
-	TOKEN_RPAREN:     "RPAREN",
-	TOKEN_LBRACKET:   "LBRACKET",
-	TOKEN_RBRACKET:   "RBRACKET",
-	TOKEN_COMMA:      "COMMA",
-	TOKEN_PLUS:       "PLUS",
-	TOKEN_MINUS:      "MINUS",
-	TOKEN_SLASH:      "SLASH",
-	TOKEN_STAR:       "STAR",
-	TOKEN_PLUS_EQ:    "PLUS_EQ",
-	TOKEN_MINUS_EQ:   "MINUS_EQ",
-	TOKEN_SLASH_EQ:   "SLASH_EQ",
-	TOKEN_STAR_EQ:    "STAR_EQ",
-	TOKEN_STRUCT:     "STRUCT",
-	TOKEN_EOF:        "EOF",
-	TOKEN_FUNC:       "FUNC",
-	TOKEN_LET:        "LET",
-	TOKEN_VAR:        "VAR",
-	TOKEN_RETURN:     "RETURN",
-	TOKEN_IF:         "IF",
-	TOKEN_ELSE_IF:    "ELSE_IF",
-	TOKEN_ELSE:       "ELSE",
-	TOKEN_TRUE:       "TRUE",
-	TOKEN_FALSE:      "FALSE",
-	TOKEN_FOR:        "FOR",
-	TOKEN_IN:         "IN",
+	TOKEN_ILLEGAL:       "ILLEGAL",
+	TOKEN_NAME:          "NAME",
+	TOKEN_NUMBER:        "NUMBER",
+	TOKEN_STRING:        "STRING",
+	TOKEN_STRING_HEAD:   "STRING_HEAD",
+	TOKEN_STRING_MIDDLE: "STRING_MIDDLE",
+	TOKEN_STRING_TAIL:   "STRING_TAIL",
+	TOKEN_ASSIGN:        "ASSIGN",
+	TOKEN_EQ:            "EQ",
+	TOKEN_NOT_EQ:        "NOT_EQ",
+	TOKEN_BANG:          "BANG",
+	TOKEN_LESS:          "LESS",
+	TOKEN_GREATER:       "GREATER",
+	TOKEN_LESS_EQ:       "LESS_EQ",
+	TOKEN_GREATER_EQ:    "GREATER_EQ",
+	TOKEN_SEMI:          "SEMI",
+	TOKEN_COLON:         "COLON",
+	TOKEN_LBRACE:        "LBRACE",
+	TOKEN_RBRACE:        "RBRACE",
+	TOKEN_HASH_LBRACE:   "HASH_LBRACE",
+	TOKEN_LPAREN:        "LPAREN",
+	TOKEN_RPAREN:        "RPAREN",
+	TOKEN_LBRACKET:      "LBRACKET",
+	TOKEN_RBRACKET:      "RBRACKET",
+	TOKEN_COMMA:         "COMMA",
+	TOKEN_DOT:           "DOT",
+	TOKEN_DOT_DOT:       "DOT_DOT",
+	TOKEN_DOT_DOT_EQ:    "DOT_DOT_EQ",
+	TOKEN_FAT_ARROW:     "FAT_ARROW",
+	TOKEN_ARROW:         "ARROW",
+	TOKEN_PLUS:          "PLUS",
+	TOKEN_MINUS:         "MINUS",
+	TOKEN_SLASH:         "SLASH",
+	TOKEN_STAR:          "STAR",
+	TOKEN_STAR_STAR:     "STAR_STAR",
+	TOKEN_PERCENT:       "PERCENT",
+	TOKEN_CARET:         "CARET",
+	TOKEN_TILDE:         "TILDE",
+	TOKEN_SHIFT_LEFT:    "SHIFT_LEFT",
+	TOKEN_SHIFT_RIGHT:   "SHIFT_RIGHT",
+	TOKEN_PLUS_EQ:       "PLUS_EQ",
+	TOKEN_MINUS_EQ:      "MINUS_EQ",
+	TOKEN_SLASH_EQ:      "SLASH_EQ",
+	TOKEN_STAR_EQ:       "STAR_EQ",
+	TOKEN_STRUCT:        "STRUCT",
+	TOKEN_IMPL:          "IMPL",
+	TOKEN_ENUM:          "ENUM",
+	TOKEN_MATCH:         "MATCH",
+	TOKEN_COMMENT:       "COMMENT",
+	TOKEN_EOF:           "EOF",
+	TOKEN_FUNC:          "FUNC",
+	TOKEN_LET:           "LET",
+	TOKEN_VAR:           "VAR",
+	TOKEN_CONST:         "CONST",
+	TOKEN_RETURN:        "RETURN",
+	TOKEN_IF:            "IF",
+	TOKEN_ELSE_IF:       "ELSE_IF",
+	TOKEN_ELSE:          "ELSE",
+	TOKEN_TRUE:          "TRUE",
+	TOKEN_FALSE:         "FALSE",
+	TOKEN_FOR:           "FOR",
+	TOKEN_IN:            "IN",
+	TOKEN_WHILE:         "WHILE",
+	TOKEN_BREAK:         "BREAK",
+	TOKEN_CONTINUE:      "CONTINUE",
 }
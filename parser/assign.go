@@ -5,102 +5,74 @@ import (
 	"github.com/Kori-Sama/kori-compiler/lexer"
 )
 
+// AssignExpr assigns Value to Target, a variable, an element or a field. Op
+// is empty for a plain assignment and the operator of a compound one like +=.
 type AssignExpr struct {
 	BaseExpr
-	VarName string `json:"var_name"`
-	Expr    Expr   `json:"expr"`
+	Target Expr   `json:"target"`
+	Op     OpKind `json:"op"`
+	Value  Expr   `json:"value"`
 }
 
-type IndexAssignExpr struct {
-	BaseExpr
-	Array string `json:"var_name"`
-	Index Expr   `json:"index"`
-	Expr  Expr   `json:"expr"`
-}
-
-func NewAssignExpr(varName string, expr Expr) *AssignExpr {
+func NewAssignExpr(target Expr, op OpKind, value Expr) *AssignExpr {
 	return &AssignExpr{
 		BaseExpr: BaseExpr{Type: EXPR_ASSIGN},
-		VarName:  varName,
-		Expr:     expr,
-	}
-}
-
-func NewIndexAssignExpr(array string, index, expr Expr) *IndexAssignExpr {
-	return &IndexAssignExpr{
-		BaseExpr: BaseExpr{Type: EXPR_INDEX_ASSIGN},
-		Array:    array,
-		Index:    index,
-		Expr:     expr,
+		Target:   target,
+		Op:       op,
+		Value:    value,
 	}
 }
 
-func (p *Parser) parseAssignExpr() (expr Expr) {
-	tok := p.getCurTok()
-	if tok.Kind != lexer.TOKEN_NAME {
-		p.Err = cerr.NewParserError("Expected variable name in assignment", tok.Line, tok.Location)
-		return nil
-	}
-
-	varName := tok.Literal
-	p.nextToken()
-
-	if p.getCurTok().Kind != lexer.TOKEN_ASSIGN {
-		p.Err = cerr.NewParserError("Expected '=' in assignment", tok.Line, tok.Location)
-		return nil
-	}
-
-	p.nextToken()
-
-	expr = p.parseExpr()
-	if expr == nil {
-		return nil
+// isPlace reports whether expr can be assigned to.
+func isPlace(expr Expr) bool {
+	switch e := expr.(type) {
+	case *VariableExpr, *MemberExpr:
+		return true
+	case *IndexExpr:
+		// A slice is a copy.
+		_, slice := e.Index.(*RangeExpr)
+		return !slice
+	default:
+		return false
 	}
-
-	return NewAssignExpr(varName, expr)
 }
 
-func (p *Parser) parseAssignOpExpr() (expr Expr) {
-	tok := p.getCurTok()
-	if tok.Kind != lexer.TOKEN_NAME {
-		p.Err = cerr.NewParserError("Expected variable name in assignment", tok.Line, tok.Location)
-		return nil
-	}
-
-	varName := tok.Literal
-	p.nextToken()
-
-	var op OpKind
-	switch p.getCurTok().Kind {
-	case lexer.TOKEN_PLUS_EQ:
-		op = OP_ADD
-	case lexer.TOKEN_MINUS_EQ:
-		op = OP_SUB
-	case lexer.TOKEN_STAR_EQ:
-		op = OP_MUL
-	case lexer.TOKEN_SLASH_EQ:
-		op = OP_DIV
-	default:
-		p.Err = cerr.NewParserError("Expected '+=' or '-=' or '*=' or '/=' in assignment", tok.Line, tok.Location)
+// parseAssignExpr parses the assignment operator following target and the
+// assigned value.
+func (p *Parser) parseAssignExpr(target Expr) Expr {
+	op, _ := getAssignOpKind(p.getCurTok().Kind)
+	if !isPlace(target) {
+		p.Diags.Error(cerr.CODE_SYNTAX, target.GetSpan(), "Invalid assignment target").
+			WithNote("only variables, elements and fields can be assigned to")
+		p.panicking = true
 		return nil
 	}
-
 	p.nextToken()
 
-	expr = p.parseExpr()
-	if expr == nil {
+	value := p.parseExpr()
+	if value == nil {
 		return nil
 	}
 
-	return NewAssignExpr(varName, NewBinaryExpr(op, NewVariableExpr(varName), expr))
+	assign := NewAssignExpr(target, op, value)
+	assign.Span = target.GetSpan().To(value.GetSpan())
+	return assign
 }
 
+// DeclarationExpr declares VarName, or the names bound by Pattern when it
+// destructures the value, `let [a, b] = pair;`.
 type DeclarationExpr struct {
 	BaseExpr
-	VarName string `json:"var_name"`
-	Mutable bool   `json:"mutable"`
-	Kind    string `json:"kind"`
-	Expr    Expr   `json:"expr"`
+	VarName  string    `json:"var_name"`
+	NameSpan cerr.Span `json:"name_span"`
+	Pattern  *Pattern  `json:"pattern,omitempty"`
+	// Annotation is the declared type, `let xs: [string] = ...`.
+	Annotation *Type `json:"annotation,omitempty"`
+	// Symbol is the declared name, nil when destructuring.
+	Symbol  *Symbol `json:"-"`
+	Mutable bool    `json:"mutable"`
+	Kind    string  `json:"kind"`
+	Expr    Expr    `json:"expr"`
 }
 
 func NewDeclarationExpr(varName string, mutable bool, expr Expr) *DeclarationExpr {
@@ -119,6 +91,22 @@ func NewDeclarationExpr(varName string, mutable bool, expr Expr) *DeclarationExp
 	}
 }
 
+// Bindings returns the names declared by n as binding patterns.
+func (n *DeclarationExpr) Bindings() []*Pattern {
+	if n.Pattern != nil {
+		return n.Pattern.Bindings()
+	}
+	return []*Pattern{{Kind: PATTERN_BINDING, Name: n.VarName, Span: n.NameSpan}}
+}
+
+// NewConstExpr creates a top-level constant, its initializer has to be a
+// constant expression.
+func NewConstExpr(varName string, expr Expr) *DeclarationExpr {
+	decl := NewDeclarationExpr(varName, false, expr)
+	decl.Kind = "const"
+	return decl
+}
+
 func (p *Parser) parseDeclarationExpr() (expr Expr) {
 	tok := p.getCurTok()
 
@@ -128,23 +116,43 @@ func (p *Parser) parseDeclarationExpr() (expr Expr) {
 
 	} else if tok.Kind == lexer.TOKEN_VAR {
 		mutable = true
+	} else if tok.Kind == lexer.TOKEN_CONST {
+
 	} else {
-		p.Err = cerr.NewParserError("Expected 'let' or 'var' in Declaration", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected 'let', 'var' or 'const' in Declaration")
 		return nil
 	}
 
 	p.nextToken()
 
-	if p.getCurTok().Kind != lexer.TOKEN_NAME {
-		p.Err = cerr.NewParserError("Expected variable name in Declaration", tok.Line, tok.Location)
-		return nil
+	var pattern *Pattern
+	var nameSpan cerr.Span
+	varName := ""
+	if p.isPatternStart() {
+		if tok.Kind == lexer.TOKEN_CONST {
+			p.errorAt(p.getCurTok(), "Constants can't be destructured, declare each one with its own 'const'")
+			return nil
+		}
+		pattern = p.parseBindingPattern()
+		if pattern == nil {
+			return nil
+		}
+	} else {
+		if p.getCurTok().Kind != lexer.TOKEN_NAME {
+			p.errorAt(tok, "Expected variable name in Declaration")
+			return nil
+		}
+		varName, nameSpan = p.getCurTok().Literal, p.getCurTok().Span()
+		p.nextToken()
 	}
 
-	varName := p.getCurTok().Literal
-	p.nextToken()
+	annotation, ok := p.parseAnnotation()
+	if !ok {
+		return nil
+	}
 
 	if p.getCurTok().Kind != lexer.TOKEN_ASSIGN {
-		p.Err = cerr.NewParserError("Expected '=' in Declaration", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected '=' in Declaration")
 		return nil
 	}
 
@@ -155,5 +163,12 @@ func (p *Parser) parseDeclarationExpr() (expr Expr) {
 		return nil
 	}
 
-	return NewDeclarationExpr(varName, mutable, expr)
+	decl := NewDeclarationExpr(varName, mutable, expr)
+	if tok.Kind == lexer.TOKEN_CONST {
+		decl = NewConstExpr(varName, expr)
+	}
+	decl.NameSpan = nameSpan
+	decl.Pattern = pattern
+	decl.Annotation = annotation
+	return p.finish(decl, tok)
 }
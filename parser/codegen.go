@@ -2,6 +2,10 @@ package parser
 
 import (
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 // target: javascript
@@ -10,12 +14,23 @@ type ICodegen interface {
 	Codegen() string
 }
 
-func (n *NumberExpr) Codegen() string {
-	if n.Val == float64(int(n.Val)) {
-		return fmt.Sprintf("%d", int(n.Val))
+// useHelper records that the code generated for n calls the runtime helper
+// name, see Expr.Helpers, and returns name.
+func (n *BaseExpr) useHelper(name string) string {
+	if !slices.Contains(n.helpers, name) {
+		n.helpers = append(n.helpers, name)
 	}
+	return name
+}
 
-	return fmt.Sprintf("%f", n.Val)
+func (n *NumberExpr) Codegen() string {
+	// Shortest representation that round-trips, switching to exponent form
+	// where JavaScript itself would.
+	abs := math.Abs(n.Val)
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(n.Val, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(n.Val, 'f', -1, 64)
 }
 
 func (n *BooleanExpr) Codegen() string {
@@ -27,7 +42,61 @@ func (n *BooleanExpr) Codegen() string {
 }
 
 func (n *StringExpr) Codegen() string {
-	return fmt.Sprintf(`"%s"`, n.Val)
+	return quoteJsString(n.Val)
+}
+
+func (n *InterpolatedStringExpr) Codegen() string {
+	var b strings.Builder
+	b.WriteByte('`')
+	for i, part := range n.Parts {
+		b.WriteString(escapeJsTemplate(part))
+		if i < len(n.Exprs) {
+			b.WriteString("${")
+			b.WriteString(n.Exprs[i].Codegen())
+			b.WriteString("}")
+		}
+	}
+	b.WriteByte('`')
+	return b.String()
+}
+
+// quoteJsString renders s as a double quoted JavaScript string literal that
+// evaluates to exactly s.
+func quoteJsString(s string) string {
+	return `"` + escapeJs(s, '"') + `"`
+}
+
+// escapeJsTemplate escapes s for use as the literal text of a JavaScript
+// template literal.
+func escapeJsTemplate(s string) string {
+	return escapeJs(s, '`')
+}
+
+// escapeJs escapes s for a JavaScript string or template literal delimited
+// by quote, so that it evaluates to exactly s.
+func escapeJs(s string, quote rune) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case r == quote || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '$' && quote == '`' && i+1 < len(runes) && runes[i+1] == '{':
+			b.WriteString(`\$`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
 }
 
 func (n *VariableExpr) Codegen() string {
@@ -57,10 +126,6 @@ func (n *UnaryExpr) Codegen() string {
 	return fmt.Sprintf("(%s %s)", n.Op, n.RHS.Codegen())
 }
 
-func (n *IndexAssignExpr) Codegen() string {
-	return fmt.Sprintf("%s[%s] = %s", n.Array, n.Index.Codegen(), n.Expr.Codegen())
-}
-
 func (n *CallExpr) Codegen() string {
 	args := ""
 	for i, arg := range n.Args {
@@ -73,25 +138,115 @@ func (n *CallExpr) Codegen() string {
 		args += arg.Codegen()
 	}
 
-	if n.Callee == "println" {
+	if n.CalleeName() == "println" {
 		return fmt.Sprintf("console.log(%s)", args)
 	}
 
-	if n.Callee == "len" {
+	if n.CalleeName() == "len" {
 		return fmt.Sprintf("%s.length", args)
 	}
 
-	return fmt.Sprintf("%s(%s)", n.Callee, args)
+	// keys, values, has and enumerate work on maps of either representation and on
+	// arrays, see the runtime of the codegen package.
+	switch n.CalleeName() {
+	case "keys", "values", "has", "enumerate":
+		return fmt.Sprintf("%s(%s)", n.useHelper("$"+n.CalleeName()), args)
+	}
+
+	return fmt.Sprintf("%s(%s)", codegenOperand(n.Callee), args)
 }
 
 func (n *IndexExpr) Codegen() string {
-	return fmt.Sprintf("%s[%s]", n.Array, n.Index.Codegen())
+	if rng, ok := n.Index.(*RangeExpr); ok {
+		return n.codegenSlice(rng)
+	}
+	if n.Dynamic {
+		return fmt.Sprintf("%s(%s, %s)", n.useHelper("$get"), n.Array.Codegen(), n.Index.Codegen())
+	}
+	return fmt.Sprintf("%s[%s]", codegenOperand(n.Array), n.Index.Codegen())
+}
+
+// codegenSlice slices arrays and strings alike, the end is left out of
+// slice() for a range without one.
+func (n *IndexExpr) codegenSlice(rng *RangeExpr) string {
+	start := "0"
+	if rng.Start != nil {
+		start = rng.Start.Codegen()
+	}
+	if rng.End == nil {
+		return fmt.Sprintf("%s.slice(%s)", codegenOperand(n.Array), start)
+	}
+	return fmt.Sprintf("%s.slice(%s, %s)", codegenOperand(n.Array), start, rng.codegenEnd())
+}
+
+// Codegen builds the array of the numbers in the range, looping over a range
+// doesn't need one, see ForeachExpr.
+func (n *RangeExpr) Codegen() string {
+	start := "0"
+	if n.Start != nil {
+		start = n.Start.Codegen()
+	}
+	return fmt.Sprintf("%s(%s, %s)", n.useHelper("$range"), start, n.codegenEnd())
+}
+
+// codegenEnd returns the exclusive end of the range.
+func (n *RangeExpr) codegenEnd() string {
+	if n.Inclusive {
+		return n.End.Codegen() + " + 1"
+	}
+	return n.End.Codegen()
+}
+
+// Codegen emits the map as a plain object, or as a Map if JsMap is set.
+func (n *MapExpr) Codegen() string {
+	entries := make([]string, len(n.Entries))
+	for i, entry := range n.Entries {
+		key, value := entry.Key.Codegen(), entry.Value.Codegen()
+		switch {
+		case n.JsMap:
+			entries[i] = fmt.Sprintf("[%s, %s]", key, value)
+		case entry.Key.GetType() == EXPR_STRING:
+			entries[i] = fmt.Sprintf("%s: %s", key, value)
+		default:
+			entries[i] = fmt.Sprintf("[%s]: %s", key, value)
+		}
+	}
+
+	if n.JsMap {
+		if len(entries) == 0 {
+			return "new Map()"
+		}
+		return fmt.Sprintf("new Map([%s])", strings.Join(entries, ", "))
+	}
+	if len(entries) == 0 {
+		return "{}"
+	}
+	return fmt.Sprintf("{ %s }", strings.Join(entries, ", "))
+}
+
+// codegenOperand emits expr as the operand of a call, index or member
+// access, in parentheses unless it binds tightly enough.
+func codegenOperand(expr Expr) string {
+	switch expr.(type) {
+	case *VariableExpr, *CallExpr, *IndexExpr, *MemberExpr, *ArrayExpr, *StringExpr,
+		*InterpolatedStringExpr, *BinaryExpr, *UnaryExpr, *StructLiteralExpr:
+		return expr.Codegen()
+	default:
+		return "(" + expr.Codegen() + ")"
+	}
+}
+
+func (n *ErrorExpr) Codegen() string {
+	return "undefined"
 }
 
 func (n *IfExpr) Codegen() string {
 	if n.Else == nil {
 		return fmt.Sprintf("if (%s) { %s }", n.Cond.Codegen(), n.Then.Codegen())
 	}
+	if elseIf, ok := n.Else.(*IfExpr); ok {
+		return fmt.Sprintf("if (%s) { %s } else %s", n.Cond.Codegen(), n.Then.Codegen(), elseIf.Codegen())
+	}
 	return fmt.Sprintf("if (%s) { %s } else { %s }", n.Cond.Codegen(), n.Then.Codegen(), n.Else.Codegen())
 }
 
@@ -107,15 +262,83 @@ func (n *ForExpr) Codegen() string {
 		body = n.Body.Codegen()
 	}
 
-	return fmt.Sprintf("for (%s) { %s }", cond, body)
+	return fmt.Sprintf("%sfor (%s) { %s }", n.codegenLabel(), cond, body)
 }
 
 func (n *ForeachExpr) Codegen() string {
-	return fmt.Sprintf("for (let %s of %s) { %s }", n.VarName, n.Array.Codegen(), n.Body.Codegen())
+	if rng, ok := n.Array.(*RangeExpr); ok && rng.Start != nil && rng.End != nil && n.Pattern == nil {
+		return n.codegenCounting(rng)
+	}
+	target := codegenTarget(n.VarName, n.Pattern)
+	if n.KeyName != "" {
+		return fmt.Sprintf("%sfor (let [%s, %s] of %s(%s)) { %s }", n.codegenLabel(), n.KeyName, target, n.useHelper("$entries"), n.Array.Codegen(), n.Body.Codegen())
+	}
+	return fmt.Sprintf("%sfor (let %s of %s) { %s }", n.codegenLabel(), target, n.Array.Codegen(), n.Body.Codegen())
+}
+
+// codegenCounting lowers a loop over a range to a counting loop. The end is
+// evaluated once, like the array of any other loop.
+func (n *ForeachExpr) codegenCounting(rng *RangeExpr) string {
+	end := rng.End.Codegen()
+	if _, ok := rng.End.(*NumberExpr); !ok {
+		end = "$end"
+	}
+	cmp := "<"
+	if rng.Inclusive {
+		cmp = "<="
+	}
+
+	init := fmt.Sprintf("let %s = %s", n.VarName, rng.Start.Codegen())
+	step := n.VarName + "++"
+	if n.KeyName != "" {
+		init = fmt.Sprintf("let %s = 0, %s = %s", n.KeyName, n.VarName, rng.Start.Codegen())
+		step = fmt.Sprintf("%s++, %s++", n.KeyName, n.VarName)
+	}
+	if end == "$end" {
+		init += ", $end = " + rng.End.Codegen()
+	}
+	return fmt.Sprintf("%sfor (%s; %s %s %s; %s) { %s }", n.codegenLabel(), init, n.VarName, cmp, end, step, n.Body.Codegen())
+}
+
+func (n *WhileExpr) Codegen() string {
+	return fmt.Sprintf("%swhile (%s) { %s }", n.codegenLabel(), n.Cond.Codegen(), n.Body.Codegen())
+}
+
+func (l *LoopLabel) codegenLabel() string {
+	if l.Label == "" {
+		return ""
+	}
+	return l.Label + ": "
+}
+
+func (n *BreakExpr) Codegen() string {
+	if n.Label == "" {
+		return "break"
+	}
+	return "break " + n.Label
+}
+
+func (n *ContinueExpr) Codegen() string {
+	if n.Label == "" {
+		return "continue"
+	}
+	return "continue " + n.Label
 }
 
 func (n *AssignExpr) Codegen() string {
-	return fmt.Sprintf("%s = %s", n.VarName, n.Expr.Codegen())
+	index, ok := n.Target.(*IndexExpr)
+	if !ok || !index.Dynamic {
+		return fmt.Sprintf("%s %s= %s", n.Target.Codegen(), n.Op, n.Value.Codegen())
+	}
+
+	array, key := index.Array.Codegen(), index.Index.Codegen()
+	n.useHelper("$set")
+	if n.Op == "" {
+		return fmt.Sprintf("$set(%s, %s, %s)", array, key, n.Value.Codegen())
+	}
+	// The collection and key are evaluated once, like for a[k] += v.
+	n.useHelper("$get")
+	return fmt.Sprintf("(($c, $k) => $set($c, $k, $get($c, $k) %s %s))(%s, %s)", n.Op, n.Value.Codegen(), array, key)
 }
 
 func (n *DeclarationExpr) Codegen() string {
@@ -123,7 +346,7 @@ func (n *DeclarationExpr) Codegen() string {
 	if n.Mutable {
 		kind = "let"
 	}
-	return fmt.Sprintf("%s %s = %s", kind, n.VarName, n.Expr.Codegen())
+	return fmt.Sprintf("%s %s = %s", kind, codegenTarget(n.VarName, n.Pattern), n.Expr.Codegen())
 }
 
 func (n *BraceExpr) Codegen() string {
@@ -135,6 +358,9 @@ func (n *BraceExpr) Codegen() string {
 }
 
 func (n *ReturnExpr) Codegen() string {
+	if n.Value == nil {
+		return "return"
+	}
 	return fmt.Sprintf("return %s", n.Value.Codegen())
 }
 
@@ -161,7 +387,7 @@ func (n *PrototypeAST) Codegen() string {
 		if len(args) > 0 {
 			args += ", "
 		}
-		args += arg
+		args += arg.Name
 	}
 
 	if n.Name == "" {
@@ -170,3 +396,228 @@ func (n *PrototypeAST) Codegen() string {
 
 	return fmt.Sprintf("function %s(%s)", n.Name, args)
 }
+
+func (n *StructAST) Codegen() string {
+	return n.CodegenClass(nil)
+}
+
+// CodegenClass emits a class whose constructor takes the fields as an
+// object, so a literal keeps the evaluation order it was written in. The
+// methods of impls become class methods.
+func (n *StructAST) CodegenClass(impls []*ImplAST) string {
+	body := ""
+	for _, field := range n.Fields {
+		body += fmt.Sprintf("this.%s = fields.%s; ", field.Name, field.Name)
+	}
+	class := fmt.Sprintf("constructor(fields) { %s}", body)
+
+	for _, impl := range impls {
+		for _, method := range impl.Methods {
+			class += " " + method.CodegenMethod()
+		}
+	}
+	return fmt.Sprintf("class %s { %s }", n.Name, class)
+}
+
+// CodegenMethod emits the function as a class method, self is bound to this
+// so that lambdas in the body capture it like any other variable.
+func (n *FunctionAST) CodegenMethod() string {
+	args := n.Proto.ArgNames()
+	prefix, body := "static ", ""
+	if n.HasSelf() {
+		args = args[1:]
+		prefix, body = "", "const self = this; "
+	}
+	if n.Body != nil {
+		body += n.Body.Codegen()
+	}
+	return fmt.Sprintf("%s%s(%s) { %s }", prefix, n.Proto.Name, strings.Join(args, ", "), body)
+}
+
+func (n *StructLiteralExpr) Codegen() string {
+	if len(n.Fields) == 0 {
+		return fmt.Sprintf("new %s({})", n.Name)
+	}
+
+	fields := ""
+	for i, field := range n.Fields {
+		if i > 0 {
+			fields += ", "
+		}
+		fields += fmt.Sprintf("%s: %s", field.Name, field.Value.Codegen())
+	}
+	return fmt.Sprintf("new %s({ %s })", n.Name, fields)
+}
+
+func (n *MemberExpr) Codegen() string {
+	return fmt.Sprintf("%s.%s", codegenOperand(n.Object), n.Field)
+}
+
+// Codegen emits the enum as an object with a constructor for each variant
+// with fields and a shared value for each variant without. Values carry the
+// variant name in $tag and their fields in $0, $1...
+func (n *EnumAST) Codegen() string {
+	variants := make([]string, len(n.Variants))
+	for i, variant := range n.Variants {
+		tag := quoteJsString(variant.Name)
+		if len(variant.Fields) == 0 {
+			variants[i] = fmt.Sprintf("%s: { $tag: %s }", variant.Name, tag)
+			continue
+		}
+
+		fields := make([]string, len(variant.Fields))
+		for j := range variant.Fields {
+			fields[j] = fmt.Sprintf("$%d", j)
+		}
+		params := strings.Join(fields, ", ")
+		variants[i] = fmt.Sprintf("%s: (%s) => ({ $tag: %s, %s })", variant.Name, params, tag, params)
+	}
+	return fmt.Sprintf("const %s = { %s };", n.Name, strings.Join(variants, ", "))
+}
+
+func (n *MatchExpr) Codegen() string {
+	if n.Statement {
+		return n.codegenStatement()
+	}
+	return n.codegenValue()
+}
+
+// codegenStatement emits the match as a labeled block, an arm leaves it
+// after its body ran.
+func (n *MatchExpr) codegenStatement() string {
+	subject := fmt.Sprintf("$m%d", n.Depth)
+	label := fmt.Sprintf("$match%d", n.Depth)
+
+	arms := ""
+	for _, arm := range n.Arms {
+		body := strings.TrimSpace(fmt.Sprintf("%s break %s;", codegenStatements(arm.Body), label))
+		arms += " " + arm.codegen(subject, body)
+	}
+	return fmt.Sprintf("%s: { const %s = %s;%s }", label, subject, n.Subject.Codegen(), arms)
+}
+
+// codegenValue emits the match as a function called with the subject, an
+// arm returns the value of its body.
+func (n *MatchExpr) codegenValue() string {
+	subject := fmt.Sprintf("$m%d", n.Depth)
+
+	arms := ""
+	for _, arm := range n.Arms {
+		arms += arm.codegen(subject, codegenReturn(arm.Body)) + " "
+	}
+	return fmt.Sprintf("((%s) => { %s})(%s)", subject, arms, n.Subject.Codegen())
+}
+
+// codegen emits the arm as a check of subject running body on a match.
+func (n *MatchArm) codegen(subject, body string) string {
+	tests, bindings := n.Pattern.codegen(subject, nil, "")
+	if n.Guard != nil {
+		body = fmt.Sprintf("if (%s) { %s }", n.Guard.Codegen(), body)
+	}
+	if len(tests) == 0 {
+		return fmt.Sprintf("{ %s%s }", bindings, body)
+	}
+	return fmt.Sprintf("if (%s) { %s%s }", strings.Join(tests, " && "), bindings, body)
+}
+
+// codegen appends the conditions for the value at path to match the pattern
+// to tests and the declarations of its bindings to bindings.
+func (n *Pattern) codegen(path string, tests []string, bindings string) ([]string, string) {
+	switch n.Kind {
+	case PATTERN_BINDING:
+		bindings += fmt.Sprintf("const %s = %s; ", n.Name, path)
+	case PATTERN_LITERAL:
+		tests = append(tests, fmt.Sprintf("%s === %s", path, n.Value.Codegen()))
+	case PATTERN_VARIANT:
+		tests = append(tests, fmt.Sprintf("%s.$tag === %s", path, quoteJsString(n.Variant)))
+		for i, arg := range n.Args {
+			tests, bindings = arg.codegen(fmt.Sprintf("%s.$%d", path, i), tests, bindings)
+		}
+	}
+	return tests, bindings
+}
+
+// codegenTarget emits the name or the destructuring pattern a declaration
+// or loop binds.
+func codegenTarget(name string, pattern *Pattern) string {
+	if pattern == nil {
+		return name
+	}
+	return pattern.codegenTarget()
+}
+
+// codegenTarget emits the pattern as a JavaScript destructuring target. A
+// wildcard element is a hole and a wildcard field is left out.
+func (n *Pattern) codegenTarget() string {
+	switch n.Kind {
+	case PATTERN_BINDING:
+		return n.Name
+	case PATTERN_REST:
+		return "..." + n.Name
+	case PATTERN_ARRAY:
+		elems := make([]string, 0, len(n.Args))
+		for _, elem := range n.Args {
+			// A rest without a name ignores what is left anyway.
+			if elem.Kind == PATTERN_REST && elem.Name == "" {
+				break
+			}
+			elems = append(elems, elem.codegenTarget())
+		}
+		// Trailing holes bind nothing.
+		for len(elems) > 0 && elems[len(elems)-1] == "" {
+			elems = elems[:len(elems)-1]
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case PATTERN_STRUCT:
+		fields := make([]string, 0, len(n.Fields))
+		for _, field := range n.Fields {
+			switch {
+			case field.Pattern.Kind == PATTERN_WILDCARD:
+			case field.Pattern.Kind == PATTERN_BINDING && field.Pattern.Name == field.Name:
+				fields = append(fields, field.Name)
+			default:
+				fields = append(fields, field.Name+": "+field.Pattern.codegenTarget())
+			}
+		}
+		if len(fields) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	default:
+		return ""
+	}
+}
+
+// codegenStatements emits body as a list of statements.
+func codegenStatements(body Expr) string {
+	if block, ok := body.(*BraceExpr); ok {
+		return block.Codegen()
+	}
+	return body.Codegen() + ";"
+}
+
+// codegenReturn emits body as statements returning its value, the value of a
+// block is the value of its last expression.
+func codegenReturn(body Expr) string {
+	exprs := []Expr{body}
+	if block, ok := body.(*BraceExpr); ok {
+		exprs = block.Exprs
+	}
+	if len(exprs) == 0 {
+		return "return;"
+	}
+
+	stmts := ""
+	for _, expr := range exprs[:len(exprs)-1] {
+		stmts += expr.Codegen() + "; "
+	}
+
+	switch last := exprs[len(exprs)-1].(type) {
+	case *MatchExpr:
+		return stmts + fmt.Sprintf("return %s;", last.codegenValue())
+	case *DeclarationExpr, *IfExpr, *ForExpr, *ForeachExpr, *WhileExpr, *ReturnExpr, *BraceExpr:
+		return stmts + last.Codegen() + "; return;"
+	default:
+		return stmts + fmt.Sprintf("return %s;", last.Codegen())
+	}
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+
 	"github.com/Kori-Sama/kori-compiler/cerr"
 	"github.com/Kori-Sama/kori-compiler/lexer"
 )
@@ -22,32 +24,74 @@ func NewIfExpr(cond, then, else_ Expr) *IfExpr {
 }
 
 func (p *Parser) parseIfExpr() (expr Expr) {
+	start := p.getCurTok()
 	p.nextToken()
-	cond := p.parseExpr()
+	cond := p.parseCondition()
 	if cond == nil {
 		return nil
 	}
 
 	then := p.parseBraceExpr()
+	if then == nil {
+		return nil
+	}
 
+	// An else if chain nests into Else, the lexer joins "else if" into a
+	// single token but a comment in between keeps them apart.
 	var else_ Expr
-	if p.getCurTok().Kind == lexer.TOKEN_ELSE {
-
+	switch p.getCurTok().Kind {
+	case lexer.TOKEN_ELSE_IF:
+		else_ = p.parseIfExpr()
+		if else_ == nil {
+			return nil
+		}
+	case lexer.TOKEN_ELSE:
 		p.nextToken()
-		else_ = p.parseBraceExpr()
+		if p.getCurTok().Kind == lexer.TOKEN_IF {
+			else_ = p.parseIfExpr()
+		} else {
+			else_ = p.parseBraceExpr()
+		}
+		if else_ == nil {
+			return nil
+		}
 	}
 	expr = NewIfExpr(cond, then, else_)
 
-	return expr
+	return p.finish(expr, start)
+}
+
+// LoopLabel is the optional label of a loop, `outer: for ...`, that break
+// and continue may name.
+type LoopLabel struct {
+	Label     string    `json:"label,omitempty"`
+	LabelSpan cerr.Span `json:"-"`
+}
+
+func (l *LoopLabel) GetLabel() *LoopLabel {
+	return l
 }
 
+// Loop is implemented by the loops, the targets of break and continue.
+type Loop interface {
+	Expr
+	GetLabel() *LoopLabel
+}
+
+var _ Loop = &ForExpr{}
+var _ Loop = &ForeachExpr{}
+var _ Loop = &WhileExpr{}
+
 type ForExpr struct {
 	BaseExpr
-	VarName string `json:"var_name"`
-	Start   Expr   `json:"start"`
-	End     Expr   `json:"end"`
-	Step    Expr   `json:"step"`
-	Body    Expr   `json:"body"`
+	LoopLabel
+	VarName   string    `json:"var_name"`
+	VarSpan   cerr.Span `json:"-"`
+	VarSymbol *Symbol   `json:"-"`
+	Start     Expr      `json:"start"`
+	End       Expr      `json:"end"`
+	Step      Expr      `json:"step"`
+	Body      Expr      `json:"body"`
 }
 
 func NewForExpr(varName string, start, end, step, body Expr) *ForExpr {
@@ -61,11 +105,21 @@ func NewForExpr(varName string, start, end, step, body Expr) *ForExpr {
 	}
 }
 
+// ForeachExpr loops over the elements of Array, or over its keys and values
+// if KeyName is set, `for k, v in m`. Each element is bound to VarName, or
+// destructured by Pattern, `for [i, x] in enumerate(arr)`.
 type ForeachExpr struct {
 	BaseExpr
-	VarName string `json:"var_name"`
-	Array   Expr   `json:"array"`
-	Body    Expr   `json:"body"`
+	LoopLabel
+	KeyName   string    `json:"key_name,omitempty"`
+	KeySpan   cerr.Span `json:"-"`
+	KeySymbol *Symbol   `json:"-"`
+	VarName   string    `json:"var_name"`
+	VarSpan   cerr.Span `json:"-"`
+	VarSymbol *Symbol   `json:"-"`
+	Pattern   *Pattern  `json:"pattern,omitempty"`
+	Array     Expr      `json:"array"`
+	Body      Expr      `json:"body"`
 }
 
 func NewForeachExpr(varName string, array, body Expr) *ForeachExpr {
@@ -78,109 +132,249 @@ func NewForeachExpr(varName string, array, body Expr) *ForeachExpr {
 }
 
 func (p *Parser) parseForExpr() (expr Expr) {
+	start := p.getCurTok()
 	p.nextToken()
 
 	if p.getCurTok().Kind == lexer.TOKEN_LBRACE {
 		body := p.parseBraceExpr()
+		if body == nil {
+			return nil
+		}
 		expr = NewForExpr("", nil, nil, nil, body)
-		return expr
+	} else if p.peekExpect(1, lexer.TOKEN_IN) || p.peekExpect(1, lexer.TOKEN_COMMA) || p.isPatternStart() {
+		expr = p.parseForeachExpr()
+	} else {
+		expr = p.parseNormalForExpr()
 	}
 
-	if p.peekExpect(1, lexer.TOKEN_IN) {
-		return p.parseForeachExpr()
-	} else {
-		return p.parseNormalForExpr()
+	if expr == nil {
+		return nil
 	}
+	return p.finish(expr, start)
 }
 
 func (p *Parser) parseNormalForExpr() (expr Expr) {
 	if p.getCurTok().Kind != lexer.TOKEN_VAR {
-		p.Err = cerr.NewParserError("Expected 'var' in for loop", p.getCurTok().Line, p.getCurTok().Location)
+		p.errorAt(p.getCurTok(), "Expected 'var' in for loop")
 		return nil
 	}
 
 	p.nextToken()
 
 	if p.getCurTok().Kind != lexer.TOKEN_NAME {
-		p.Err = cerr.NewParserError("Expected variable name in for loop", p.getCurTok().Line, p.getCurTok().Location)
+		p.errorAt(p.getCurTok(), "Expected variable name in for loop")
 		return nil
 	}
 
 	varName := p.getCurTok().Literal
+	varSpan := p.getCurTok().Span()
 	p.nextToken()
 
 	if p.getCurTok().Kind != lexer.TOKEN_ASSIGN {
-		p.Err = cerr.NewParserError("Expected '=' in for loop", p.getCurTok().Line, p.getCurTok().Location)
+		p.errorAt(p.getCurTok(), "Expected '=' in for loop")
 		return nil
 	}
 
 	p.nextToken()
 
-	start := p.parseExpr()
+	start := p.parseCondition()
 	if start == nil {
 		return nil
 	}
 
 	if p.getCurTok().Kind != lexer.TOKEN_SEMI {
-		p.Err = cerr.NewParserError("Expected ';' in for loop", p.getCurTok().Line, p.getCurTok().Location)
+		p.errorAt(p.getCurTok(), "Expected ';' in for loop")
 		return nil
 	}
 
 	p.nextToken()
 
-	cond := p.parseExpr()
+	cond := p.parseCondition()
 	if cond == nil {
 		return nil
 	}
 
 	if p.getCurTok().Kind != lexer.TOKEN_SEMI {
-		p.Err = cerr.NewParserError("Expected ';' in for loop", p.getCurTok().Line, p.getCurTok().Location)
+		p.errorAt(p.getCurTok(), "Expected ';' in for loop")
 		return nil
 	}
 
 	p.nextToken()
 
-	step := p.parseExpr()
+	step := p.parseCondition()
+	if step == nil {
+		return nil
+	}
 
-	p.nextToken()
+	if p.getCurTok().Kind == lexer.TOKEN_SEMI {
+		p.nextToken()
+	}
 
 	body := p.parseBraceExpr()
+	if body == nil {
+		return nil
+	}
 
-	expr = NewForExpr(varName, start, cond, step, body)
-
-	return expr
+	loop := NewForExpr(varName, start, cond, step, body)
+	loop.VarSpan = varSpan
+	return loop
 }
 
 func (p *Parser) parseForeachExpr() (expr Expr) {
+	keyName := ""
+	var keySpan cerr.Span
+	if p.getCurTok().Kind == lexer.TOKEN_NAME && p.peekExpect(1, lexer.TOKEN_COMMA) {
+		keyName, keySpan = p.getCurTok().Literal, p.getCurTok().Span()
+		p.nextToken()
+		p.nextToken()
+	}
 
-	if p.getCurTok().Kind != lexer.TOKEN_NAME {
-		p.Err = cerr.NewParserError("Expected variable name in foreach loop", p.getCurTok().Line, p.getCurTok().Location)
+	pattern := p.parseBindingPattern()
+	if pattern == nil {
 		return nil
 	}
-
-	varName := p.getCurTok().Literal
-	p.nextToken()
+	varName, varSpan := "", pattern.Span
+	switch pattern.Kind {
+	case PATTERN_BINDING:
+		varName, pattern = pattern.Name, nil
+	case PATTERN_WILDCARD:
+		varName, pattern = "_", nil
+	}
 
 	if p.getCurTok().Kind != lexer.TOKEN_IN {
-		p.Err = cerr.NewParserError("Expected 'in' in foreach loop", p.getCurTok().Line, p.getCurTok().Location)
+		p.errorAt(p.getCurTok(), "Expected 'in' in foreach loop")
 		return nil
 	}
 
 	p.nextToken()
 
-	array := p.parseExpr()
+	array := p.parseCondition()
 	if array == nil {
-		p.Error("Expected array in foreach loop")
 		return nil
 	}
 
 	body := p.parseBraceExpr()
+	if body == nil {
+		return nil
+	}
 
-	expr = NewForeachExpr(varName, array, body)
+	foreach := NewForeachExpr(varName, array, body)
+	foreach.KeyName = keyName
+	foreach.KeySpan = keySpan
+	foreach.VarSpan = varSpan
+	foreach.Pattern = pattern
+	expr = foreach
 
 	return expr
 }
 
+type WhileExpr struct {
+	BaseExpr
+	LoopLabel
+	Cond Expr `json:"cond"`
+	Body Expr `json:"body"`
+}
+
+func NewWhileExpr(cond, body Expr) *WhileExpr {
+	return &WhileExpr{
+		BaseExpr: BaseExpr{Type: EXPR_WHILE},
+		Cond:     cond,
+		Body:     body,
+	}
+}
+
+func (p *Parser) parseWhileExpr() Expr {
+	start := p.getCurTok()
+	p.nextToken()
+
+	cond := p.parseCondition()
+	if cond == nil {
+		return nil
+	}
+
+	body := p.parseBraceExpr()
+	if body == nil {
+		return nil
+	}
+
+	return p.finish(NewWhileExpr(cond, body), start)
+}
+
+// parseLabeledLoop parses `label: loop`.
+func (p *Parser) parseLabeledLoop() Expr {
+	label := p.getCurTok()
+	p.nextToken()
+	p.nextToken()
+
+	var loop Expr
+	switch p.getCurTok().Kind {
+	case lexer.TOKEN_FOR:
+		loop = p.parseForExpr()
+	case lexer.TOKEN_WHILE:
+		loop = p.parseWhileExpr()
+	default:
+		p.Error(fmt.Sprintf("Expected a loop after label '%s', found %s", label.Literal, describe(p.getCurTok())))
+		return nil
+	}
+	if loop == nil {
+		return nil
+	}
+
+	loopLabel := loop.(Loop).GetLabel()
+	loopLabel.Label = label.Literal
+	loopLabel.LabelSpan = label.Span()
+	return p.finish(loop, label)
+}
+
+// BreakExpr leaves the innermost loop, or the loop called Label.
+type BreakExpr struct {
+	BaseExpr
+	Label string `json:"label,omitempty"`
+}
+
+// ContinueExpr starts the next iteration of the innermost loop, or of the
+// loop called Label.
+type ContinueExpr struct {
+	BaseExpr
+	Label string `json:"label,omitempty"`
+}
+
+func NewBreakExpr(label string) *BreakExpr {
+	return &BreakExpr{
+		BaseExpr: BaseExpr{Type: EXPR_BREAK},
+		Label:    label,
+	}
+}
+
+func NewContinueExpr(label string) *ContinueExpr {
+	return &ContinueExpr{
+		BaseExpr: BaseExpr{Type: EXPR_CONTINUE},
+		Label:    label,
+	}
+}
+
+func (p *Parser) parseBreakExpr() Expr {
+	start := p.getCurTok()
+	p.nextToken()
+	return p.finish(NewBreakExpr(p.parseLabelRef()), start)
+}
+
+func (p *Parser) parseContinueExpr() Expr {
+	start := p.getCurTok()
+	p.nextToken()
+	return p.finish(NewContinueExpr(p.parseLabelRef()), start)
+}
+
+// parseLabelRef parses the optional label after break or continue.
+func (p *Parser) parseLabelRef() string {
+	tok := p.getCurTok()
+	if tok.Kind != lexer.TOKEN_NAME {
+		return ""
+	}
+	p.nextToken()
+	return tok.Literal
+}
+
 type ReturnExpr struct {
 	BaseExpr
 	Value Expr `json:"value"`
@@ -194,11 +388,20 @@ func NewReturnExpr(value Expr) *ReturnExpr {
 }
 
 func (p *Parser) parseReturnExpr() (expr Expr) {
+	start := p.getCurTok()
 	p.nextToken()
 
+	kind := p.getCurTok().Kind
+	if kind == lexer.TOKEN_SEMI || kind == lexer.TOKEN_RBRACE {
+		return p.finish(NewReturnExpr(nil), start)
+	}
+
 	value := p.parseExpr()
+	if value == nil {
+		return nil
+	}
 
 	expr = NewReturnExpr(value)
 
-	return expr
+	return p.finish(expr, start)
 }
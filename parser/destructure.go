@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+// FieldPattern is a field of a struct pattern, `x` is short for `x: x`.
+type FieldPattern struct {
+	Name    string    `json:"name"`
+	Pattern *Pattern  `json:"pattern"`
+	Span    cerr.Span `json:"span"`
+}
+
+// Bindings returns the binding patterns in n in source order, the named rest
+// patterns included.
+func (n *Pattern) Bindings() []*Pattern {
+	var res []*Pattern
+	var walk func(pat *Pattern)
+	walk = func(pat *Pattern) {
+		switch pat.Kind {
+		case PATTERN_BINDING:
+			res = append(res, pat)
+		case PATTERN_REST:
+			if pat.Name != "" {
+				res = append(res, pat)
+			}
+		}
+		for _, arg := range pat.Args {
+			walk(arg)
+		}
+		for _, field := range pat.Fields {
+			walk(field.Pattern)
+		}
+	}
+	walk(n)
+	return res
+}
+
+// isPatternStart reports whether a destructuring pattern starts at the
+// current token, rather than a plain name.
+func (p *Parser) isPatternStart() bool {
+	switch p.getCurTok().Kind {
+	case lexer.TOKEN_LBRACKET:
+		return true
+	case lexer.TOKEN_NAME:
+		return p.peekExpect(1, lexer.TOKEN_LBRACE)
+	}
+	return false
+}
+
+// parseBindingPattern parses the pattern of a destructuring declaration or
+// loop: a name, `_`, an array pattern `[a, _, ..rest]` or a struct pattern
+// `Point { x, y: py }`. Unlike in a match, no pattern tests the value, so
+// literals and variants are not allowed.
+func (p *Parser) parseBindingPattern() *Pattern {
+	tok := p.getCurTok()
+	switch tok.Kind {
+	case lexer.TOKEN_LBRACKET:
+		return p.parseArrayPattern()
+	case lexer.TOKEN_NAME:
+		if p.peekExpect(1, lexer.TOKEN_LBRACE) {
+			return p.parseStructPattern()
+		}
+		p.nextToken()
+		if tok.Literal == "_" {
+			return &Pattern{Kind: PATTERN_WILDCARD, Span: tok.Span()}
+		}
+		return &Pattern{Kind: PATTERN_BINDING, Name: tok.Literal, Span: tok.Span()}
+	default:
+		p.errorAt(tok, fmt.Sprintf("Expected a name or a pattern, found %s", describe(tok)))
+		return nil
+	}
+}
+
+func (p *Parser) parseArrayPattern() *Pattern {
+	start := p.getCurTok()
+	p.nextToken()
+
+	elems := make([]*Pattern, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACKET {
+		var elem *Pattern
+		if p.getCurTok().Kind == lexer.TOKEN_DOT_DOT {
+			elem = p.parseRestPattern()
+		} else {
+			elem = p.parseBindingPattern()
+		}
+		if elem == nil {
+			return nil
+		}
+		elems = append(elems, elem)
+
+		if p.getCurTok().Kind == lexer.TOKEN_RBRACKET {
+			break
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+			p.Error(fmt.Sprintf("Expected ',' or ']' in array pattern, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		p.nextToken()
+
+		// JavaScript only collects the elements at the end.
+		if elem.Kind == PATTERN_REST && p.getCurTok().Kind != lexer.TOKEN_RBRACKET {
+			p.Diags.Error(cerr.CODE_SYNTAX, elem.Span, "A rest pattern must be the last element of an array pattern")
+			p.panicking = true
+			return nil
+		}
+	}
+	p.nextToken()
+
+	return &Pattern{Kind: PATTERN_ARRAY, Args: elems, Span: p.spanFrom(start)}
+}
+
+// parseRestPattern parses `..name`, or `..` which ignores the remaining
+// elements.
+func (p *Parser) parseRestPattern() *Pattern {
+	start := p.getCurTok()
+	p.nextToken()
+
+	name := ""
+	if p.getCurTok().Kind == lexer.TOKEN_NAME {
+		name = p.getCurTok().Literal
+		p.nextToken()
+	}
+	return &Pattern{Kind: PATTERN_REST, Name: name, Span: p.spanFrom(start)}
+}
+
+func (p *Parser) parseStructPattern() *Pattern {
+	start := p.getCurTok()
+	p.nextToken()
+	p.nextToken()
+
+	fields := make([]*FieldPattern, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+		name := p.getCurTok()
+		if name.Kind != lexer.TOKEN_NAME {
+			p.Error(fmt.Sprintf("Expected field name in struct pattern, found %s", describe(name)))
+			return nil
+		}
+		p.nextToken()
+
+		pattern := &Pattern{Kind: PATTERN_BINDING, Name: name.Literal, Span: name.Span()}
+		if p.getCurTok().Kind == lexer.TOKEN_COLON {
+			p.nextToken()
+			pattern = p.parseBindingPattern()
+			if pattern == nil {
+				return nil
+			}
+		}
+		fields = append(fields, &FieldPattern{Name: name.Literal, Pattern: pattern, Span: p.spanFrom(name)})
+
+		if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
+			break
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+			p.Error(fmt.Sprintf("Expected ',' or '}' in struct pattern, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		p.nextToken()
+	}
+	p.nextToken()
+
+	return &Pattern{Kind: PATTERN_STRUCT, Struct: start.Literal, Fields: fields, Span: p.spanFrom(start)}
+}
@@ -8,6 +8,7 @@ const (
 	EXPR_NUMBER       ExprType = "Number"
 	EXPR_BOOLEAN      ExprType = "Boolean"
 	EXPR_STRING       ExprType = "String"
+	EXPR_INTERPOLATED ExprType = "InterpolatedString"
 	EXPR_VARIABLE     ExprType = "Variable"
 	EXPR_ARRAY        ExprType = "Array"
 	EXPR_BINARY       ExprType = "Binary"
@@ -22,7 +23,55 @@ const (
 	EXPR_BRACE        ExprType = "Brace"
 	EXPR_LAMBDA       ExprType = "Lambda"
 	EXPR_INDEX        ExprType = "Index"
-	EXPR_INDEX_ASSIGN ExprType = "IndexAssign"
+	EXPR_ERROR        ExprType = "Error"
+	EXPR_STRUCT       ExprType = "StructLiteral"
+	EXPR_MEMBER       ExprType = "Member"
+	EXPR_MATCH        ExprType = "Match"
+	EXPR_WHILE        ExprType = "While"
+	EXPR_BREAK        ExprType = "Break"
+	EXPR_CONTINUE     ExprType = "Continue"
+	EXPR_MAP          ExprType = "Map"
+	EXPR_RANGE        ExprType = "Range"
+)
+
+type SymbolKind string
+
+const (
+	SYMBOL_VARIABLE SymbolKind = "Variable"
+	SYMBOL_PARAM    SymbolKind = "Param"
+	SYMBOL_BINDING  SymbolKind = "Binding"
+	SYMBOL_FUNCTION SymbolKind = "Function"
+	SYMBOL_STRUCT   SymbolKind = "Struct"
+	SYMBOL_ENUM     SymbolKind = "Enum"
+	SYMBOL_BUILTIN  SymbolKind = "Builtin"
+)
+
+// TypeKind is the kind of a Type, see TYPE_NAMED for structs and enums.
+type TypeKind string
+
+const (
+	TYPE_ANY    TypeKind = "any"
+	TYPE_NUMBER TypeKind = "number"
+	TYPE_STRING TypeKind = "string"
+	TYPE_BOOL   TypeKind = "bool"
+	TYPE_VOID   TypeKind = "void"
+	TYPE_ARRAY  TypeKind = "array"
+	TYPE_MAP    TypeKind = "map"
+	TYPE_FUNC   TypeKind = "func"
+	TYPE_NAMED  TypeKind = "named"
+	TYPE_VAR    TypeKind = "var"
+)
+
+type PatternKind string
+
+const (
+	PATTERN_WILDCARD PatternKind = "Wildcard"
+	PATTERN_BINDING  PatternKind = "Binding"
+	PATTERN_LITERAL  PatternKind = "Literal"
+	PATTERN_VARIANT  PatternKind = "Variant"
+	PATTERN_ARRAY    PatternKind = "Array"
+	PATTERN_STRUCT   PatternKind = "Struct"
+	PATTERN_REST     PatternKind = "Rest"
 )
 
 type OpKind string
@@ -32,16 +81,25 @@ const (
 	OP_SUB         OpKind = "-"
 	OP_MUL         OpKind = "*"
 	OP_DIV         OpKind = "/"
+	OP_MOD         OpKind = "%"
+	OP_POW         OpKind = "**"
 	OP_LESS        OpKind = "<"
 	OP_GREATER     OpKind = ">"
 	OP_LESS_EQ     OpKind = "<="
 	OP_GREATER_EQ  OpKind = ">="
 	OP_EQ          OpKind = "=="
+	OP_NOT_EQ      OpKind = "!="
 	OP_AND         OpKind = "&"
 	OP_OR          OpKind = "|"
+	OP_XOR         OpKind = "^"
+	OP_SHIFT_LEFT  OpKind = "<<"
+	OP_SHIFT_RIGHT OpKind = ">>"
 	OP_LOGICAL_AND OpKind = "&&"
 	OP_LOGICAL_OR  OpKind = "||"
 	OP_NOT         OpKind = "!"
+	OP_NEG         OpKind = "-"
+	OP_PLUS        OpKind = "+"
+	OP_BIT_NOT     OpKind = "~"
 	OP_UNKNOWN     OpKind = "UNKNOWN"
 )
 
@@ -52,7 +110,10 @@ func isOpKind(tokenKind lexer.TokenKind) bool {
 		lexer.TOKEN_LESS_EQ, lexer.TOKEN_GREATER_EQ,
 		lexer.TOKEN_AND, lexer.TOKEN_OR,
 		lexer.TOKEN_LOGICAL_AND, lexer.TOKEN_LOGICAL_OR,
-		lexer.TOKEN_EQ, lexer.TOKEN_PLUS, lexer.TOKEN_MINUS, lexer.TOKEN_STAR, lexer.TOKEN_SLASH:
+		lexer.TOKEN_EQ, lexer.TOKEN_NOT_EQ,
+		lexer.TOKEN_PLUS, lexer.TOKEN_MINUS, lexer.TOKEN_STAR, lexer.TOKEN_SLASH,
+		lexer.TOKEN_PERCENT, lexer.TOKEN_STAR_STAR, lexer.TOKEN_CARET,
+		lexer.TOKEN_SHIFT_LEFT, lexer.TOKEN_SHIFT_RIGHT:
 		return true
 	default:
 		return false
@@ -71,6 +132,8 @@ func getBinOpKind(kind lexer.TokenKind) OpKind {
 		return OP_GREATER_EQ
 	case lexer.TOKEN_EQ:
 		return OP_EQ
+	case lexer.TOKEN_NOT_EQ:
+		return OP_NOT_EQ
 	case lexer.TOKEN_PLUS:
 		return OP_ADD
 	case lexer.TOKEN_MINUS:
@@ -79,6 +142,16 @@ func getBinOpKind(kind lexer.TokenKind) OpKind {
 		return OP_MUL
 	case lexer.TOKEN_SLASH:
 		return OP_DIV
+	case lexer.TOKEN_PERCENT:
+		return OP_MOD
+	case lexer.TOKEN_STAR_STAR:
+		return OP_POW
+	case lexer.TOKEN_CARET:
+		return OP_XOR
+	case lexer.TOKEN_SHIFT_LEFT:
+		return OP_SHIFT_LEFT
+	case lexer.TOKEN_SHIFT_RIGHT:
+		return OP_SHIFT_RIGHT
 	case lexer.TOKEN_AND:
 		return OP_AND
 	case lexer.TOKEN_OR:
@@ -91,3 +164,37 @@ func getBinOpKind(kind lexer.TokenKind) OpKind {
 		return OP_UNKNOWN
 	}
 }
+
+// getAssignOpKind returns the operator of a compound assignment, or an empty
+// OpKind for '='. ok is false if kind is no assignment.
+func getAssignOpKind(kind lexer.TokenKind) (op OpKind, ok bool) {
+	switch kind {
+	case lexer.TOKEN_ASSIGN:
+		return "", true
+	case lexer.TOKEN_PLUS_EQ:
+		return OP_ADD, true
+	case lexer.TOKEN_MINUS_EQ:
+		return OP_SUB, true
+	case lexer.TOKEN_STAR_EQ:
+		return OP_MUL, true
+	case lexer.TOKEN_SLASH_EQ:
+		return OP_DIV, true
+	default:
+		return "", false
+	}
+}
+
+func getUnaryOpKind(kind lexer.TokenKind) OpKind {
+	switch kind {
+	case lexer.TOKEN_BANG:
+		return OP_NOT
+	case lexer.TOKEN_MINUS:
+		return OP_NEG
+	case lexer.TOKEN_PLUS:
+		return OP_PLUS
+	case lexer.TOKEN_TILDE:
+		return OP_BIT_NOT
+	default:
+		return OP_UNKNOWN
+	}
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+// Variant is a case of an enum, a variant without Fields is a plain value
+// like Shape.Empty, the others are built like calls: Shape.Circle(1).
+type Variant struct {
+	Name   string    `json:"name"`
+	Fields []string  `json:"fields"`
+	Span   cerr.Span `json:"span"`
+}
+
+type EnumAST struct {
+	Type     string     `json:"type"`
+	Name     string     `json:"name"`
+	Variants []*Variant `json:"variants"`
+	Span     cerr.Span  `json:"span"`
+	NameSpan cerr.Span  `json:"name_span"`
+}
+
+func NewEnumAST(name string, variants []*Variant) *EnumAST {
+	return &EnumAST{
+		Type:     "Enum",
+		Name:     name,
+		Variants: variants,
+	}
+}
+
+// Variant returns the variant called name, or nil.
+func (e *EnumAST) Variant(name string) *Variant {
+	for _, variant := range e.Variants {
+		if variant.Name == name {
+			return variant
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseEnum() *EnumAST {
+	start := p.getCurTok()
+	p.nextToken()
+
+	name := p.getCurTok()
+	if name.Kind != lexer.TOKEN_NAME {
+		p.Error(fmt.Sprintf("Expected enum name, found %s", describe(name)))
+		return nil
+	}
+	p.nextToken()
+
+	if p.getCurTok().Kind != lexer.TOKEN_LBRACE {
+		p.Expect("{", "enum declaration")
+		return nil
+	}
+	p.nextToken()
+
+	variants := make([]*Variant, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+		variant := p.parseVariant()
+		if variant == nil {
+			return nil
+		}
+		variants = append(variants, variant)
+
+		if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
+			break
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+			p.Error(fmt.Sprintf("Expected ',' or '}' in enum declaration, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		p.nextToken()
+	}
+	p.nextToken()
+
+	enum := NewEnumAST(name.Literal, variants)
+	enum.Span = p.spanFrom(start)
+	enum.NameSpan = name.Span()
+	return enum
+}
+
+func (p *Parser) parseVariant() *Variant {
+	tok := p.getCurTok()
+	if tok.Kind != lexer.TOKEN_NAME {
+		p.Error(fmt.Sprintf("Expected variant name, found %s", describe(tok)))
+		return nil
+	}
+	p.nextToken()
+
+	fields := make([]string, 0)
+	if p.getCurTok().Kind == lexer.TOKEN_LPAREN {
+		p.nextToken()
+		for p.getCurTok().Kind != lexer.TOKEN_RPAREN {
+			field := p.getCurTok()
+			if field.Kind != lexer.TOKEN_NAME {
+				p.Error(fmt.Sprintf("Expected field name, found %s", describe(field)))
+				return nil
+			}
+			fields = append(fields, field.Literal)
+			p.nextToken()
+
+			if p.getCurTok().Kind == lexer.TOKEN_RPAREN {
+				break
+			}
+			if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+				p.Error(fmt.Sprintf("Expected ',' or ')' in variant, found %s", describe(p.getCurTok())))
+				return nil
+			}
+			p.nextToken()
+		}
+		p.nextToken()
+	}
+
+	return &Variant{Name: tok.Literal, Fields: fields, Span: p.spanFrom(tok)}
+}
@@ -1,8 +1,22 @@
 package parser
 
+import "github.com/Kori-Sama/kori-compiler/cerr"
+
 type Expr interface {
 	ICodegen
 	GetType() ExprType
+	// GetSpan returns the source range of the expression, it is zero for
+	// nodes the parser synthesized.
+	GetSpan() cerr.Span
+	SetSpan(span cerr.Span)
+	// GetValueType returns the type the checker found for the value of the
+	// expression, it is nil before analysis.Check. It may be a type variable,
+	// see Type.Resolve.
+	GetValueType() *Type
+	SetValueType(typ *Type)
+	// Helpers returns the runtime helpers called by the code generated for
+	// the expression itself, not its operands. They are recorded by Codegen.
+	Helpers() []string
 }
 
 var _ Expr = &NumberExpr{}
@@ -13,9 +27,14 @@ var _ Expr = &IfExpr{}
 var _ Expr = &ForExpr{}
 var _ Expr = &AssignExpr{}
 var _ Expr = &DeclarationExpr{}
+var _ Expr = &InterpolatedStringExpr{}
+var _ Expr = &ErrorExpr{}
 
 type BaseExpr struct {
-	Type ExprType `json:"type"`
+	Type      ExprType  `json:"type"`
+	Span      cerr.Span `json:"span"`
+	ValueType *Type     `json:"value_type,omitempty"`
+	helpers   []string
 }
 
 type NumberExpr struct {
@@ -33,9 +52,21 @@ type StringExpr struct {
 	Val string `json:"val"`
 }
 
+// InterpolatedStringExpr is a string literal with embedded expressions,
+// Parts always holds one more element than Exprs and they interleave as
+// Parts[0] Exprs[0] Parts[1] ... Parts[n].
+type InterpolatedStringExpr struct {
+	BaseExpr
+	Parts []string `json:"parts"`
+	Exprs []Expr   `json:"exprs"`
+}
+
+// VariableExpr is a use of a name, Symbol is its declaration once the
+// program is resolved.
 type VariableExpr struct {
 	BaseExpr
-	Name string `json:"name"`
+	Name   string  `json:"name"`
+	Symbol *Symbol `json:"-"`
 }
 
 type ArrayExpr struct {
@@ -61,16 +92,27 @@ type BraceExpr struct {
 	Exprs []Expr `json:"exprs"`
 }
 
+// CallExpr calls the value of Callee, a method call has a MemberExpr as its
+// Callee.
 type CallExpr struct {
 	BaseExpr
-	Callee string `json:"callee"`
+	Callee Expr   `json:"callee"`
 	Args   []Expr `json:"args"`
 }
 
+// ErrorExpr stands for a statement that failed to parse, so that the rest of
+// the tree stays usable after a syntax error.
+type ErrorExpr struct {
+	BaseExpr
+}
+
 type IndexExpr struct {
 	BaseExpr
-	Array string `json:"array"`
-	Index Expr   `json:"index"`
+	Array Expr `json:"array"`
+	Index Expr `json:"index"`
+	// Dynamic is set when the indexed value may be a Map, the access goes
+	// through a runtime helper then.
+	Dynamic bool `json:"-"`
 }
 
 func NewNumberExpr(val float64) *NumberExpr {
@@ -94,6 +136,14 @@ func NewStringExpr(val string) *StringExpr {
 	}
 }
 
+func NewInterpolatedStringExpr(parts []string, exprs []Expr) *InterpolatedStringExpr {
+	return &InterpolatedStringExpr{
+		BaseExpr: BaseExpr{Type: EXPR_INTERPOLATED},
+		Parts:    parts,
+		Exprs:    exprs,
+	}
+}
+
 func NewVariableExpr(name string) *VariableExpr {
 	return &VariableExpr{
 		BaseExpr: BaseExpr{Type: EXPR_VARIABLE},
@@ -132,7 +182,7 @@ func NewBraceExpr(exprs []Expr) *BraceExpr {
 	}
 }
 
-func NewCallExpr(callee string, args []Expr) *CallExpr {
+func NewCallExpr(callee Expr, args []Expr) *CallExpr {
 	return &CallExpr{
 		BaseExpr: BaseExpr{Type: EXPR_CALL},
 		Callee:   callee,
@@ -140,7 +190,31 @@ func NewCallExpr(callee string, args []Expr) *CallExpr {
 	}
 }
 
-func NewIndexExpr(array string, index Expr) *IndexExpr {
+// Symbol returns the declaration of the called name, nil if the callee is
+// not a name or the program is not resolved.
+func (n *CallExpr) Symbol() *Symbol {
+	if variable, ok := n.Callee.(*VariableExpr); ok {
+		return variable.Symbol
+	}
+	return nil
+}
+
+// CalleeName returns the name of the called function if the callee is a
+// plain name, or "".
+func (n *CallExpr) CalleeName() string {
+	if variable, ok := n.Callee.(*VariableExpr); ok {
+		return variable.Name
+	}
+	return ""
+}
+
+func NewErrorExpr() *ErrorExpr {
+	return &ErrorExpr{
+		BaseExpr: BaseExpr{Type: EXPR_ERROR},
+	}
+}
+
+func NewIndexExpr(array, index Expr) *IndexExpr {
 	return &IndexExpr{
 		BaseExpr: BaseExpr{Type: EXPR_INDEX},
 		Array:    array,
@@ -151,3 +225,23 @@ func NewIndexExpr(array string, index Expr) *IndexExpr {
 func (n *BaseExpr) GetType() ExprType {
 	return n.Type
 }
+
+func (n *BaseExpr) GetSpan() cerr.Span {
+	return n.Span
+}
+
+func (n *BaseExpr) SetSpan(span cerr.Span) {
+	n.Span = span
+}
+
+func (n *BaseExpr) GetValueType() *Type {
+	return n.ValueType
+}
+
+func (n *BaseExpr) SetValueType(typ *Type) {
+	n.ValueType = typ
+}
+
+func (n *BaseExpr) Helpers() []string {
+	return n.helpers
+}
@@ -2,22 +2,97 @@ package parser
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 
 	"github.com/Kori-Sama/kori-compiler/cerr"
 	"github.com/Kori-Sama/kori-compiler/lexer"
 )
 
 func (p *Parser) parseExpr() Expr {
+	if isRangeOp(p.getCurTok().Kind) {
+		return p.parseRangeExpr(nil)
+	}
+
 	lhs := p.parsePrimary()
 	if lhs == nil {
 		return nil
 	}
 
-	return p.parseBinOpRHS(0, lhs)
+	expr := p.parseBinOpRHS(0, lhs)
+	if expr != nil && isRangeOp(p.getCurTok().Kind) {
+		return p.parseRangeExpr(expr)
+	}
+	return expr
 }
 
 func (p *Parser) parsePrimary() Expr {
+	expr := p.parseOperand()
+	if expr == nil {
+		return nil
+	}
+
+	// These end a statement, `if c { } (x)` is no call.
+	switch expr.(type) {
+	case *BraceExpr, *IfExpr, *ForExpr, *ForeachExpr, *WhileExpr, *MatchExpr:
+		return expr
+	}
+	return p.parsePostfixExpr(expr)
+}
+
+// parsePostfixExpr parses the calls, indexing and member accesses chained to
+// expr, and an assignment to the resulting place.
+func (p *Parser) parsePostfixExpr(expr Expr) Expr {
+	for {
+		switch p.getCurTok().Kind {
+		case lexer.TOKEN_LPAREN:
+			args := p.parseCallArgs()
+			if args == nil {
+				return nil
+			}
+			call := NewCallExpr(expr, args)
+			call.Span = expr.GetSpan().To(p.prevTok().Span())
+			expr = call
+		case lexer.TOKEN_LBRACKET:
+			p.nextToken()
+			index := p.parseNestedExpr()
+			if index == nil {
+				return nil
+			}
+			if p.getCurTok().Kind != lexer.TOKEN_RBRACKET {
+				p.Error(fmt.Sprintf("Expected ']', found %s", describe(p.getCurTok())))
+				return nil
+			}
+			p.nextToken()
+
+			indexExpr := NewIndexExpr(expr, index)
+			indexExpr.Span = expr.GetSpan().To(p.prevTok().Span())
+			expr = indexExpr
+		case lexer.TOKEN_DOT:
+			p.nextToken()
+			field := p.getCurTok()
+			if field.Kind != lexer.TOKEN_NAME {
+				p.Error(fmt.Sprintf("Expected field name after '.', found %s", describe(field)))
+				return nil
+			}
+			p.nextToken()
+
+			member := NewMemberExpr(expr, field.Literal)
+			member.FieldSpan = field.Span()
+			member.Span = expr.GetSpan().To(field.Span())
+			expr = member
+		default:
+			if _, ok := getAssignOpKind(p.getCurTok().Kind); ok {
+				return p.parseAssignExpr(expr)
+			}
+			return expr
+		}
+	}
+}
+
+func (p *Parser) parseOperand() Expr {
 	tok := p.getCurTok()
 	switch tok.Kind {
 	case lexer.TOKEN_NUMBER:
@@ -26,11 +101,18 @@ func (p *Parser) parsePrimary() Expr {
 		return p.parseBooleanExpr()
 	case lexer.TOKEN_STRING:
 		return p.parseStringExpr()
+	case lexer.TOKEN_STRING_HEAD:
+		return p.parseInterpolatedStringExpr()
 	case lexer.TOKEN_LBRACKET:
 		return p.parseArrayExpr()
+	case lexer.TOKEN_HASH_LBRACE:
+		return p.parseMapExpr()
 	case lexer.TOKEN_LPAREN:
 		return p.parseParenExpr()
 	case lexer.TOKEN_NAME:
+		if p.peekExpect(1, lexer.TOKEN_COLON) && (p.peekExpect(2, lexer.TOKEN_FOR) || p.peekExpect(2, lexer.TOKEN_WHILE)) {
+			return p.parseLabeledLoop()
+		}
 		return p.parseIdentifierExpr()
 	case lexer.TOKEN_LBRACE:
 		return p.parseBraceExpr()
@@ -38,20 +120,27 @@ func (p *Parser) parsePrimary() Expr {
 		return p.parseIfExpr()
 	case lexer.TOKEN_FOR:
 		return p.parseForExpr()
+	case lexer.TOKEN_MATCH:
+		return p.parseMatchExpr()
+	case lexer.TOKEN_WHILE:
+		return p.parseWhileExpr()
+	case lexer.TOKEN_BREAK:
+		return p.parseBreakExpr()
+	case lexer.TOKEN_CONTINUE:
+		return p.parseContinueExpr()
 	case lexer.TOKEN_LET, lexer.TOKEN_VAR:
 		return p.parseDeclarationExpr()
+	case lexer.TOKEN_CONST:
+		p.errorAt(tok, "'const' is only allowed at the top level, use 'let' instead")
+		return nil
 	case lexer.TOKEN_FUNC:
 		return p.parseLambdaExpr()
 	case lexer.TOKEN_RETURN:
 		return p.parseReturnExpr()
-	case lexer.TOKEN_BANG:
+	case lexer.TOKEN_BANG, lexer.TOKEN_MINUS, lexer.TOKEN_PLUS, lexer.TOKEN_TILDE:
 		return p.parseUnaryExpr()
-	case lexer.TOKEN_SEMI:
-		return nil
-	case lexer.TOKEN_EOF:
-		return nil
 	default:
-		p.Err = cerr.NewParserError(fmt.Sprintf("Unknown token '%s' when expecting an expression", tok.Literal), tok.Line, tok.Location)
+		p.errorAt(tok, fmt.Sprintf("Expected an expression, found %s", describe(tok)))
 		return nil
 	}
 }
@@ -84,23 +173,29 @@ func (p *Parser) parseBinOpRHS(exprPrec int, lhs Expr) Expr {
 			return nil
 		}
 
+		// A tighter operator, or the same right associative one, takes rhs
+		// as its left operand.
+		minPrec := prec + 1
+		if rightAssociative[binOp] {
+			minPrec = prec
+		}
 		nextPrec := binOpPrecedence[getBinOpKind(p.getCurTok().Kind)]
-		if prec < nextPrec {
-			rhs = p.parseBinOpRHS(prec+1, rhs)
+		if nextPrec >= minPrec {
+			rhs = p.parseBinOpRHS(minPrec, rhs)
 			if rhs == nil {
 				return nil
 			}
 		}
 
-		lhs = NewBinaryExpr(binOp, lhs, rhs)
+		binary := NewBinaryExpr(binOp, lhs, rhs)
+		binary.Span = lhs.GetSpan().To(rhs.GetSpan())
+		lhs = binary
 	}
 }
 
 func (p *Parser) parseUnaryExpr() Expr {
-	var op OpKind
-	if p.getCurTok().Kind == lexer.TOKEN_BANG {
-		op = OP_NOT
-	}
+	start := p.getCurTok()
+	op := getUnaryOpKind(start.Kind)
 
 	p.nextToken()
 
@@ -109,71 +204,108 @@ func (p *Parser) parseUnaryExpr() Expr {
 		return nil
 	}
 
-	return NewUnaryExpr(op, expr)
+	expr = p.parseBinOpRHS(binOpPrecedence[OP_POW], expr)
+	if expr == nil {
+		return nil
+	}
+
+	return p.finish(NewUnaryExpr(op, expr), start)
 }
 
+// parseBraceExpr parses a block. A statement that fails to parse is replaced
+// by an ErrorExpr and parsing goes on with the next one.
 func (p *Parser) parseBraceExpr() Expr {
-	p.nextToken()
-
-	if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
-		p.nextToken()
+	start := p.getCurTok()
+	if start.Kind != lexer.TOKEN_LBRACE {
+		p.Error(fmt.Sprintf("Expected '{', found %s", describe(start)))
 		return nil
 	}
+	p.nextToken()
 
-	var exprs []Expr
+	exprs := make([]Expr, 0)
 	for {
-		if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
+		tok := p.getCurTok()
+		if tok.Kind == lexer.TOKEN_RBRACE {
 			break
 		}
+		if tok.Kind == lexer.TOKEN_EOF {
+			p.Error("Expected '}' at the end of the block")
+			return p.finish(NewBraceExpr(exprs), start)
+		}
+		if tok.Kind == lexer.TOKEN_SEMI {
+			p.nextToken()
+			continue
+		}
 
-		expr := p.parseExpr()
+		expr := p.parseNestedExpr()
 		if expr == nil {
-			return nil
+			p.synchronize()
+			exprs = append(exprs, p.finish(NewErrorExpr(), tok))
+			continue
 		}
 
+		markStatement(expr)
 		exprs = append(exprs, expr)
 
-		if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
-			break
-		}
-
-		if p.getCurTok().Kind != lexer.TOKEN_SEMI {
-			p.Error("Expected ';' or '}' in block")
-		}
-
-		if p.getCurTok().Kind == lexer.TOKEN_SEMI {
+		switch {
+		case p.getCurTok().Kind == lexer.TOKEN_RBRACE:
+		case p.getCurTok().Kind == lexer.TOKEN_SEMI:
 			p.nextToken()
+		case p.prevTokIs(lexer.TOKEN_RBRACE):
+			// Expressions ending with a block, like if, for and match, need
+			// no ';'.
+		default:
+			p.Error(fmt.Sprintf("Expected ';' or '}' after expression, found %s", describe(p.getCurTok())))
+			p.synchronize()
 		}
 	}
 
 	p.nextToken()
-	return NewBraceExpr(exprs)
+	return p.finish(NewBraceExpr(exprs), start)
 }
 
 func (p *Parser) parseNumberExpr() (expr Expr) {
 	tok := p.getCurTok()
 	if tok.Kind != lexer.TOKEN_NUMBER {
-		p.Err = cerr.NewParserError("Expected number", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected number")
 		return nil
 	}
 
-	val, err := strconv.ParseFloat(tok.Literal, 64)
-
+	val, err := parseNumberLiteral(tok.Literal)
 	if err != nil {
-		p.Err = cerr.NewParserError("Could not parse number", tok.Line, tok.Location)
+		p.report(cerr.CODE_NUMBER_OUT_OF_RANGE, tok, fmt.Sprintf("Number literal %s is out of range", tok.Literal))
 		return nil
 	}
 	expr = NewNumberExpr(val)
 
 	p.nextToken()
 
-	return expr
+	return p.finish(expr, tok)
+}
+
+// parseNumberLiteral converts a literal already validated by the lexer. Prefixed
+// integers may exceed 64 bits, they are rounded to the nearest float64 like
+// JavaScript does.
+func parseNumberLiteral(lit string) (float64, error) {
+	if len(lit) > 2 && lit[0] == '0' && strings.ContainsRune("xXbBoO", rune(lit[1])) {
+		n, ok := new(big.Int).SetString(lit, 0)
+		if !ok {
+			return 0, strconv.ErrSyntax
+		}
+		val, _ := new(big.Float).SetInt(n).Float64()
+		if math.IsInf(val, 0) {
+			return 0, strconv.ErrRange
+		}
+		return val, nil
+	}
+
+	return strconv.ParseFloat(lit, 64)
 }
 
 func (p *Parser) parseBooleanExpr() (expr Expr) {
 	tok := p.getCurTok()
 	if tok.Kind != lexer.TOKEN_TRUE && tok.Kind != lexer.TOKEN_FALSE {
-		p.Err = cerr.NewParserError("Expected boolean", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected boolean")
 		return nil
 	}
 
@@ -182,13 +314,13 @@ func (p *Parser) parseBooleanExpr() (expr Expr) {
 
 	p.nextToken()
 
-	return expr
+	return p.finish(expr, tok)
 }
 
 func (p *Parser) parseStringExpr() (expr Expr) {
 	tok := p.getCurTok()
 	if tok.Kind != lexer.TOKEN_STRING {
-		p.Err = cerr.NewParserError("Expected string", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected string")
 		return nil
 	}
 
@@ -196,24 +328,56 @@ func (p *Parser) parseStringExpr() (expr Expr) {
 
 	p.nextToken()
 
-	return expr
+	return p.finish(expr, tok)
 }
 
-func (p *Parser) parseArrayExpr() (expr Expr) {
-	p.nextToken()
+func (p *Parser) parseInterpolatedStringExpr() (expr Expr) {
+	start := p.getCurTok()
+	parts := []string{start.Literal}
+	var exprs []Expr
 
-	if p.getCurTok().Kind == lexer.TOKEN_RBRACKET {
+	for {
 		p.nextToken()
-		return nil
+
+		tok := p.getCurTok()
+		if tok.Kind == lexer.TOKEN_STRING_MIDDLE || tok.Kind == lexer.TOKEN_STRING_TAIL {
+			p.errorAt(tok, "Expected expression in string interpolation")
+			return nil
+		}
+
+		value := p.parseNestedExpr()
+		if value == nil {
+			return nil
+		}
+		exprs = append(exprs, value)
+
+		tok = p.getCurTok()
+		if tok.Kind != lexer.TOKEN_STRING_MIDDLE && tok.Kind != lexer.TOKEN_STRING_TAIL {
+			p.errorAt(tok, "Expected '}' after expression in string interpolation")
+			return nil
+		}
+		parts = append(parts, tok.Literal)
+
+		if tok.Kind == lexer.TOKEN_STRING_TAIL {
+			break
+		}
 	}
 
-	var values []Expr
+	p.nextToken()
+	return p.finish(NewInterpolatedStringExpr(parts, exprs), start)
+}
+
+func (p *Parser) parseArrayExpr() (expr Expr) {
+	start := p.getCurTok()
+	p.nextToken()
+
+	values := make([]Expr, 0)
 	for {
 		if p.getCurTok().Kind == lexer.TOKEN_RBRACKET {
 			break
 		}
 
-		value := p.parseExpr()
+		value := p.parseNestedExpr()
 		if value == nil {
 			return nil
 		}
@@ -225,7 +389,7 @@ func (p *Parser) parseArrayExpr() (expr Expr) {
 		}
 
 		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
-			p.Err = cerr.NewParserError("Expected ',' or ']' in array", p.getCurTok().Line, p.getCurTok().Location)
+			p.Error(fmt.Sprintf("Expected ',' or ']' in array, found %s", describe(p.getCurTok())))
 			return nil
 		}
 
@@ -233,20 +397,20 @@ func (p *Parser) parseArrayExpr() (expr Expr) {
 	}
 
 	p.nextToken()
-	return NewArrayExpr(values)
+	return p.finish(NewArrayExpr(values), start)
 }
 
 func (p *Parser) parseParenExpr() (expr Expr) {
 	p.nextToken()
 
-	expr = p.parseExpr()
+	expr = p.parseNestedExpr()
 	if expr == nil {
 		return nil
 	}
 
 	tok := p.getCurTok()
 	if tok.Kind != lexer.TOKEN_RPAREN {
-		p.Err = cerr.NewParserError("Expected ')'", tok.Line, tok.Location)
+		p.errorAt(tok, fmt.Sprintf("Expected ')', found %s", describe(tok)))
 		return nil
 	}
 
@@ -256,44 +420,32 @@ func (p *Parser) parseParenExpr() (expr Expr) {
 }
 
 func (p *Parser) parseIdentifierExpr() (expr Expr) {
-	if p.peekExpect(1, lexer.TOKEN_ASSIGN) {
-		return p.parseAssignExpr()
-	}
-
-	if p.peekExpect(1, lexer.TOKEN_LBRACKET) {
-		return p.parseIndexExpr()
-	}
-
-	if p.peekExpect(1, lexer.TOKEN_PLUS_EQ) ||
-		p.peekExpect(1, lexer.TOKEN_MINUS_EQ) ||
-		p.peekExpect(1, lexer.TOKEN_STAR_EQ) ||
-		p.peekExpect(1, lexer.TOKEN_SLASH_EQ) {
-		return p.parseAssignOpExpr()
-	}
-
 	tok := p.getCurTok()
 	if tok.Kind != lexer.TOKEN_NAME {
-		p.Err = cerr.NewParserError("Expected identifier", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected identifier")
 		return nil
 	}
 	p.nextToken()
 
-	if p.getCurTok().Kind != lexer.TOKEN_LPAREN {
-		return NewVariableExpr(tok.Literal)
+	if p.isStructLiteralStart() {
+		return p.parseStructLiteral(tok)
 	}
 
+	return p.finish(NewVariableExpr(tok.Literal), tok)
+}
+
+// parseCallArgs parses a parenthesized argument list, it returns nil on a
+// syntax error.
+func (p *Parser) parseCallArgs() []Expr {
 	p.nextToken()
 
 	args := make([]Expr, 0)
 	if p.getCurTok().Kind == lexer.TOKEN_RPAREN {
 		p.nextToken()
-		if p.getCurTok().Kind == lexer.TOKEN_SEMI {
-			p.nextToken()
-		}
-		return NewCallExpr(tok.Literal, args)
+		return args
 	}
 	for {
-		arg := p.parseExpr()
+		arg := p.parseNestedExpr()
 		if arg == nil {
 			return nil
 		}
@@ -304,7 +456,7 @@ func (p *Parser) parseIdentifierExpr() (expr Expr) {
 		}
 
 		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
-			p.Err = cerr.NewParserError("Expected ',' or ')' in arguments", tok.Line, tok.Location)
+			p.Error(fmt.Sprintf("Expected ',' or ')' in arguments, found %s", describe(p.getCurTok())))
 			return nil
 		}
 
@@ -312,43 +464,5 @@ func (p *Parser) parseIdentifierExpr() (expr Expr) {
 	}
 
 	p.nextToken()
-	return NewCallExpr(tok.Literal, args)
-}
-
-func (p *Parser) parseIndexExpr() (expr Expr) {
-	tok := p.getCurTok()
-	if tok.Kind != lexer.TOKEN_NAME {
-		p.Err = cerr.NewParserError("Expected identifier", tok.Line, tok.Location)
-		return nil
-	}
-	p.nextToken()
-
-	if p.getCurTok().Kind != lexer.TOKEN_LBRACKET {
-		p.Err = cerr.NewParserError("Expected '['", tok.Line, tok.Location)
-		return nil
-	}
-	p.nextToken()
-
-	index := p.parseExpr()
-	if index == nil {
-		return nil
-	}
-
-	if p.getCurTok().Kind != lexer.TOKEN_RBRACKET {
-		p.Err = cerr.NewParserError("Expected ']'", tok.Line, tok.Location)
-		return nil
-	}
-	p.nextToken()
-
-	if p.getCurTok().Kind == lexer.TOKEN_ASSIGN {
-		p.nextToken()
-		value := p.parseExpr()
-		if value == nil {
-			return nil
-		}
-
-		return NewIndexAssignExpr(tok.Literal, index, value)
-	}
-
-	return NewIndexExpr(tok.Literal, index)
+	return args
 }
@@ -8,13 +8,20 @@ import (
 type PrototypeAST struct {
 	Type string   `json:"type"`
 	Name string   `json:"name"`
-	Args []string `json:"args"`
+	Args []*Param `json:"args"`
+	// Result is the annotated return type, `func f() -> int`.
+	Result *Type `json:"result,omitempty"`
+	// Signature is the type the checker inferred for the function, self
+	// included.
+	Signature *Type     `json:"signature,omitempty"`
+	Span      cerr.Span `json:"span"`
 }
 
 type FunctionAST struct {
 	Type  string        `json:"type"`
 	Proto *PrototypeAST `json:"proto"`
 	Body  Expr          `json:"body"`
+	Span  cerr.Span     `json:"span"`
 }
 
 type LambdaExpr struct {
@@ -23,7 +30,7 @@ type LambdaExpr struct {
 	Body  Expr          `json:"body"`
 }
 
-func NewPrototypeAST(name string, args []string) *PrototypeAST {
+func NewPrototypeAST(name string, args []*Param) *PrototypeAST {
 	return &PrototypeAST{
 		Type: "Prototype",
 		Name: name,
@@ -31,6 +38,15 @@ func NewPrototypeAST(name string, args []string) *PrototypeAST {
 	}
 }
 
+// ArgNames returns the names of the parameters.
+func (n *PrototypeAST) ArgNames() []string {
+	names := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		names[i] = arg.Name
+	}
+	return names
+}
+
 func NewFunctionAST(proto *PrototypeAST, body Expr) *FunctionAST {
 	return &FunctionAST{
 		Type:  "Function",
@@ -48,6 +64,7 @@ func NewLambdaExpr(proto *PrototypeAST, body Expr) *LambdaExpr {
 }
 
 func (p *Parser) parseLambdaExpr() Expr {
+	start := p.getCurTok()
 	p.nextToken()
 
 	proto := p.parsePrototype()
@@ -57,7 +74,11 @@ func (p *Parser) parseLambdaExpr() Expr {
 
 	body := p.parseBraceExpr()
 
-	return NewLambdaExpr(proto, body)
+	if body == nil {
+		return nil
+	}
+
+	return p.finish(NewLambdaExpr(proto, body), start)
 }
 
 func (p *Parser) parsePrototype() *PrototypeAST {
@@ -69,21 +90,25 @@ func (p *Parser) parsePrototype() *PrototypeAST {
 	}
 
 	if p.getCurTok().Kind != lexer.TOKEN_LPAREN {
-		p.Err = cerr.NewParserError("Expected '(' in prototype", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected '(' in prototype")
 		return nil
 	}
 
 	p.nextToken()
 
-	args := make([]string, 0)
+	args := make([]*Param, 0)
 	for p.getCurTok().Kind != lexer.TOKEN_RPAREN {
 		arg := p.getCurTok()
 		if arg.Kind != lexer.TOKEN_NAME {
-			p.Err = cerr.NewParserError("Expected argument name in prototype", arg.Line, arg.Location)
+			p.errorAt(arg, "Expected argument name in prototype")
 			return nil
 		}
-		args = append(args, arg.Literal)
 		p.nextToken()
+		typ, ok := p.parseAnnotation()
+		if !ok {
+			return nil
+		}
+		args = append(args, &Param{Name: arg.Literal, Type: typ, Span: arg.Span()})
 
 		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
 			break
@@ -92,16 +117,26 @@ func (p *Parser) parsePrototype() *PrototypeAST {
 	}
 
 	if p.getCurTok().Kind != lexer.TOKEN_RPAREN {
-		p.Err = cerr.NewParserError("Expected ')' in prototype", tok.Line, tok.Location)
+		p.errorAt(tok, "Expected ')' in prototype")
 		return nil
 	}
 
 	p.nextToken()
 
-	return NewPrototypeAST(name, args)
+	proto := NewPrototypeAST(name, args)
+	proto.Span = p.spanFrom(tok)
+
+	if p.getCurTok().Kind == lexer.TOKEN_ARROW {
+		p.nextToken()
+		if proto.Result = p.parseType(); proto.Result == nil {
+			return nil
+		}
+	}
+	return proto
 }
 
 func (p *Parser) parseFunction() *FunctionAST {
+	start := p.getCurTok()
 	p.nextToken()
 
 	proto := p.parsePrototype()
@@ -114,5 +149,7 @@ func (p *Parser) parseFunction() *FunctionAST {
 		return nil
 	}
 
-	return NewFunctionAST(proto, body)
+	fn := NewFunctionAST(proto, body)
+	fn.Span = p.spanFrom(start)
+	return fn
 }
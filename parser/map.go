@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+// MapEntry is a `key: value` pair of a map literal, the key is an expression
+// like the value.
+type MapEntry struct {
+	Key   Expr      `json:"key"`
+	Value Expr      `json:"value"`
+	Span  cerr.Span `json:"span"`
+}
+
+// MapExpr is a map literal, `#{ "a": 1 }`. It is emitted as a plain object
+// unless JsMap is set.
+type MapExpr struct {
+	BaseExpr
+	Entries []*MapEntry `json:"entries"`
+	JsMap   bool        `json:"-"`
+}
+
+func NewMapExpr(entries []*MapEntry) *MapExpr {
+	return &MapExpr{
+		BaseExpr: BaseExpr{Type: EXPR_MAP},
+		Entries:  entries,
+	}
+}
+
+func (p *Parser) parseMapExpr() Expr {
+	start := p.getCurTok()
+	p.nextToken()
+
+	entries := make([]*MapEntry, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+		entryStart := p.getCurTok()
+		key := p.parseNestedExpr()
+		if key == nil {
+			return nil
+		}
+
+		if p.getCurTok().Kind != lexer.TOKEN_COLON {
+			p.Error(fmt.Sprintf("Expected ':' after map key, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		p.nextToken()
+
+		value := p.parseNestedExpr()
+		if value == nil {
+			return nil
+		}
+		entries = append(entries, &MapEntry{Key: key, Value: value, Span: p.spanFrom(entryStart)})
+
+		if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
+			break
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+			p.Error(fmt.Sprintf("Expected ',' or '}' in map literal, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		p.nextToken()
+	}
+	p.nextToken()
+
+	return p.finish(NewMapExpr(entries), start)
+}
@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+// Pattern is the left side of a match arm or of a destructuring declaration.
+// Literal patterns hold their value in Value, variant patterns are always
+// qualified by their enum, so a bare name is a binding. Args are the fields of
+// a variant or the elements of an array pattern, a rest pattern binds Name to
+// the remaining elements unless Name is empty.
+//
+// Array, struct and rest patterns are only allowed in declarations and
+// loops, see parseBindingPattern.
+type Pattern struct {
+	Kind    PatternKind     `json:"kind"`
+	Name    string          `json:"name,omitempty"`
+	Value   Expr            `json:"value,omitempty"`
+	Enum    string          `json:"enum,omitempty"`
+	Variant string          `json:"variant,omitempty"`
+	Args    []*Pattern      `json:"args,omitempty"`
+	Struct  string          `json:"struct,omitempty"`
+	Fields  []*FieldPattern `json:"fields,omitempty"`
+	Span    cerr.Span       `json:"span"`
+	// Symbol is the name a binding declares once the program is resolved.
+	Symbol *Symbol `json:"-"`
+}
+
+type MatchArm struct {
+	Pattern *Pattern  `json:"pattern"`
+	Guard   Expr      `json:"guard"`
+	Body    Expr      `json:"body"`
+	Span    cerr.Span `json:"span"`
+}
+
+// MatchExpr runs the first arm whose pattern matches the subject and whose
+// guard holds. A match written as a statement of a block runs its arms as
+// statements, anywhere else it is a value and the arms are expressions.
+type MatchExpr struct {
+	BaseExpr
+	Subject   Expr        `json:"subject"`
+	Arms      []*MatchArm `json:"arms"`
+	Statement bool        `json:"statement"`
+	// Depth is the number of matches enclosing this one, it keeps the names
+	// generated for nested matches apart.
+	Depth int `json:"-"`
+}
+
+func NewMatchExpr(subject Expr, arms []*MatchArm) *MatchExpr {
+	return &MatchExpr{
+		BaseExpr: BaseExpr{Type: EXPR_MATCH},
+		Subject:  subject,
+		Arms:     arms,
+	}
+}
+
+// markStatement marks expr as used as a statement if it is a match, see
+// MatchExpr.
+func markStatement(expr Expr) {
+	match, ok := expr.(*MatchExpr)
+	if !ok {
+		return
+	}
+	match.Statement = true
+	for _, arm := range match.Arms {
+		markStatement(arm.Body)
+	}
+}
+
+func (p *Parser) parseMatchExpr() Expr {
+	start := p.getCurTok()
+	p.nextToken()
+
+	depth := p.matchDepth
+	p.matchDepth++
+	defer func() { p.matchDepth-- }()
+
+	subject := p.parseCondition()
+	if subject == nil {
+		return nil
+	}
+
+	if p.getCurTok().Kind != lexer.TOKEN_LBRACE {
+		p.Error(fmt.Sprintf("Expected '{' after match subject, found %s", describe(p.getCurTok())))
+		return nil
+	}
+	p.nextToken()
+
+	arms := make([]*MatchArm, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		arms = append(arms, arm)
+
+		switch {
+		case p.getCurTok().Kind == lexer.TOKEN_RBRACE:
+		case p.getCurTok().Kind == lexer.TOKEN_COMMA:
+			p.nextToken()
+		case p.prevTokIs(lexer.TOKEN_RBRACE):
+			// An arm ending with a block needs no ','.
+		default:
+			p.Error(fmt.Sprintf("Expected ',' or '}' after match arm, found %s", describe(p.getCurTok())))
+			return nil
+		}
+	}
+	p.nextToken()
+
+	match := NewMatchExpr(subject, arms)
+	match.Depth = depth
+	return p.finish(match, start)
+}
+
+func (p *Parser) parseMatchArm() *MatchArm {
+	start := p.getCurTok()
+	pattern := p.parsePattern()
+	if pattern == nil {
+		return nil
+	}
+
+	var guard Expr
+	if p.getCurTok().Kind == lexer.TOKEN_IF {
+		p.nextToken()
+		guard = p.parseNestedExpr()
+		if guard == nil {
+			return nil
+		}
+	}
+
+	if p.getCurTok().Kind != lexer.TOKEN_FAT_ARROW {
+		p.Error(fmt.Sprintf("Expected '=>' in match arm, found %s", describe(p.getCurTok())))
+		return nil
+	}
+	p.nextToken()
+
+	// A block ends the arm, the next one may start with '-'.
+	var body Expr
+	if p.getCurTok().Kind == lexer.TOKEN_LBRACE {
+		body = p.parseBraceExpr()
+	} else {
+		body = p.parseNestedExpr()
+	}
+	if body == nil {
+		return nil
+	}
+
+	return &MatchArm{Pattern: pattern, Guard: guard, Body: body, Span: p.spanFrom(start)}
+}
+
+func (p *Parser) parsePattern() *Pattern {
+	tok := p.getCurTok()
+	switch tok.Kind {
+	case lexer.TOKEN_NUMBER:
+		return p.parseLiteralPattern(p.parseNumberExpr, tok)
+	case lexer.TOKEN_STRING:
+		return p.parseLiteralPattern(p.parseStringExpr, tok)
+	case lexer.TOKEN_TRUE, lexer.TOKEN_FALSE:
+		return p.parseLiteralPattern(p.parseBooleanExpr, tok)
+	case lexer.TOKEN_MINUS:
+		p.nextToken()
+		if p.getCurTok().Kind != lexer.TOKEN_NUMBER {
+			p.Error(fmt.Sprintf("Expected a number after '-' in pattern, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		pattern := p.parseLiteralPattern(p.parseNumberExpr, tok)
+		if pattern != nil {
+			number := pattern.Value.(*NumberExpr)
+			number.Val = -number.Val
+			number.Span = pattern.Span
+		}
+		return pattern
+	case lexer.TOKEN_NAME:
+		p.nextToken()
+		if p.getCurTok().Kind == lexer.TOKEN_DOT {
+			return p.parseVariantPattern(tok)
+		}
+		if tok.Literal == "_" {
+			return &Pattern{Kind: PATTERN_WILDCARD, Span: tok.Span()}
+		}
+		return &Pattern{Kind: PATTERN_BINDING, Name: tok.Literal, Span: tok.Span()}
+	default:
+		p.errorAt(tok, fmt.Sprintf("Expected a pattern, found %s", describe(tok)))
+		return nil
+	}
+}
+
+func (p *Parser) parseLiteralPattern(parse func() Expr, start *lexer.Token) *Pattern {
+	value := parse()
+	if value == nil {
+		return nil
+	}
+	return &Pattern{Kind: PATTERN_LITERAL, Value: value, Span: p.spanFrom(start)}
+}
+
+// parseVariantPattern parses Enum.Variant or Enum.Variant(patterns...), the
+// enum name has already been consumed.
+func (p *Parser) parseVariantPattern(enum *lexer.Token) *Pattern {
+	p.nextToken()
+
+	variant := p.getCurTok()
+	if variant.Kind != lexer.TOKEN_NAME {
+		p.Error(fmt.Sprintf("Expected variant name after '.', found %s", describe(variant)))
+		return nil
+	}
+	p.nextToken()
+
+	args := make([]*Pattern, 0)
+	if p.getCurTok().Kind == lexer.TOKEN_LPAREN {
+		p.nextToken()
+		for p.getCurTok().Kind != lexer.TOKEN_RPAREN {
+			arg := p.parsePattern()
+			if arg == nil {
+				return nil
+			}
+			args = append(args, arg)
+
+			if p.getCurTok().Kind == lexer.TOKEN_RPAREN {
+				break
+			}
+			if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+				p.Error(fmt.Sprintf("Expected ',' or ')' in pattern, found %s", describe(p.getCurTok())))
+				return nil
+			}
+			p.nextToken()
+		}
+		p.nextToken()
+	}
+
+	return &Pattern{
+		Kind:    PATTERN_VARIANT,
+		Enum:    enum.Literal,
+		Variant: variant.Literal,
+		Args:    args,
+		Span:    p.spanFrom(enum),
+	}
+}
@@ -10,21 +10,162 @@ import (
 type Parser struct {
 	tokens []*lexer.Token
 	curTok int
-	Err    *cerr.ParserError
-	token  *lexer.Token
+	// Diags receives the syntax errors, pass the lexer's collector to get a
+	// single list for the whole compilation.
+	Diags *cerr.Diagnostics
+	// panicking is set from a syntax error until the parser synchronizes,
+	// errors in between are most likely caused by the first one and are
+	// not reported.
+	panicking bool
+	// noStructLiteral is set while parsing a condition, where a '{' after a
+	// name opens the body instead of a struct literal.
+	noStructLiteral bool
+	// matchDepth counts the match expressions being parsed, see
+	// MatchExpr.Depth.
+	matchDepth int
 }
 
+// Error reports a syntax error at the current token.
 func (p *Parser) Error(message string) {
-	cerr.NewParserError(message, p.token.Line, p.token.Location)
+	p.errorAt(p.getCurTok(), message)
 }
 
 func (p *Parser) Expect(what, where string) {
-	cerr.NewParserError(fmt.Sprintf("Expect '%s' int %s", what, where), p.token.Line, p.token.Location)
+	p.Error(fmt.Sprintf("Expected '%s' in %s", what, where))
+}
+
+func (p *Parser) errorAt(tok *lexer.Token, message string) {
+	p.report(cerr.CODE_SYNTAX, tok, message)
+}
+
+func (p *Parser) report(code cerr.Code, tok *lexer.Token, message string) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	// The lexer already explained what is wrong with an illegal token.
+	if tok.Kind == lexer.TOKEN_ILLEGAL {
+		return
+	}
+	p.Diags.Error(code, tok.Span(), "%s", message)
+}
+
+// synchronize skips the rest of a statement that failed to parse: up to and
+// including the next ';', up to the '}' closing the enclosing block, or up to
+// the next 'func'. Blocks met on the way are skipped as a whole. At the end
+// of the file nothing is left to recover, the parser stays panicking so the
+// blocks left open are not reported again.
+func (p *Parser) synchronize() {
+	depth := 0
+loop:
+	for {
+		switch p.getCurTok().Kind {
+		case lexer.TOKEN_EOF:
+			return
+		case lexer.TOKEN_LBRACE:
+			depth++
+		case lexer.TOKEN_RBRACE:
+			if depth == 0 {
+				break loop
+			}
+			depth--
+			if depth == 0 {
+				p.nextToken()
+				break loop
+			}
+		case lexer.TOKEN_SEMI:
+			if depth == 0 {
+				p.nextToken()
+				break loop
+			}
+		case lexer.TOKEN_FUNC:
+			if depth == 0 {
+				break loop
+			}
+		}
+		p.nextToken()
+	}
+	p.panicking = false
+}
+
+// synchronizeTopLevel skips to the next declaration that is not nested in a
+// block.
+func (p *Parser) synchronizeTopLevel() {
+	depth := 0
+	for {
+		tok := p.getCurTok()
+		if tok.Kind == lexer.TOKEN_EOF || (isDeclarationStart(tok.Kind) && depth == 0) {
+			break
+		}
+		if tok.Kind == lexer.TOKEN_LBRACE {
+			depth++
+		}
+		if tok.Kind == lexer.TOKEN_RBRACE && depth > 0 {
+			depth--
+		}
+		p.nextToken()
+	}
+	p.panicking = false
+}
+
+// parseCondition parses the condition or header of if and loops, see
+// noStructLiteral.
+func (p *Parser) parseCondition() Expr {
+	saved := p.noStructLiteral
+	p.noStructLiteral = true
+	expr := p.parseExpr()
+	p.noStructLiteral = saved
+	return expr
+}
+
+// parseNestedExpr parses an expression enclosed in delimiters, where struct
+// literals are unambiguous again even inside a condition.
+func (p *Parser) parseNestedExpr() Expr {
+	saved := p.noStructLiteral
+	p.noStructLiteral = false
+	expr := p.parseExpr()
+	p.noStructLiteral = saved
+	return expr
+}
+
+// spanFrom returns the span from start up to the last consumed token.
+func (p *Parser) spanFrom(start *lexer.Token) cerr.Span {
+	end := start.End
+	if p.curTok > 0 && p.curTok <= len(p.tokens) {
+		if prev := p.tokens[p.curTok-1]; prev.Offset >= start.Offset {
+			end = prev.End
+		}
+	}
+	return cerr.Span{File: start.File, Start: start.Pos(), End: end}
+}
+
+// finish sets the span of node from start up to the last consumed token.
+func (p *Parser) finish(node Expr, start *lexer.Token) Expr {
+	node.SetSpan(p.spanFrom(start))
+	return node
+}
+
+// describe names a token for "found ..." parts of error messages.
+func describe(tok *lexer.Token) string {
+	if tok.Kind == lexer.TOKEN_EOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("'%s'", tok.Literal)
 }
 
 func NewParser(tokens []*lexer.Token) *Parser {
+	// Comments only reach the parser when the lexer keeps them for tooling,
+	// they carry no meaning here.
+	filtered := make([]*lexer.Token, 0, len(tokens))
+	for _, tok := range tokens {
+		if tok.Kind != lexer.TOKEN_COMMENT {
+			filtered = append(filtered, tok)
+		}
+	}
+
 	return &Parser{
-		tokens: tokens,
+		tokens: filtered,
+		Diags:  cerr.NewDiagnostics(),
 	}
 }
 
@@ -33,7 +174,6 @@ func (p *Parser) nextToken() {
 		return
 	}
 	p.curTok++
-	p.token = p.tokens[p.curTok]
 }
 
 func (p *Parser) getCurTok() *lexer.Token {
@@ -43,6 +183,17 @@ func (p *Parser) getCurTok() *lexer.Token {
 	return p.tokens[p.curTok]
 }
 
+func (p *Parser) prevTok() *lexer.Token {
+	if p.curTok == 0 {
+		return p.tokens[0]
+	}
+	return p.tokens[p.curTok-1]
+}
+
+func (p *Parser) prevTokIs(kind lexer.TokenKind) bool {
+	return p.curTok > 0 && p.tokens[p.curTok-1].Kind == kind
+}
+
 func (p *Parser) peekExpect(offset int, expect lexer.TokenKind) bool {
 	if p.curTok+offset >= len(p.tokens) {
 		return false
@@ -50,72 +201,91 @@ func (p *Parser) peekExpect(offset int, expect lexer.TokenKind) bool {
 	return p.tokens[p.curTok+offset].Kind == expect
 }
 
+// binOpPrecedence lists the binary operators from loosest to tightest
+// binding. All of them are left associative except '**', see
+// rightAssociative. Prefix operators bind tighter than all binary operators
+// but '**', so -2 ** 2 is -(2 ** 2).
 var binOpPrecedence = map[OpKind]int{
-	OP_LESS:       10,
-	OP_GREATER:    10,
-	OP_LESS_EQ:    10,
-	OP_GREATER_EQ: 10,
-	OP_EQ:         10,
-	OP_ADD:        20,
-	OP_SUB:        20,
-	OP_MUL:        40,
-	OP_DIV:        40,
+	OP_LOGICAL_OR:  10,
+	OP_LOGICAL_AND: 20,
+	OP_OR:          30,
+	OP_XOR:         40,
+	OP_AND:         50,
+	OP_EQ:          60,
+	OP_NOT_EQ:      60,
+	OP_LESS:        70,
+	OP_GREATER:     70,
+	OP_LESS_EQ:     70,
+	OP_GREATER_EQ:  70,
+	OP_SHIFT_LEFT:  80,
+	OP_SHIFT_RIGHT: 80,
+	OP_ADD:         90,
+	OP_SUB:         90,
+	OP_MUL:         100,
+	OP_DIV:         100,
+	OP_MOD:         100,
+	OP_POW:         110,
 }
 
-func (p *Parser) HandleFunction() *FunctionAST {
-	fn := p.parseFunction()
-	if fn == nil {
-		return nil
-	}
-	return fn
+var rightAssociative = map[OpKind]bool{
+	OP_POW: true,
 }
 
-func (p *Parser) HandleTopLevel() *FunctionAST {
-	fn := p.parseTopLevelExpr()
+func (p *Parser) HandleFunction() *FunctionAST {
+	fn := p.parseFunction()
 	if fn == nil {
 		return nil
 	}
-	p.nextToken()
-
-	fn.Proto.Name = "TopLevel"
-
 	return fn
 }
 
-func (p *Parser) parseTopLevelExpr() *FunctionAST {
-	expr := p.parseExpr()
-	if expr == nil {
-		return nil
-	}
-
-	proto := NewPrototypeAST("", nil)
-	return NewFunctionAST(proto, expr)
-}
-
-func (p *Parser) Parse() []*FunctionAST {
-	var res []*FunctionAST
+// Parse parses the whole program. Syntax errors are reported to Diags and
+// parsing resumes after them, so the result may be a partial AST where
+// statements that failed to parse are replaced by ErrorExpr.
+func (p *Parser) Parse() *Program {
+	res := NewProgram()
 	for {
-		var fn *FunctionAST
 		tok := p.getCurTok()
 		if tok == nil {
 			goto out
 		}
 
-		if p.Err != nil {
-			goto out
-		}
 		switch tok.Kind {
 		case lexer.TOKEN_EOF:
 			goto out
 		case lexer.TOKEN_SEMI:
 			p.nextToken()
 		case lexer.TOKEN_FUNC:
-			fn = p.HandleFunction()
-			res = append(res, fn)
+			fn := p.HandleFunction()
+			if fn != nil {
+				res.Functions = append(res.Functions, fn)
+			}
+		case lexer.TOKEN_LET, lexer.TOKEN_VAR, lexer.TOKEN_CONST:
+			global := p.parseGlobal()
+			if global != nil {
+				res.Globals = append(res.Globals, global)
+			}
+		case lexer.TOKEN_STRUCT:
+			st := p.parseStruct()
+			if st != nil {
+				res.Structs = append(res.Structs, st)
+			}
+		case lexer.TOKEN_IMPL:
+			impl := p.parseImpl()
+			if impl != nil {
+				res.Impls = append(res.Impls, impl)
+			}
+		case lexer.TOKEN_ENUM:
+			enum := p.parseEnum()
+			if enum != nil {
+				res.Enums = append(res.Enums, enum)
+			}
 		default:
-			continue
-			// fn = p.HandleTopLevel()
-			// res = append(res, fn)
+			p.parseTopLevelExpr()
+		}
+
+		if p.panicking {
+			p.synchronizeTopLevel()
 		}
 	}
 out:
@@ -2,8 +2,10 @@ package parser
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 
+	"github.com/Kori-Sama/kori-compiler/cerr"
 	"github.com/Kori-Sama/kori-compiler/lexer"
 )
 
@@ -24,8 +26,8 @@ func TestParser(t *testing.T) {
 	parser := NewParser(lexer.ParseAll())
 	res := parser.Parse()
 
-	if parser.Err != nil {
-		t.Error(parser.Err)
+	for _, err := range parser.Diags.All() {
+		t.Error(err)
 	}
 
 	ast, err := json.Marshal(res)
@@ -35,3 +37,714 @@ func TestParser(t *testing.T) {
 
 	t.Log(string(ast))
 }
+
+func TestParseInterpolatedString(t *testing.T) {
+	src := `func main() { println("sum: ${add(a, "}") * 2}!"); }`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	call := res.Functions[0].Body.(*BraceExpr).Exprs[0].(*CallExpr)
+	str, ok := call.Args[0].(*InterpolatedStringExpr)
+	if !ok {
+		t.Fatalf("Expected interpolated string, got %T", call.Args[0])
+	}
+	if len(str.Parts) != 2 || str.Parts[0] != "sum: " || str.Parts[1] != "!" {
+		t.Errorf("Unexpected parts %q", str.Parts)
+	}
+	if len(str.Exprs) != 1 || str.Exprs[0].GetType() != EXPR_BINARY {
+		t.Errorf("Unexpected exprs %v", str.Exprs)
+	}
+}
+
+func TestParseInterpolatedStringError(t *testing.T) {
+	src := "func main() {\n  println(\"x = ${x +}\");\n}"
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	parser.Parse()
+
+	if !parser.Diags.HasErrors() {
+		t.Fatal("Expected an error")
+	}
+	pos := parser.Diags.All()[0].Span.Start
+	if pos.Line != 1 || pos.Column != 20 {
+		t.Errorf("Expected error at 1:20, got %d:%d", pos.Line, pos.Column)
+	}
+}
+
+func TestParseRecovery(t *testing.T) {
+	src := `x + 1;
+func main() {
+    let a = ;
+    println(a b);
+    foo();
+}
+func foo() { return }`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	expected := [][2]int{{0, 0}, {2, 12}, {3, 14}}
+	diags := parser.Diags.All()
+	if len(diags) != len(expected) {
+		t.Fatalf("Expected %d errors, got %v", len(expected), diags)
+	}
+	for i, pos := range expected {
+		start := diags[i].Span.Start
+		if start.Line != pos[0] || start.Column != pos[1] {
+			t.Errorf("Expected error %d at %d:%d, got %d:%d", i, pos[0], pos[1], start.Line, start.Column)
+		}
+	}
+
+	if len(res.Functions) != 2 {
+		t.Fatalf("Expected 2 functions, got %d", len(res.Functions))
+	}
+	body := res.Functions[0].Body.(*BraceExpr).Exprs
+	types := []ExprType{EXPR_ERROR, EXPR_ERROR, EXPR_CALL}
+	if len(body) != len(types) {
+		t.Fatalf("Expected %d statements in main, got %d", len(types), len(body))
+	}
+	for i, typ := range types {
+		if body[i].GetType() != typ {
+			t.Errorf("Expected statement %d to be %s, got %s", i, typ, body[i].GetType())
+		}
+	}
+}
+
+func TestParseErrorAtEOF(t *testing.T) {
+	tests := map[string][2]int{
+		"func main() { println(1)": {0, 24},
+		"func main() { func":       {0, 18},
+		"func main() { let a = 1;": {0, 24},
+	}
+
+	for src, pos := range tests {
+		lexer := lexer.NewLexer(&src)
+		parser := NewParser(lexer.ParseAll())
+		parser.Parse()
+
+		diags := parser.Diags.All()
+		if len(diags) != 1 {
+			t.Errorf("%q: expected 1 error, got %v", src, diags)
+			continue
+		}
+		start := diags[0].Span.Start
+		if start.Line != pos[0] || start.Column != pos[1] {
+			t.Errorf("%q: expected error at %d:%d, got %d:%d", src, pos[0], pos[1], start.Line, start.Column)
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	src := `func main() { let a = []; if true {} return; }
+func empty() {}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+	if len(res.Functions) != 2 {
+		t.Fatalf("Expected 2 functions, got %d", len(res.Functions))
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	src := "func main() {\n  let sum = add(1, 2) * 3;\n}"
+	lexer := lexer.NewLexer(&src)
+	lexer.File = "main.kori"
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	decl := res.Functions[0].Body.(*BraceExpr).Exprs[0].(*DeclarationExpr)
+	binary := decl.Expr.(*BinaryExpr)
+	tests := []struct {
+		name       string
+		span       cerr.Span
+		start, end [3]int
+	}{
+		{"function", res.Functions[0].Span, [3]int{0, 0, 0}, [3]int{42, 2, 1}},
+		{"prototype", res.Functions[0].Proto.Span, [3]int{5, 0, 5}, [3]int{11, 0, 11}},
+		{"body", res.Functions[0].Body.GetSpan(), [3]int{12, 0, 12}, [3]int{42, 2, 1}},
+		{"declaration", decl.Span, [3]int{16, 1, 2}, [3]int{39, 1, 25}},
+		{"binary", binary.Span, [3]int{26, 1, 12}, [3]int{39, 1, 25}},
+		{"call", binary.LHS.GetSpan(), [3]int{26, 1, 12}, [3]int{35, 1, 21}},
+		{"number", binary.RHS.GetSpan(), [3]int{38, 1, 24}, [3]int{39, 1, 25}},
+	}
+
+	for _, tt := range tests {
+		start := cerr.Pos{Offset: tt.start[0], Line: tt.start[1], Column: tt.start[2]}
+		end := cerr.Pos{Offset: tt.end[0], Line: tt.end[1], Column: tt.end[2]}
+		if tt.span.File != "main.kori" || tt.span.Start != start || tt.span.End != end {
+			t.Errorf("%s: expected %v-%v, got %v", tt.name, start, end, tt.span)
+		}
+	}
+}
+
+func TestParseGlobals(t *testing.T) {
+	src := `const limit = 10;
+let names = ["a", "b"];
+func main() { println(limit); }
+var count = 0;`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	expected := []string{"const limit", "let names", "var count"}
+	if len(res.Globals) != len(expected) {
+		t.Fatalf("Expected %d globals, got %d", len(expected), len(res.Globals))
+	}
+	for i, global := range res.Globals {
+		if got := global.Kind + " " + global.VarName; got != expected[i] {
+			t.Errorf("Expected global %d to be %s, got %s", i, expected[i], got)
+		}
+	}
+	if len(res.Functions) != 1 {
+		t.Errorf("Expected 1 function, got %d", len(res.Functions))
+	}
+}
+
+func TestParseTopLevelErrors(t *testing.T) {
+	tests := map[string][2]int{
+		"println(1);\nfunc main() {}":            {0, 0},
+		"func main() {}\nlet a = 1\nfunc b() {}": {2, 0},
+		"func main() { const a = 1; }":           {0, 14},
+	}
+
+	for src, pos := range tests {
+		lexer := lexer.NewLexer(&src)
+		parser := NewParser(lexer.ParseAll())
+		res := parser.Parse()
+
+		diags := parser.Diags.All()
+		if len(diags) != 1 {
+			t.Errorf("%q: expected 1 error, got %v", src, diags)
+			continue
+		}
+		start := diags[0].Span.Start
+		if start.Line != pos[0] || start.Column != pos[1] {
+			t.Errorf("%q: expected error at %d:%d, got %d:%d", src, pos[0], pos[1], start.Line, start.Column)
+		}
+		if len(res.Functions) == 0 {
+			t.Errorf("%q: expected the functions to be kept", src)
+		}
+	}
+}
+
+func TestParseStructs(t *testing.T) {
+	src := `struct Point { x, y, }
+func main() {
+    let p = Point { x: 1, y: Point {}.y };
+    p.x.y += 1;
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	if len(res.Structs) != 1 || len(res.Structs[0].Fields) != 2 {
+		t.Fatalf("Expected struct Point with 2 fields, got %v", res.Structs)
+	}
+
+	body := res.Functions[0].Body.(*BraceExpr).Exprs
+	lit := body[0].(*DeclarationExpr).Expr.(*StructLiteralExpr)
+	if lit.Name != "Point" || len(lit.Fields) != 2 || lit.Fields[1].Value.GetType() != EXPR_MEMBER {
+		t.Errorf("Unexpected struct literal %v", lit)
+	}
+
+	assign := body[1].(*AssignExpr)
+	target := assign.Target.(*MemberExpr)
+	if assign.Op != OP_ADD || target.Field != "y" || target.Object.(*MemberExpr).Field != "x" {
+		t.Errorf("Unexpected member assignment %v", assign)
+	}
+}
+
+func TestParseConditionIsNoStructLiteral(t *testing.T) {
+	tests := []string{
+		"if a {}",
+		"if a { b; }",
+		"if a == b {} else if c {}",
+		"for x in xs {}",
+		"for var i = 0; i < n; i += step {}",
+		"if (P {}).x {}",
+		"if f(P { x: 1 }) {}",
+		"if [P {}] == a {}",
+	}
+
+	for _, src := range tests {
+		src = "func main() { " + src + " }"
+		lexer := lexer.NewLexer(&src)
+		parser := NewParser(lexer.ParseAll())
+		res := parser.Parse()
+
+		if parser.Diags.HasErrors() {
+			t.Errorf("%s: %v", src, parser.Diags.All()[0])
+			continue
+		}
+		stmt := res.Functions[0].Body.(*BraceExpr).Exprs[0]
+		if stmt.GetType() != EXPR_IF && stmt.GetType() != EXPR_FOR && stmt.GetType() != EXPR_FOREACH {
+			t.Errorf("%s: expected a statement, got %s", src, stmt.GetType())
+		}
+	}
+}
+
+func TestParseImpl(t *testing.T) {
+	src := `impl Point {
+    func new(x) { return Point { x: x }; }
+    func len(self) { return self.x; }
+}
+func main() { Point.new(1).len().x; }`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	if len(res.Impls) != 1 || len(res.Impls[0].Methods) != 2 {
+		t.Fatalf("Expected impl Point with 2 methods, got %v", res.Impls)
+	}
+	if res.Impls[0].Methods[0].HasSelf() || !res.Impls[0].Methods[1].HasSelf() {
+		t.Errorf("Expected only len to take self")
+	}
+
+	member := res.Functions[0].Body.(*BraceExpr).Exprs[0].(*MemberExpr)
+	call := member.Object.(*CallExpr)
+	method := call.Callee.(*MemberExpr)
+	if method.Field != "len" || len(call.Args) != 0 {
+		t.Fatalf("Unexpected call %v", call)
+	}
+	inner := method.Object.(*CallExpr)
+	if static := inner.Callee.(*MemberExpr); static.Field != "new" || static.Object.(*VariableExpr).Name != "Point" || len(inner.Args) != 1 {
+		t.Errorf("Unexpected call %v", inner)
+	}
+}
+
+func TestParseEnums(t *testing.T) {
+	src := `enum Shape { Circle(r), Rect(w, h), Empty }
+func main() { Shape.Rect(1, 2); Shape.Empty; }`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	if len(res.Enums) != 1 || len(res.Enums[0].Variants) != 3 {
+		t.Fatalf("Expected enum Shape with 3 variants, got %v", res.Enums)
+	}
+	rect := res.Enums[0].Variant("Rect")
+	if rect == nil || len(rect.Fields) != 2 || rect.Fields[1] != "h" {
+		t.Errorf("Unexpected variant %v", rect)
+	}
+	if empty := res.Enums[0].Variant("Empty"); empty == nil || len(empty.Fields) != 0 {
+		t.Errorf("Unexpected variant %v", empty)
+	}
+
+	exprs := res.Functions[0].Body.(*BraceExpr).Exprs
+	if call := exprs[0].(*CallExpr); call.Callee.(*MemberExpr).Field != "Rect" || call.Callee.(*MemberExpr).Object.(*VariableExpr).Name != "Shape" {
+		t.Errorf("Unexpected construction %v", call)
+	}
+	if member := exprs[1].(*MemberExpr); member.Field != "Empty" {
+		t.Errorf("Unexpected construction %v", member)
+	}
+}
+
+func TestParseMatch(t *testing.T) {
+	src := `func main() {
+    let n = match s {
+        Shape.Rect(w, _) if w > 0 => w,
+        Shape.Empty => { 0 }
+        -1 => 1,
+        x => x,
+    };
+    match n { _ => match n { _ => 1 } }
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	exprs := res.Functions[0].Body.(*BraceExpr).Exprs
+	match := exprs[0].(*DeclarationExpr).Expr.(*MatchExpr)
+	if match.Statement || len(match.Arms) != 4 {
+		t.Fatalf("Expected a match value with 4 arms, got %v", match)
+	}
+
+	rect := match.Arms[0].Pattern
+	if rect.Kind != PATTERN_VARIANT || rect.Enum != "Shape" || rect.Variant != "Rect" || len(rect.Args) != 2 {
+		t.Errorf("Unexpected pattern %v", rect)
+	}
+	if rect.Args[0].Kind != PATTERN_BINDING || rect.Args[1].Kind != PATTERN_WILDCARD {
+		t.Errorf("Unexpected fields %v, %v", rect.Args[0], rect.Args[1])
+	}
+	if match.Arms[0].Guard == nil {
+		t.Errorf("Expected a guard")
+	}
+	if minus := match.Arms[2].Pattern; minus.Kind != PATTERN_LITERAL || minus.Value.(*NumberExpr).Val != -1 {
+		t.Errorf("Unexpected pattern %v", minus)
+	}
+
+	outer := exprs[1].(*MatchExpr)
+	inner := outer.Arms[0].Body.(*MatchExpr)
+	if !outer.Statement || !inner.Statement {
+		t.Errorf("Expected the nested match statements to be statements")
+	}
+	if outer.Depth != 0 || inner.Depth != 1 {
+		t.Errorf("Expected depths 0 and 1, got %d and %d", outer.Depth, inner.Depth)
+	}
+}
+
+func TestParsePostfix(t *testing.T) {
+	src := `func main() {
+    matrix[i][j];
+    makeAdder(1)(2);
+    getArr()[0].x;
+    grid[i][j] = v;
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	exprs := res.Functions[0].Body.(*BraceExpr).Exprs
+	index := exprs[0].(*IndexExpr)
+	if inner := index.Array.(*IndexExpr); inner.Array.(*VariableExpr).Name != "matrix" {
+		t.Errorf("Unexpected index %v", index)
+	}
+
+	call := exprs[1].(*CallExpr)
+	if inner := call.Callee.(*CallExpr); inner.CalleeName() != "makeAdder" || call.CalleeName() != "" {
+		t.Errorf("Unexpected call %v", call)
+	}
+
+	member := exprs[2].(*MemberExpr)
+	if _, ok := member.Object.(*IndexExpr).Array.(*CallExpr); !ok {
+		t.Errorf("Unexpected member %v", member)
+	}
+
+	assign := exprs[3].(*AssignExpr)
+	if _, ok := assign.Target.(*IndexExpr).Array.(*IndexExpr); !ok || assign.Op != "" {
+		t.Errorf("Unexpected assignment %v", assign)
+	}
+	if span := assign.Span; span.Start.Line != 4 || span.Start.Column != 4 || span.End.Column != 18 {
+		t.Errorf("Unexpected span %v", span)
+	}
+}
+
+func TestParseInvalidAssignment(t *testing.T) {
+	src := "func main() { f() = 1; }"
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	parser.Parse()
+
+	diags := parser.Diags.All()
+	if len(diags) != 1 || diags[0].Message != "Invalid assignment target" {
+		t.Fatalf("Expected an invalid assignment target, got %v", diags)
+	}
+}
+
+func TestParseLoops(t *testing.T) {
+	src := `func main() {
+    outer: while i < 3 {
+        for x in xs { continue outer; }
+        break;
+    }
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	loop := res.Functions[0].Body.(*BraceExpr).Exprs[0].(*WhileExpr)
+	if loop.Label != "outer" || loop.Cond.GetType() != EXPR_BINARY {
+		t.Fatalf("Unexpected loop %v", loop)
+	}
+	if loop.Span.Start.Column != 4 || loop.LabelSpan.End.Column != 9 {
+		t.Errorf("Expected the loop to start at its label, got %v", loop.Span)
+	}
+
+	body := loop.Body.(*BraceExpr).Exprs
+	inner := body[0].(*ForeachExpr)
+	if cont := inner.Body.(*BraceExpr).Exprs[0].(*ContinueExpr); cont.Label != "outer" {
+		t.Errorf("Unexpected continue %v", cont)
+	}
+	if brk := body[1].(*BreakExpr); brk.Label != "" {
+		t.Errorf("Unexpected break %v", brk)
+	}
+}
+
+func TestParseMaps(t *testing.T) {
+	src := `func main() {
+    let m = #{ "a": 1, key: [2], };
+    for k, v in m {}
+    let e = #{};
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	body := res.Functions[0].Body.(*BraceExpr).Exprs
+	m := body[0].(*DeclarationExpr).Expr.(*MapExpr)
+	if len(m.Entries) != 2 || m.Entries[0].Key.GetType() != EXPR_STRING || m.Entries[1].Key.GetType() != EXPR_VARIABLE {
+		t.Fatalf("Unexpected map %v", m)
+	}
+	if m.Entries[1].Value.GetType() != EXPR_ARRAY {
+		t.Errorf("Expected an array value, got %v", m.Entries[1].Value)
+	}
+	if loop := body[1].(*ForeachExpr); loop.KeyName != "k" || loop.VarName != "v" {
+		t.Errorf("Unexpected loop %v", loop)
+	}
+	if e := body[2].(*DeclarationExpr).Expr.(*MapExpr); len(e.Entries) != 0 {
+		t.Errorf("Expected an empty map, got %v", e)
+	}
+}
+
+func TestParseMapErrors(t *testing.T) {
+	tests := map[string]string{
+		`func main() { #{ "a" 1 }; }`:    "Expected ':' after map key",
+		`func main() { #{ "a": 1 2 }; }`: "Expected ',' or '}' in map literal",
+	}
+
+	for src, expected := range tests {
+		lexer := lexer.NewLexer(&src)
+		parser := NewParser(lexer.ParseAll())
+		parser.Parse()
+
+		diags := parser.Diags.All()
+		if len(diags) == 0 || !strings.HasPrefix(diags[0].Message, expected) {
+			t.Errorf("%s: expected %q, got %v", src, expected, diags)
+		}
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	src := `func main() {
+    for i in 0..n + 1 {}
+    s[..=5];
+    arr[1..];
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	body := res.Functions[0].Body.(*BraceExpr).Exprs
+	rng := body[0].(*ForeachExpr).Array.(*RangeExpr)
+	if rng.Start.GetType() != EXPR_NUMBER || rng.End.GetType() != EXPR_BINARY || rng.Inclusive {
+		t.Errorf("Unexpected range %v", rng)
+	}
+	if rng.Span.Start.Column != 13 || rng.Span.End.Column != 21 {
+		t.Errorf("Unexpected range span %v", rng.Span)
+	}
+	if rng := body[1].(*IndexExpr).Index.(*RangeExpr); rng.Start != nil || !rng.Inclusive {
+		t.Errorf("Unexpected range %v", rng)
+	}
+	if rng := body[2].(*IndexExpr).Index.(*RangeExpr); rng.End != nil {
+		t.Errorf("Unexpected range %v", rng)
+	}
+}
+
+func TestParseRangeErrors(t *testing.T) {
+	tests := map[string]string{
+		"func main() { a[1..=]; }":       "Expected the end of a '..=' range",
+		"func main() { 0..1..2; }":       "Ranges can't be chained",
+		"func main() { a[0..2] = [1]; }": "Invalid assignment target",
+	}
+
+	for src, expected := range tests {
+		lexer := lexer.NewLexer(&src)
+		parser := NewParser(lexer.ParseAll())
+		parser.Parse()
+
+		diags := parser.Diags.All()
+		if len(diags) == 0 || !strings.HasPrefix(diags[0].Message, expected) {
+			t.Errorf("%s: expected %q, got %v", src, expected, diags)
+		}
+	}
+}
+
+func TestParseDestructuring(t *testing.T) {
+	src := `func main() {
+    let [a, _, ..rest] = xs;
+    var Point { x, y: [b, ..] } = p;
+    for [i, v] in enumerate(xs) {}
+    for k, Point { x } in m {}
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	body := res.Functions[0].Body.(*BraceExpr).Exprs
+	names := func(pat *Pattern) []string {
+		var res []string
+		for _, binding := range pat.Bindings() {
+			res = append(res, binding.Name)
+		}
+		return res
+	}
+
+	decl := body[0].(*DeclarationExpr)
+	if decl.Pattern.Kind != PATTERN_ARRAY || decl.Pattern.Args[1].Kind != PATTERN_WILDCARD || decl.Pattern.Args[2].Kind != PATTERN_REST {
+		t.Errorf("Unexpected pattern %v", decl.Pattern)
+	}
+	if got := names(decl.Pattern); len(got) != 2 || got[0] != "a" || got[1] != "rest" {
+		t.Errorf("Expected bindings a and rest, got %v", got)
+	}
+
+	decl = body[1].(*DeclarationExpr)
+	if decl.Pattern.Kind != PATTERN_STRUCT || decl.Pattern.Struct != "Point" || !decl.Mutable {
+		t.Errorf("Unexpected pattern %v", decl.Pattern)
+	}
+	if got := names(decl.Pattern); len(got) != 2 || got[0] != "x" || got[1] != "b" {
+		t.Errorf("Expected bindings x and b, got %v", got)
+	}
+
+	if loop := body[2].(*ForeachExpr); loop.VarName != "" || loop.Pattern.Kind != PATTERN_ARRAY {
+		t.Errorf("Unexpected loop %v", loop)
+	}
+	if loop := body[3].(*ForeachExpr); loop.KeyName != "k" || loop.Pattern.Kind != PATTERN_STRUCT {
+		t.Errorf("Unexpected loop %v", loop)
+	}
+}
+
+func TestParseDestructuringErrors(t *testing.T) {
+	tests := map[string]string{
+		"func main() { let [..rest, last] = xs; }": "A rest pattern must be the last element",
+		"const [a, b] = [1, 2];":                   "Constants can't be destructured",
+		"func main() { let [1] = xs; }":            "Expected a name or a pattern, found '1'",
+		"func main() { let Point { 1 } = p; }":     "Expected field name in struct pattern",
+	}
+
+	for src, expected := range tests {
+		lexer := lexer.NewLexer(&src)
+		parser := NewParser(lexer.ParseAll())
+		parser.Parse()
+
+		diags := parser.Diags.All()
+		if len(diags) == 0 || !strings.HasPrefix(diags[0].Message, expected) {
+			t.Errorf("%s: expected %q, got %v", src, expected, diags)
+		}
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	src := `struct Point { x: number, y }
+func apply(f: func(int) -> int, xs: [float]) -> #{string: Point} {
+    let names: [string] = [];
+    let [a, b]: [any] = xs;
+    return func(v) -> bool { return v; };
+}`
+	lexer := lexer.NewLexer(&src)
+	parser := NewParser(lexer.ParseAll())
+	res := parser.Parse()
+
+	if parser.Diags.HasErrors() {
+		t.Fatal(parser.Diags.All()[0])
+	}
+
+	if fields := res.Structs[0].Fields; fields[0].Type.String() != "number" || fields[1].Type != nil {
+		t.Errorf("Unexpected field types %v, %v", fields[0].Type, fields[1].Type)
+	}
+
+	proto := res.Functions[0].Proto
+	if got := proto.Args[0].Type.String(); got != "func(number) -> number" {
+		t.Errorf("Unexpected type of f %q", got)
+	}
+	if got := proto.Args[1].Type.String(); got != "[number]" {
+		t.Errorf("Unexpected type of xs %q", got)
+	}
+	if got := proto.Result.String(); got != "#{string: Point}" || proto.Result.Kind != TYPE_MAP || proto.Result.Elem.Kind != TYPE_NAMED {
+		t.Errorf("Unexpected result type %q", got)
+	}
+	if proto.Result.Span.Start.Line != 1 || proto.Result.Span.Start.Column != 48 {
+		t.Errorf("Unexpected span of the result type %v", proto.Result.Span)
+	}
+
+	body := res.Functions[0].Body.(*BraceExpr).Exprs
+	if decl := body[0].(*DeclarationExpr); decl.Annotation.String() != "[string]" {
+		t.Errorf("Unexpected annotation %v", decl.Annotation)
+	}
+	if decl := body[1].(*DeclarationExpr); decl.Pattern == nil || decl.Annotation.String() != "[any]" {
+		t.Errorf("Unexpected annotation %v", decl.Annotation)
+	}
+	lambda := body[2].(*ReturnExpr).Value.(*LambdaExpr)
+	if lambda.Proto.Args[0].Type != nil || lambda.Proto.Result.Kind != TYPE_BOOL {
+		t.Errorf("Unexpected lambda prototype %v", lambda.Proto)
+	}
+}
+
+func TestParseAnnotationErrors(t *testing.T) {
+	tests := map[string]string{
+		"func f(a: ) {}":                     "Expected a type, found ')'",
+		"func f() -> {}":                     "Expected a type, found '{'",
+		"func main() { let xs: [int = 1; }":  "Expected ']' in array type",
+		"func main() { let m: #{int} = 1; }": "Expected ':' in map type",
+		"struct P { x: 1 }":                  "Expected a type, found '1'",
+	}
+
+	for src, expected := range tests {
+		lexer := lexer.NewLexer(&src)
+		parser := NewParser(lexer.ParseAll())
+		parser.Parse()
+
+		diags := parser.Diags.All()
+		if len(diags) == 0 || !strings.HasPrefix(diags[0].Message, expected) {
+			t.Errorf("%s: expected %q, got %v", src, expected, diags)
+		}
+	}
+}
+
+func TestFormatTypes(t *testing.T) {
+	a, b := NewTypeVar(1, 0), NewTypeVar(2, 0)
+	apply := NewFuncType([]*Type{NewFuncType([]*Type{a}, b), a}, b)
+	pair := NewArrayType(b)
+
+	got := FormatTypes(apply, pair)
+	if got[0] != "func(func('a) -> 'b, 'a) -> 'b" || got[1] != "['b]" {
+		t.Errorf("Unexpected names %q", got)
+	}
+
+	b.Instance = NewType(TYPE_NUMBER)
+	if got := apply.String(); got != "func(func('a) -> number, 'a) -> number" {
+		t.Errorf("Expected a bound variable to print as its type, got %q", got)
+	}
+}
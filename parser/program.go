@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+// Program is a whole source file. Globals are initialized in source order,
+// all of them before main is called, so an initializer only sees the globals
+// declared above it.
+type Program struct {
+	Type      string             `json:"type"`
+	Structs   []*StructAST       `json:"structs"`
+	Impls     []*ImplAST         `json:"impls"`
+	Enums     []*EnumAST         `json:"enums"`
+	Globals   []*DeclarationExpr `json:"globals"`
+	Functions []*FunctionAST     `json:"functions"`
+}
+
+func NewProgram() *Program {
+	return &Program{
+		Type:      "Program",
+		Structs:   make([]*StructAST, 0),
+		Impls:     make([]*ImplAST, 0),
+		Enums:     make([]*EnumAST, 0),
+		Globals:   make([]*DeclarationExpr, 0),
+		Functions: make([]*FunctionAST, 0),
+	}
+}
+
+func isDeclarationStart(kind lexer.TokenKind) bool {
+	switch kind {
+	case lexer.TOKEN_FUNC, lexer.TOKEN_LET, lexer.TOKEN_VAR, lexer.TOKEN_CONST, lexer.TOKEN_STRUCT, lexer.TOKEN_IMPL, lexer.TOKEN_ENUM:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Parser) parseGlobal() *DeclarationExpr {
+	expr := p.parseDeclarationExpr()
+	if expr == nil {
+		return nil
+	}
+
+	if p.getCurTok().Kind != lexer.TOKEN_SEMI {
+		p.Expect(";", "global declaration")
+		return nil
+	}
+	p.nextToken()
+
+	return expr.(*DeclarationExpr)
+}
+
+// parseTopLevelExpr parses a statement found outside of any function to
+// report it as a whole. Only declarations may appear at the top level.
+func (p *Parser) parseTopLevelExpr() {
+	expr := p.parseExpr()
+	if expr == nil {
+		return
+	}
+
+	p.Diags.Error(cerr.CODE_SYNTAX, expr.GetSpan(), "Expected a declaration, found an expression statement").
+		WithNote("only 'func', 'struct', 'impl', 'enum', 'let', 'var' and 'const' are allowed at the top level, move statements into 'main'")
+	p.panicking = true
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+// RangeExpr is the numbers from Start up to End, `0..n`, or up to and
+// including End, `0..=n`. Looping over a range counts without building an
+// array, indexing with one slices. Start or End may be left out only when
+// slicing, `s[..5]`, `arr[1..]`.
+type RangeExpr struct {
+	BaseExpr
+	Start     Expr `json:"start"`
+	End       Expr `json:"end"`
+	Inclusive bool `json:"inclusive"`
+}
+
+func NewRangeExpr(start, end Expr, inclusive bool) *RangeExpr {
+	return &RangeExpr{
+		BaseExpr:  BaseExpr{Type: EXPR_RANGE},
+		Start:     start,
+		End:       end,
+		Inclusive: inclusive,
+	}
+}
+
+func isRangeOp(kind lexer.TokenKind) bool {
+	return kind == lexer.TOKEN_DOT_DOT || kind == lexer.TOKEN_DOT_DOT_EQ
+}
+
+// parseRangeExpr parses the range operator and the end of a range, start is
+// nil if the range has none. Ranges bind looser than any binary operator,
+// `0..n + 1` ends at n + 1.
+func (p *Parser) parseRangeExpr(start Expr) Expr {
+	op := p.getCurTok()
+	inclusive := op.Kind == lexer.TOKEN_DOT_DOT_EQ
+	p.nextToken()
+
+	var end Expr
+	if p.getCurTok().Kind == lexer.TOKEN_RBRACKET {
+		if inclusive {
+			p.Error(fmt.Sprintf("Expected the end of a '..=' range, found %s", describe(p.getCurTok())))
+			return nil
+		}
+	} else {
+		end = p.parsePrimary()
+		if end == nil {
+			return nil
+		}
+		end = p.parseBinOpRHS(0, end)
+		if end == nil {
+			return nil
+		}
+	}
+
+	if isRangeOp(p.getCurTok().Kind) {
+		p.Error("Ranges can't be chained, wrap the inner range in parentheses")
+		return nil
+	}
+
+	rng := NewRangeExpr(start, end, inclusive)
+	if start != nil {
+		rng.Span = start.GetSpan().To(p.prevTok().Span())
+	} else {
+		rng.Span = p.spanFrom(op)
+	}
+	return rng
+}
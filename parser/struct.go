@@ -0,0 +1,235 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+type StructField struct {
+	Name string `json:"name"`
+	// Type is the annotated type of the field, `x: number`.
+	Type *Type     `json:"type,omitempty"`
+	Span cerr.Span `json:"span"`
+}
+
+type StructAST struct {
+	Type     string         `json:"type"`
+	Name     string         `json:"name"`
+	Fields   []*StructField `json:"fields"`
+	Span     cerr.Span      `json:"span"`
+	NameSpan cerr.Span      `json:"name_span"`
+}
+
+// ImplAST is an impl block adding methods to the struct Name. A method whose
+// first parameter is self is called on a value, the others are called on the
+// struct itself like Point.new(1, 2).
+type ImplAST struct {
+	Type     string         `json:"type"`
+	Name     string         `json:"name"`
+	Methods  []*FunctionAST `json:"methods"`
+	Span     cerr.Span      `json:"span"`
+	NameSpan cerr.Span      `json:"name_span"`
+}
+
+// FieldInit is a `name: value` pair of a struct literal.
+type FieldInit struct {
+	Name  string    `json:"name"`
+	Value Expr      `json:"value"`
+	Span  cerr.Span `json:"span"`
+}
+
+type StructLiteralExpr struct {
+	BaseExpr
+	Name   string       `json:"name"`
+	Fields []*FieldInit `json:"fields"`
+}
+
+type MemberExpr struct {
+	BaseExpr
+	Object    Expr      `json:"object"`
+	Field     string    `json:"field"`
+	FieldSpan cerr.Span `json:"field_span"`
+}
+
+func NewStructAST(name string, fields []*StructField) *StructAST {
+	return &StructAST{
+		Type:   "Struct",
+		Name:   name,
+		Fields: fields,
+	}
+}
+
+func NewImplAST(name string, methods []*FunctionAST) *ImplAST {
+	return &ImplAST{
+		Type:    "Impl",
+		Name:    name,
+		Methods: methods,
+	}
+}
+
+// HasSelf reports whether the function is a method taking self.
+func (f *FunctionAST) HasSelf() bool {
+	return len(f.Proto.Args) > 0 && f.Proto.Args[0].Name == "self"
+}
+
+func NewStructLiteralExpr(name string, fields []*FieldInit) *StructLiteralExpr {
+	return &StructLiteralExpr{
+		BaseExpr: BaseExpr{Type: EXPR_STRUCT},
+		Name:     name,
+		Fields:   fields,
+	}
+}
+
+func NewMemberExpr(object Expr, field string) *MemberExpr {
+	return &MemberExpr{
+		BaseExpr: BaseExpr{Type: EXPR_MEMBER},
+		Object:   object,
+		Field:    field,
+	}
+}
+
+// Field returns the declared field called name, or nil.
+func (s *StructAST) Field(name string) *StructField {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseStruct() *StructAST {
+	start := p.getCurTok()
+	p.nextToken()
+
+	name := p.getCurTok()
+	if name.Kind != lexer.TOKEN_NAME {
+		p.Error(fmt.Sprintf("Expected struct name, found %s", describe(name)))
+		return nil
+	}
+	p.nextToken()
+
+	if p.getCurTok().Kind != lexer.TOKEN_LBRACE {
+		p.Expect("{", "struct declaration")
+		return nil
+	}
+	p.nextToken()
+
+	fields := make([]*StructField, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+		tok := p.getCurTok()
+		if tok.Kind != lexer.TOKEN_NAME {
+			p.Error(fmt.Sprintf("Expected field name, found %s", describe(tok)))
+			return nil
+		}
+		p.nextToken()
+		typ, ok := p.parseAnnotation()
+		if !ok {
+			return nil
+		}
+		fields = append(fields, &StructField{Name: tok.Literal, Type: typ, Span: tok.Span()})
+
+		if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
+			break
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+			p.Error(fmt.Sprintf("Expected ',' or '}' in struct declaration, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		p.nextToken()
+	}
+	p.nextToken()
+
+	st := NewStructAST(name.Literal, fields)
+	st.Span = p.spanFrom(start)
+	st.NameSpan = name.Span()
+	return st
+}
+
+func (p *Parser) parseImpl() *ImplAST {
+	start := p.getCurTok()
+	p.nextToken()
+
+	name := p.getCurTok()
+	if name.Kind != lexer.TOKEN_NAME {
+		p.Error(fmt.Sprintf("Expected struct name, found %s", describe(name)))
+		return nil
+	}
+	p.nextToken()
+
+	if p.getCurTok().Kind != lexer.TOKEN_LBRACE {
+		p.Expect("{", "impl block")
+		return nil
+	}
+	p.nextToken()
+
+	methods := make([]*FunctionAST, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+		if p.getCurTok().Kind != lexer.TOKEN_FUNC {
+			p.Error(fmt.Sprintf("Expected a method declaration, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		method := p.parseFunction()
+		if method == nil {
+			return nil
+		}
+		methods = append(methods, method)
+	}
+	p.nextToken()
+
+	impl := NewImplAST(name.Literal, methods)
+	impl.Span = p.spanFrom(start)
+	impl.NameSpan = name.Span()
+	return impl
+}
+
+// isStructLiteralStart reports whether the '{' at the current token, which
+// follows a name, opens a struct literal. It needs `{}` or `{ name:` to tell
+// a literal from a block, and no literal may start inside a condition.
+func (p *Parser) isStructLiteralStart() bool {
+	if p.noStructLiteral || p.getCurTok().Kind != lexer.TOKEN_LBRACE {
+		return false
+	}
+	return p.peekExpect(1, lexer.TOKEN_RBRACE) ||
+		(p.peekExpect(1, lexer.TOKEN_NAME) && p.peekExpect(2, lexer.TOKEN_COLON))
+}
+
+func (p *Parser) parseStructLiteral(name *lexer.Token) Expr {
+	p.nextToken()
+
+	fields := make([]*FieldInit, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+		tok := p.getCurTok()
+		if tok.Kind != lexer.TOKEN_NAME {
+			p.Error(fmt.Sprintf("Expected field name, found %s", describe(tok)))
+			return nil
+		}
+		p.nextToken()
+
+		if p.getCurTok().Kind != lexer.TOKEN_COLON {
+			p.Expect(":", "struct literal")
+			return nil
+		}
+		p.nextToken()
+
+		value := p.parseNestedExpr()
+		if value == nil {
+			return nil
+		}
+		fields = append(fields, &FieldInit{Name: tok.Literal, Value: value, Span: tok.Span()})
+
+		if p.getCurTok().Kind == lexer.TOKEN_RBRACE {
+			break
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+			p.Error(fmt.Sprintf("Expected ',' or '}' in struct literal, found %s", describe(p.getCurTok())))
+			return nil
+		}
+		p.nextToken()
+	}
+	p.nextToken()
+
+	return p.finish(NewStructLiteralExpr(name.Literal, fields), name)
+}
@@ -0,0 +1,25 @@
+package parser
+
+import "github.com/Kori-Sama/kori-compiler/cerr"
+
+// Symbol is a declared name, the names of a program and the nodes declaring
+// them are linked to their symbol by analysis.Resolve. Variables are
+// declared by let, var and const, bindings by loops and match arms. Builtins
+// have no span.
+type Symbol struct {
+	Name    string
+	Kind    SymbolKind
+	Mutable bool
+	Span    cerr.Span
+	// Proto is the prototype of a function, or of the lambda an immutable
+	// variable is declared with.
+	Proto *PrototypeAST
+	// Type is the annotated or inferred type of the symbol, set by the type
+	// checker. The type of a function or of an immutable lambda may be
+	// generic.
+	Type *Type
+}
+
+func NewSymbol(name string, kind SymbolKind, span cerr.Span) *Symbol {
+	return &Symbol{Name: name, Kind: kind, Span: span}
+}
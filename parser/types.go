@@ -0,0 +1,275 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Kori-Sama/kori-compiler/cerr"
+	"github.com/Kori-Sama/kori-compiler/lexer"
+)
+
+// Type is a type annotation, or the type the checker found for a value. An
+// annotation carries the Span it was written at, an inferred type the span
+// of the expression it was found for.
+//
+// A TYPE_VAR stands for a type that is not known yet. Once the checker finds
+// it, Instance is set and Span is where it was found, see Resolve. A
+// variable of a generalized function type is Generic and stands for a new
+// variable at each use of the function.
+//
+// A variable may be constrained by the uses of its values before it is
+// found: indexing them by a Key gives an Elem, like arrays, strings and maps,
+// and Members are the fields and methods they have, like a struct.
+type Type struct {
+	Kind TypeKind `json:"kind"`
+	// Name is the struct or enum of a TYPE_NAMED.
+	Name string `json:"name,omitempty"`
+	// Elem is the element type of an array and the value type of a map.
+	Elem   *Type     `json:"elem,omitempty"`
+	Key    *Type     `json:"key,omitempty"`
+	Params []*Type   `json:"params,omitempty"`
+	Result *Type     `json:"result,omitempty"`
+	Span   cerr.Span `json:"-"`
+
+	ID       int              `json:"-"`
+	Instance *Type            `json:"-"`
+	Level    int              `json:"-"`
+	Generic  bool             `json:"-"`
+	Members  map[string]*Type `json:"-"`
+}
+
+// Param is a parameter of a prototype, Type is its annotation if it has one.
+type Param struct {
+	Name   string    `json:"name"`
+	Type   *Type     `json:"type,omitempty"`
+	Span   cerr.Span `json:"span"`
+	Symbol *Symbol   `json:"-"`
+}
+
+// primitiveTypes are the type names that are not structs or enums, int and
+// float are spelled out for readability but are both numbers.
+var primitiveTypes = map[string]TypeKind{
+	"any":    TYPE_ANY,
+	"number": TYPE_NUMBER,
+	"int":    TYPE_NUMBER,
+	"float":  TYPE_NUMBER,
+	"string": TYPE_STRING,
+	"bool":   TYPE_BOOL,
+	"void":   TYPE_VOID,
+}
+
+func NewType(kind TypeKind) *Type {
+	return &Type{Kind: kind}
+}
+
+func NewArrayType(elem *Type) *Type {
+	return &Type{Kind: TYPE_ARRAY, Elem: elem}
+}
+
+func NewMapType(key, value *Type) *Type {
+	return &Type{Kind: TYPE_MAP, Key: key, Elem: value}
+}
+
+func NewFuncType(params []*Type, result *Type) *Type {
+	return &Type{Kind: TYPE_FUNC, Params: params, Result: result}
+}
+
+func NewNamedType(name string) *Type {
+	return &Type{Kind: TYPE_NAMED, Name: name}
+}
+
+// NewTypeVar returns a type variable created at the given let level.
+func NewTypeVar(id, level int) *Type {
+	return &Type{Kind: TYPE_VAR, ID: id, Level: level}
+}
+
+// Resolve returns the type t stands for, following the type variables that
+// were found.
+func (t *Type) Resolve() *Type {
+	for t.Kind == TYPE_VAR && t.Instance != nil {
+		t = t.Instance
+	}
+	return t
+}
+
+func (t *Type) String() string {
+	return FormatTypes(t)[0]
+}
+
+// FormatTypes renders types as they are spelled in the source. The type
+// variables are named 'a, 'b... in order of appearance, a variable shared by
+// several types has the same name in each.
+func FormatTypes(types ...*Type) []string {
+	names := make(map[*Type]string)
+	res := make([]string, len(types))
+	for i, typ := range types {
+		res[i] = typ.format(names)
+	}
+	return res
+}
+
+func (t *Type) format(names map[*Type]string) string {
+	t = t.Resolve()
+	switch t.Kind {
+	case TYPE_VAR:
+		name, ok := names[t]
+		if !ok {
+			name = "'" + string(rune('a'+len(names)%26))
+			if len(names) >= 26 {
+				name += fmt.Sprint(len(names) / 26)
+			}
+			names[t] = name
+			// The constraints of a variable are spelled where it first
+			// appears, `'a{[number]: 'b, x: 'c}`.
+			return name + t.formatConstraints(names)
+		}
+		return name
+	case TYPE_ARRAY:
+		return fmt.Sprintf("[%s]", t.Elem.format(names))
+	case TYPE_MAP:
+		return fmt.Sprintf("#{%s: %s}", t.Key.format(names), t.Elem.format(names))
+	case TYPE_FUNC:
+		params := make([]string, len(t.Params))
+		for i, param := range t.Params {
+			params[i] = param.format(names)
+		}
+		return fmt.Sprintf("func(%s) -> %s", strings.Join(params, ", "), t.Result.format(names))
+	case TYPE_NAMED:
+		return t.Name
+	default:
+		return string(t.Kind)
+	}
+}
+
+func (t *Type) formatConstraints(names map[*Type]string) string {
+	var parts []string
+	if t.Elem != nil {
+		parts = append(parts, fmt.Sprintf("[%s]: %s", t.Key.format(names), t.Elem.format(names)))
+	}
+	members := make([]string, 0, len(t.Members))
+	for name := range t.Members {
+		members = append(members, name)
+	}
+	sort.Strings(members)
+	for _, name := range members {
+		parts = append(parts, fmt.Sprintf("%s: %s", name, t.Members[name].format(names)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// MarshalJSON writes the type as it is spelled in the source.
+func (t *Type) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// parseAnnotation parses the optional `: Type` after a name.
+func (p *Parser) parseAnnotation() (typ *Type, ok bool) {
+	if p.getCurTok().Kind != lexer.TOKEN_COLON {
+		return nil, true
+	}
+	p.nextToken()
+	typ = p.parseType()
+	return typ, typ != nil
+}
+
+// parseType parses a type: a name, `[T]` for arrays, `#{K: V}` for maps or
+// `func(A, B) -> R` for functions, which return void without an arrow.
+func (p *Parser) parseType() *Type {
+	start := p.getCurTok()
+	var typ *Type
+	switch start.Kind {
+	case lexer.TOKEN_NAME:
+		p.nextToken()
+		if kind, ok := primitiveTypes[start.Literal]; ok {
+			typ = NewType(kind)
+		} else {
+			typ = NewNamedType(start.Literal)
+		}
+	case lexer.TOKEN_LBRACKET:
+		p.nextToken()
+		elem := p.parseType()
+		if elem == nil {
+			return nil
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_RBRACKET {
+			p.Expect("]", "array type")
+			return nil
+		}
+		p.nextToken()
+		typ = NewArrayType(elem)
+	case lexer.TOKEN_HASH_LBRACE:
+		p.nextToken()
+		key := p.parseType()
+		if key == nil {
+			return nil
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_COLON {
+			p.Expect(":", "map type")
+			return nil
+		}
+		p.nextToken()
+		value := p.parseType()
+		if value == nil {
+			return nil
+		}
+		if p.getCurTok().Kind != lexer.TOKEN_RBRACE {
+			p.Expect("}", "map type")
+			return nil
+		}
+		p.nextToken()
+		typ = NewMapType(key, value)
+	case lexer.TOKEN_FUNC:
+		typ = p.parseFuncType()
+		if typ == nil {
+			return nil
+		}
+	default:
+		p.Error(fmt.Sprintf("Expected a type, found %s", describe(start)))
+		return nil
+	}
+
+	typ.Span = p.spanFrom(start)
+	return typ
+}
+
+func (p *Parser) parseFuncType() *Type {
+	p.nextToken()
+	if p.getCurTok().Kind != lexer.TOKEN_LPAREN {
+		p.Expect("(", "function type")
+		return nil
+	}
+	p.nextToken()
+
+	params := make([]*Type, 0)
+	for p.getCurTok().Kind != lexer.TOKEN_RPAREN {
+		param := p.parseType()
+		if param == nil {
+			return nil
+		}
+		params = append(params, param)
+
+		if p.getCurTok().Kind != lexer.TOKEN_COMMA {
+			break
+		}
+		p.nextToken()
+	}
+	if p.getCurTok().Kind != lexer.TOKEN_RPAREN {
+		p.Expect(")", "function type")
+		return nil
+	}
+	p.nextToken()
+
+	result := NewType(TYPE_VOID)
+	if p.getCurTok().Kind == lexer.TOKEN_ARROW {
+		p.nextToken()
+		if result = p.parseType(); result == nil {
+			return nil
+		}
+	}
+	return NewFuncType(params, result)
+}
@@ -0,0 +1,95 @@
+package parser
+
+// Inspect traverses the tree rooted at expr in depth-first order. It calls
+// f for every node and visits the children of a node only if f returns true.
+func Inspect(expr Expr, f func(Expr) bool) {
+	if expr == nil || !f(expr) {
+		return
+	}
+
+	switch n := expr.(type) {
+	case *InterpolatedStringExpr:
+		inspectAll(n.Exprs, f)
+	case *ArrayExpr:
+		inspectAll(n.Values, f)
+	case *MapExpr:
+		for _, entry := range n.Entries {
+			Inspect(entry.Key, f)
+			Inspect(entry.Value, f)
+		}
+	case *BinaryExpr:
+		Inspect(n.LHS, f)
+		Inspect(n.RHS, f)
+	case *UnaryExpr:
+		Inspect(n.RHS, f)
+	case *BraceExpr:
+		inspectAll(n.Exprs, f)
+	case *CallExpr:
+		Inspect(n.Callee, f)
+		inspectAll(n.Args, f)
+	case *IndexExpr:
+		Inspect(n.Array, f)
+		Inspect(n.Index, f)
+	case *RangeExpr:
+		Inspect(n.Start, f)
+		Inspect(n.End, f)
+	case *IfExpr:
+		Inspect(n.Cond, f)
+		Inspect(n.Then, f)
+		Inspect(n.Else, f)
+	case *ForExpr:
+		Inspect(n.Start, f)
+		Inspect(n.End, f)
+		Inspect(n.Step, f)
+		Inspect(n.Body, f)
+	case *WhileExpr:
+		Inspect(n.Cond, f)
+		Inspect(n.Body, f)
+	case *ForeachExpr:
+		Inspect(n.Array, f)
+		Inspect(n.Body, f)
+	case *DeclarationExpr:
+		Inspect(n.Expr, f)
+	case *AssignExpr:
+		Inspect(n.Target, f)
+		Inspect(n.Value, f)
+	case *ReturnExpr:
+		Inspect(n.Value, f)
+	case *LambdaExpr:
+		Inspect(n.Body, f)
+	case *StructLiteralExpr:
+		for _, field := range n.Fields {
+			Inspect(field.Value, f)
+		}
+	case *MemberExpr:
+		Inspect(n.Object, f)
+	case *MatchExpr:
+		Inspect(n.Subject, f)
+		for _, arm := range n.Arms {
+			Inspect(arm.Guard, f)
+			Inspect(arm.Body, f)
+		}
+	}
+}
+
+// InspectProgram calls Inspect on every global initializer, function body
+// and method body of prog.
+func InspectProgram(prog *Program, f func(Expr) bool) {
+	for _, global := range prog.Globals {
+		Inspect(global, f)
+	}
+	for _, fn := range prog.Functions {
+		Inspect(fn.Body, f)
+	}
+	for _, impl := range prog.Impls {
+		for _, method := range impl.Methods {
+			Inspect(method.Body, f)
+		}
+	}
+}
+
+func inspectAll(exprs []Expr, f func(Expr) bool) {
+	for _, expr := range exprs {
+		Inspect(expr, f)
+	}
+}